@@ -10,10 +10,13 @@ import (
 	"time"
 
 	"SmartMeterSystem/internal"
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/scheduler"
 	"SmartMeterSystem/internal/server"
+	"SmartMeterSystem/internal/telemetry"
 )
 
-func gracefulShutdown(apiServer *http.Server, done chan bool) {
+func gracefulShutdown(apiServer *http.Server, billingScheduler *scheduler.BillingScheduler, connectivityMonitor *scheduler.ConnectivityMonitor, done chan bool) {
 	logger, loggerErr := internal.NewLogger()
 	if loggerErr != nil {
 		panic(loggerErr)
@@ -37,6 +40,19 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 		logger.Sugar().Infof("Server forced to shutdown with error: %v", err)
 	}
 
+	// The schedulers each have time of their own to wind their run down and
+	// give their lease up, however long the server took
+	billingCtx, cancelBilling := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelBilling()
+	if err := billingScheduler.Stop(billingCtx); err != nil {
+		logger.Sugar().Infof("Billing scheduler stopped with error: %v", err)
+	}
+	connectivityCtx, cancelConnectivity := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelConnectivity()
+	if err := connectivityMonitor.Stop(connectivityCtx); err != nil {
+		logger.Sugar().Infof("Connectivity monitor stopped with error: %v", err)
+	}
+
 	logger.Sugar().Info("Server exiting")
 
 	// Notify the main goroutine that the shutdown is complete
@@ -51,7 +67,17 @@ func main() {
 	defer logger.Sync()
 
 	// New server
-	server := server.NewServer()
+	db := database.New()
+	hub := telemetry.NewHub()
+	server := server.NewServer(db, hub)
+
+	// Close the billing cycles in the background
+	billingScheduler := scheduler.NewBillingScheduler(db, logger, scheduler.BillingConfigFromEnv())
+	billingScheduler.Start()
+
+	// Mark the meters online, stale or offline in the background
+	connectivityMonitor := scheduler.NewConnectivityMonitor(db, hub, logger, scheduler.ConnectivityConfigFromEnv())
+	connectivityMonitor.Start()
 
 	// Construct the full address
 	fullAddress := fmt.Sprintf("http://%s%s", internal.GetResolvedIP(), server.Addr)
@@ -61,7 +87,7 @@ func main() {
 	done := make(chan bool, 1)
 
 	// Run graceful shutdown in a separate goroutine
-	go gracefulShutdown(server, done)
+	go gracefulShutdown(server, billingScheduler, connectivityMonitor, done)
 
 	serverErr := server.ListenAndServe()
 	if serverErr != nil && serverErr != http.ErrServerClosed {
@@ -0,0 +1,284 @@
+/*
+ * @file cmd/simulator/main.go
+ * @brief main.go file runs N virtual smart meters posting readings to the meter API, for development and load testing
+ */
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"SmartMeterSystem/internal"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/database"
+
+	"go.uber.org/zap"
+)
+
+// simulatedMeter is a meter the simulator runs: its identity, token, class
+// and where it left off
+type simulatedMeter struct {
+	Serial string
+	Token  string
+	Class  string
+	Last   *database.Reading // latest reading stored, nil when unknown
+}
+
+func main() {
+	var (
+		config    simConfig
+		meters    = flag.Int("meters", 10, "number of virtual meters")
+		prefix    = flag.String("prefix", "SIM", "serial number prefix of the virtual meters")
+		mix       = flag.String("mix", "residential=80,commercial=15,industrial=5", "share of the meters of each class")
+		provision = flag.Bool("provision", true, "register the meters in the database and issue their device tokens")
+		tokens    = flag.String("tokens", "", "JSON file of serial number to device token, written when provisioning and read otherwise")
+		latitude  = flag.Float64("lat", 13.93, "latitude the meters are placed around")
+		longitude = flag.Float64("lon", 120.73, "longitude the meters are placed around")
+		radius    = flag.Float64("radius", 10, "radius in km the meters are placed within")
+		seed      = flag.Uint64("seed", 1, "seed of the random load, outages and drift")
+		reportAt  = flag.Duration("report", 30*time.Second, "how often the counters are logged")
+	)
+	flag.StringVar(&config.BaseURL, "url", defaultBaseURL(), "base URL of the server")
+	flag.DurationVar(&config.Interval, "interval", 15*time.Minute, "interval between readings")
+	flag.DurationVar(&config.CommandPoll, "command-poll", time.Minute, "interval between polls for commands")
+	flag.DurationVar(&config.Jitter, "jitter", 30*time.Second, "bound of the random delay before each upload")
+	flag.Float64Var(&config.OutageRate, "outage-rate", 0.01, "chance per interval that a meter goes offline")
+	flag.DurationVar(&config.OutageMax, "outage-max", 2*time.Hour, "bound of how long an outage lasts")
+	flag.DurationVar(&config.MaxDrift, "drift", 30*time.Second, "bound of the clock offset each meter starts with")
+	flag.Float64Var(&config.DriftPPM, "drift-ppm", 50, "bound of how fast each meter clock runs off, in parts per million")
+	flag.Float64Var(&config.TamperRate, "tamper-rate", 0.0005, "chance per reading of a tamper flag")
+	flag.DurationVar(&config.Backfill, "backfill", 0, "history to upload on start, e.g. 168h for a week")
+	flag.Parse()
+
+	logger, loggerErr := internal.NewLogger()
+	if loggerErr != nil {
+		panic(loggerErr)
+	}
+	defer logger.Sync()
+	sugar := logger.Sugar()
+
+	classMix, err := parseClassMix(*mix)
+	if err == nil {
+		err = validateConfig(config, *meters)
+	}
+	if err != nil {
+		sugar.Fatalf("Invalid configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var simulated []simulatedMeter
+	if *provision {
+		area := placement{Latitude: *latitude, Longitude: *longitude, RadiusKM: *radius}
+		simulated, err = provisionMeters(ctx, database.New(), *prefix, *meters, classMix.classes(*meters), area, *seed, sugar)
+		if err == nil && *tokens != "" {
+			err = writeTokens(*tokens, simulated)
+		}
+	} else {
+		simulated, err = readTokens(*tokens)
+		for i, class := range classMix.classes(len(simulated)) {
+			simulated[i].Class = class
+		}
+	}
+	if err != nil {
+		sugar.Fatalf("Meters not ready: %v", err)
+	}
+	if len(simulated) == 0 {
+		sugar.Fatal("No meters to simulate")
+	}
+
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: len(simulated), IdleConnTimeout: 90 * time.Second},
+	}
+	counters := &stats{}
+
+	sugar.Infof("Simulating %d meters against %s, a reading every %s", len(simulated), config.BaseURL, config.Interval)
+	var wg sync.WaitGroup
+	for i, meter := range simulated {
+		virtual := newVirtualMeter(meter.Serial, meter.Token, meter.Class, *seed+uint64(i), client, &config, counters, sugar)
+		virtual.resume(meter.Last)
+		backfillFrom := time.Now().Add(-config.Backfill)
+		if meter.Last != nil && meter.Last.Timestamp.After(backfillFrom) {
+			backfillFrom = meter.Last.Timestamp
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			virtual.run(ctx, backfillFrom)
+		}()
+	}
+
+	ticker := time.NewTicker(*reportAt)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			counters.report(sugar)
+			sugar.Info("Simulator stopped")
+			return
+		case <-ticker.C:
+			counters.report(sugar)
+		}
+	}
+}
+
+// defaultBaseURL is the server on this host at PORT
+func defaultBaseURL() string {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port
+}
+
+func validateConfig(config simConfig, meters int) error {
+	switch {
+	case meters <= 0:
+		return errors.New("meters must be at least 1")
+	case config.Interval < time.Second:
+		return errors.New("interval must be at least 1s")
+	case config.CommandPoll < time.Second:
+		return errors.New("command-poll must be at least 1s")
+	case config.Jitter < 0 || config.Jitter >= config.Interval:
+		return errors.New("jitter must be shorter than the interval")
+	case config.OutageRate < 0 || config.OutageRate > 1 || config.TamperRate < 0 || config.TamperRate > 1:
+		return errors.New("outage-rate and tamper-rate must be between 0 and 1")
+	case config.OutageMax <= 0:
+		return errors.New("outage-max must be positive")
+	case config.MaxDrift < 0 || config.DriftPPM < 0:
+		return errors.New("drift and drift-ppm cannot be negative")
+	case config.Backfill < 0 || config.Backfill >= database.RawReadingRetention:
+		return fmt.Errorf("backfill must be shorter than the raw reading retention of %s", database.RawReadingRetention)
+	}
+	return nil
+}
+
+// placement is the area the provisioned meters are spread over
+type placement struct {
+	Latitude, Longitude float64
+	RadiusKM            float64
+}
+
+// point places meter i at a spot of the area that stays the same between
+// runs with the same seed
+func (p placement) point(seed uint64, i int) (float64, float64) {
+	rng := rand.New(rand.NewPCG(seed, uint64(i)))
+	// The square root spreads the meters evenly over the disc
+	distance := p.RadiusKM * math.Sqrt(rng.Float64())
+	bearing := rng.Float64() * 2 * math.Pi
+	const kmPerDegree = 111.32
+	latitude := p.Latitude + distance*math.Cos(bearing)/kmPerDegree
+	longitude := p.Longitude + distance*math.Sin(bearing)/(kmPerDegree*math.Cos(p.Latitude*math.Pi/180))
+	return latitude, longitude
+}
+
+// simulatedLocation marks the meters the simulator registered, the only ones
+// it issues new device tokens
+const simulatedLocation = "Simulated"
+
+// provisionMeters registers the virtual meters missing from the registry
+// and issues every one a new device token. Tokens of earlier runs stop
+// working, the registry only keeps their hashes. A registered meter the
+// simulator did not register stops provisioning, so a prefix matching real
+// meters cannot take their tokens over.
+func provisionMeters(ctx context.Context, db database.Service, prefix string, n int, classes []string, area placement, seed uint64, logger *zap.SugaredLogger) ([]simulatedMeter, error) {
+	simulated := make([]simulatedMeter, 0, n)
+	created := 0
+	for i := range n {
+		serial := fmt.Sprintf("%s-%05d", prefix, i+1)
+		token, hash, err := auth.NewDeviceToken()
+		if err != nil {
+			return nil, err
+		}
+
+		meter, err := db.Meters().Get(ctx, serial)
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			latitude, longitude := area.point(seed, i)
+			meter = &database.Meter{
+				SerialNumber:     serial,
+				SNID:             fmt.Sprintf("%09d", 900000000+i+1),
+				Name:             fmt.Sprintf("Simulated %s %05d", classes[i], i+1),
+				Location:         simulatedLocation,
+				Latitude:         latitude,
+				Longitude:        longitude,
+				TransformerID:    fmt.Sprintf("%d", 9000+i/20),
+				InstallationDate: time.Now().UTC().Truncate(24 * time.Hour),
+				DeviceTokenHash:  hash,
+			}
+			if err := db.Meters().Create(ctx, meter); err != nil {
+				return nil, fmt.Errorf("meter %s: %w", serial, err)
+			}
+			created++
+		case err != nil:
+			return nil, fmt.Errorf("meter %s: %w", serial, err)
+		case meter.Location != simulatedLocation:
+			return nil, fmt.Errorf("meter %s was not registered by the simulator, choose another prefix", serial)
+		case meter.Status == database.MeterStatusDecommissioned:
+			logger.Warnf("Meter %s is decommissioned, skipped", serial)
+			continue
+		default:
+			if err := db.Meters().SetDeviceToken(ctx, serial, hash); err != nil {
+				return nil, fmt.Errorf("meter %s: %w", serial, err)
+			}
+		}
+
+		last, err := db.Readings().Last(ctx, serial, time.Now().Add(time.Hour))
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			return nil, fmt.Errorf("meter %s: %w", serial, err)
+		}
+		simulated = append(simulated, simulatedMeter{Serial: serial, Token: token, Class: classes[i], Last: last})
+	}
+	logger.Infof("Provisioned %d meters, %d registered now", len(simulated), created)
+	return simulated, nil
+}
+
+// writeTokens saves the device tokens so a later run can skip provisioning
+func writeTokens(path string, meters []simulatedMeter) error {
+	tokens := make(map[string]string, len(meters))
+	for _, meter := range meters {
+		tokens[meter.Serial] = meter.Token
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// readTokens loads the meters to simulate from a file of device tokens, in
+// serial number order
+func readTokens(path string) ([]simulatedMeter, error) {
+	if path == "" {
+		return nil, errors.New("tokens is required without provision")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens := map[string]string{}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	meters := make([]simulatedMeter, 0, len(tokens))
+	for serial, token := range tokens {
+		meters = append(meters, simulatedMeter{Serial: serial, Token: token})
+	}
+	sort.Slice(meters, func(i, j int) bool { return meters[i].Serial < meters[j].Serial })
+	return meters, nil
+}
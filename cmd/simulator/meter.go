@@ -0,0 +1,385 @@
+/*
+ * @file cmd/simulator/meter.go
+ * @brief meter.go file holds the virtual meter uploading readings and carrying out commands like a field device
+ */
+package main
+
+import (
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/meterapi"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// uploadBatch bounds the readings of one upload, under the server limit
+	uploadBatch = 500
+	// maxBacklog bounds the readings a meter keeps while it cannot upload,
+	// dropping the oldest, like the memory of a field device
+	maxBacklog = 2000
+	// sagChance is the chance of a reading catching a voltage sag
+	sagChance = 0.002
+)
+
+// tamperFlags are the tamper events a meter may report
+var tamperFlags = []string{"cover_open", "magnetic_field", "reverse_phase"}
+
+// simConfig is what every virtual meter runs with
+type simConfig struct {
+	BaseURL     string        // of the server, e.g. http://localhost:8080
+	Interval    time.Duration // between readings
+	CommandPoll time.Duration // between polls for commands
+	Jitter      time.Duration // bound of the random delay before an upload
+	OutageRate  float64       // chance per interval that a meter goes offline
+	OutageMax   time.Duration // bound of how long an outage lasts
+	MaxDrift    time.Duration // bound of the clock offset a meter starts with
+	DriftPPM    float64       // bound of how fast a meter clock runs off
+	TamperRate  float64       // chance per reading of a tamper flag
+	Backfill    time.Duration // history uploaded on start
+}
+
+// stats counts what the meters did, for the periodic report
+type stats struct {
+	uploads, failed, accepted, duplicates, rejected atomic.Int64
+	commands, outages                               atomic.Int64
+	latency                                         atomic.Int64 // total of the uploads, in nanoseconds
+}
+
+func (s *stats) report(logger *zap.SugaredLogger) {
+	uploads := s.uploads.Load()
+	mean := time.Duration(0)
+	if uploads > 0 {
+		mean = time.Duration(s.latency.Load() / uploads)
+	}
+	logger.Infof("Uploads %d (%d failed), readings accepted %d, duplicates %d, rejected %d, commands %d, outages %d, mean latency %s",
+		uploads, s.failed.Load(), s.accepted.Load(), s.duplicates.Load(), s.rejected.Load(),
+		s.commands.Load(), s.outages.Load(), mean.Round(time.Millisecond))
+}
+
+// virtualMeter is one simulated smart meter. Its goroutine owns its state.
+type virtualMeter struct {
+	serial string
+	token  string
+	class  string
+
+	profile        loadProfile
+	peakKW         float64
+	nominalVoltage float64
+	energyKWh      float64   // register
+	lastSample     time.Time // zero before the first reading
+	clockOffset    time.Duration
+	driftPPM       float64
+	disconnected   bool
+	offlineUntil   time.Time
+	backlog        []meterapi.Reading
+
+	rng    *rand.Rand
+	client *http.Client
+	config *simConfig
+	stats  *stats
+	logger *zap.SugaredLogger
+}
+
+func newVirtualMeter(serial, token, class string, seed uint64, client *http.Client, config *simConfig, stats *stats, logger *zap.SugaredLogger) *virtualMeter {
+	rng := rand.New(rand.NewPCG(seed, 0x5eed))
+	profile := profiles[class]
+	return &virtualMeter{
+		serial:         serial,
+		token:          token,
+		class:          class,
+		profile:        profile,
+		peakKW:         profile.minPeakKW + rng.Float64()*(profile.maxPeakKW-profile.minPeakKW),
+		nominalVoltage: 230,
+		clockOffset:    time.Duration((rng.Float64()*2 - 1) * float64(config.MaxDrift)),
+		driftPPM:       (rng.Float64()*2 - 1) * config.DriftPPM,
+		rng:            rng,
+		client:         client,
+		config:         config,
+		stats:          stats,
+		logger:         logger,
+	}
+}
+
+// resume continues the register from the latest reading stored, so a
+// restarted simulator does not run it backwards. Without one, the register
+// starts from what the meter would have used over a few months.
+func (m *virtualMeter) resume(last *database.Reading) {
+	if last != nil {
+		m.energyKWh = last.EnergyKWh
+		return
+	}
+	m.energyKWh = math.Round(m.peakKW*(500+m.rng.Float64()*2000)*100) / 100
+}
+
+// run uploads readings on the interval boundaries and polls for commands
+// until ctx ends
+func (m *virtualMeter) run(ctx context.Context, backfillFrom time.Time) {
+	if m.config.Backfill > 0 {
+		m.backfill(ctx, backfillFrom, time.Now())
+	}
+
+	// Spread the command polls so the meters do not poll in step
+	commands := time.NewTicker(m.config.CommandPoll + time.Duration(m.rng.Int64N(int64(time.Second))))
+	defer commands.Stop()
+	next := nextBoundary(time.Now(), m.config.Interval)
+	reading := time.NewTimer(time.Until(next))
+	defer reading.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reading.C:
+			m.tick(ctx, next)
+			next = nextBoundary(time.Now(), m.config.Interval)
+			reading.Reset(time.Until(next))
+		case <-commands.C:
+			m.pollCommands(ctx)
+		}
+	}
+}
+
+// nextBoundary is the first multiple of the interval after t, which is when
+// meters take their interval readings
+func nextBoundary(t time.Time, interval time.Duration) time.Time {
+	return t.Truncate(interval).Add(interval)
+}
+
+// backfill uploads the readings of the interval boundaries from from to now
+func (m *virtualMeter) backfill(ctx context.Context, from, now time.Time) {
+	for at := nextBoundary(from, m.config.Interval); at.Before(now) && ctx.Err() == nil; at = at.Add(m.config.Interval) {
+		m.backlog = append(m.backlog, m.sample(at))
+		if len(m.backlog) >= uploadBatch {
+			if !m.flush(ctx) {
+				return
+			}
+		}
+	}
+	m.flush(ctx)
+}
+
+// tick takes the reading of the interval ending at, and uploads it with the
+// backlog unless the meter is offline
+func (m *virtualMeter) tick(ctx context.Context, at time.Time) {
+	m.backlog = append(m.backlog, m.sample(at))
+	if len(m.backlog) > maxBacklog {
+		m.backlog = m.backlog[len(m.backlog)-maxBacklog:]
+	}
+
+	if at.Before(m.offlineUntil) {
+		return
+	}
+	if m.rng.Float64() < m.config.OutageRate {
+		m.offlineUntil = at.Add(time.Duration(m.rng.Int64N(int64(m.config.OutageMax)) + 1))
+		m.stats.outages.Add(1)
+		m.logger.Debugf("Meter %s offline until %s", m.serial, m.offlineUntil.Format(time.TimeOnly))
+		return
+	}
+
+	if m.config.Jitter > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(m.rng.Int64N(int64(m.config.Jitter)))):
+		}
+	}
+	m.flush(ctx)
+}
+
+// sample takes a reading at, as stamped by the drifting meter clock
+func (m *virtualMeter) sample(at time.Time) meterapi.Reading {
+	elapsed := m.config.Interval
+	if !m.lastSample.IsZero() {
+		elapsed = at.Sub(m.lastSample)
+	}
+	m.lastSample = at
+
+	power := 0.0
+	if !m.disconnected {
+		power = m.profile.power(at.In(database.RollupLocation), m.peakKW, m.rng)
+	}
+	m.energyKWh += power * elapsed.Hours()
+	m.clockOffset += time.Duration(float64(elapsed) * m.driftPPM / 1e6)
+
+	voltage := m.nominalVoltage * (1 + m.rng.NormFloat64()*0.01)
+	if m.rng.Float64() < sagChance {
+		voltage *= 0.8
+	}
+	reading := meterapi.Reading{
+		Timestamp: at.Add(m.clockOffset).UTC(),
+		EnergyKWh: float(round(m.energyKWh, 3)),
+		PowerKW:   float(round(power, 3)),
+		Voltage:   float(round(voltage, 1)),
+		Current:   float(round(power*1000/voltage, 2)),
+	}
+	if m.rng.Float64() < m.config.TamperRate {
+		reading.TamperFlags = []string{tamperFlags[m.rng.IntN(len(tamperFlags))]}
+	}
+	return reading
+}
+
+// flush uploads the backlog in batches, reporting whether it emptied. A
+// batch the server rejects as invalid, such as one stamped too far ahead by
+// a drifting clock, is dropped like a real meter would after a 422.
+func (m *virtualMeter) flush(ctx context.Context) bool {
+	for len(m.backlog) > 0 {
+		batch := m.backlog[:min(len(m.backlog), uploadBatch)]
+		status, result, err := m.upload(ctx, batch)
+		switch {
+		case err != nil:
+			m.stats.failed.Add(1)
+			m.logger.Warnf("Meter %s upload failed: %v", m.serial, err)
+			return false
+		case status == http.StatusUnprocessableEntity:
+			m.stats.rejected.Add(int64(len(batch)))
+			m.logger.Warnf("Meter %s readings rejected: %s", m.serial, result)
+		case status != http.StatusOK:
+			m.stats.failed.Add(1)
+			m.logger.Warnf("Meter %s upload failed with %d: %s", m.serial, status, result)
+			return false
+		}
+		m.backlog = m.backlog[len(batch):]
+	}
+	m.backlog = nil
+	return true
+}
+
+// upload posts the readings, returning the status and, unless accepted,
+// the error the server gave
+func (m *virtualMeter) upload(ctx context.Context, readings []meterapi.Reading) (int, string, error) {
+	body, err := json.Marshal(meterapi.ReadingBatch{Readings: readings})
+	if err != nil {
+		return 0, "", err
+	}
+	started := time.Now()
+	response, err := m.request(ctx, http.MethodPost, "readings", body)
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+	m.stats.uploads.Add(1)
+	m.stats.latency.Add(int64(time.Since(started)))
+
+	if response.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(response.Body).Decode(&apiErr)
+		return response.StatusCode, apiErr.Error, nil
+	}
+	var result meterapi.ReadingResult
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return 0, "", err
+	}
+	m.stats.accepted.Add(int64(result.Accepted))
+	m.stats.duplicates.Add(int64(result.Duplicates))
+	return response.StatusCode, "", nil
+}
+
+// pollCommands carries out and acknowledges the commands due, unless the
+// meter is offline
+func (m *virtualMeter) pollCommands(ctx context.Context) {
+	if time.Now().Before(m.offlineUntil) {
+		return
+	}
+	response, err := m.request(ctx, http.MethodGet, "commands", nil)
+	if err != nil {
+		m.logger.Warnf("Meter %s command poll failed: %v", m.serial, err)
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		m.logger.Warnf("Meter %s command poll failed with %d", m.serial, response.StatusCode)
+		return
+	}
+	var poll meterapi.CommandPoll
+	if err := json.NewDecoder(response.Body).Decode(&poll); err != nil {
+		m.logger.Warnf("Meter %s command poll unreadable: %v", m.serial, err)
+		return
+	}
+
+	for _, command := range poll.Commands {
+		ack := m.execute(ctx, command, poll.ServerTime)
+		if err := m.acknowledge(ctx, command.ID, ack); err != nil {
+			m.logger.Warnf("Meter %s acknowledgement of %s failed: %v", m.serial, command.ID, err)
+			continue
+		}
+		m.stats.commands.Add(1)
+		m.logger.Infof("Meter %s %s %s: %s", m.serial, command.Type, ack.Status, ack.Result)
+	}
+}
+
+// execute carries out the command, serverTime being when it was handed out
+func (m *virtualMeter) execute(ctx context.Context, command meterapi.PolledCommand, serverTime time.Time) meterapi.CommandAck {
+	switch command.Type {
+	case database.CommandDisconnect:
+		m.disconnected = true
+		return meterapi.CommandAck{Status: database.CommandStatusSucceeded, Result: "relay open"}
+	case database.CommandReconnect:
+		m.disconnected = false
+		return meterapi.CommandAck{Status: database.CommandStatusSucceeded, Result: "relay closed"}
+	case database.CommandSyncClock:
+		previous := m.clockOffset
+		m.clockOffset = serverTime.Sub(time.Now())
+		return meterapi.CommandAck{
+			Status: database.CommandStatusSucceeded,
+			Result: fmt.Sprintf("clock corrected by %s", (m.clockOffset - previous).Round(time.Millisecond)),
+		}
+	case database.CommandReadNow:
+		m.backlog = append(m.backlog, m.sample(time.Now()))
+		if !m.flush(ctx) {
+			return meterapi.CommandAck{Status: database.CommandStatusFailed, Result: "upload failed"}
+		}
+		return meterapi.CommandAck{Status: database.CommandStatusSucceeded, Result: "reading uploaded"}
+	default:
+		return meterapi.CommandAck{Status: database.CommandStatusFailed, Result: "unsupported command " + command.Type}
+	}
+}
+
+func (m *virtualMeter) acknowledge(ctx context.Context, id string, ack meterapi.CommandAck) error {
+	body, err := json.Marshal(ack)
+	if err != nil {
+		return err
+	}
+	response, err := m.request(ctx, http.MethodPost, "commands/"+url.PathEscape(id)+"/ack", body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// A command acknowledged before, by an earlier attempt, is done
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusConflict {
+		return fmt.Errorf("status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// request calls the meter API of the server as this meter
+func (m *virtualMeter) request(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	endpoint := m.config.BaseURL + "/v1/meter/" + url.PathEscape(m.serial) + "/" + path
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+m.token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return m.client.Do(request)
+}
+
+func float(v float64) *float64 { return &v }
+
+func round(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/database/databasetest"
+	"SmartMeterSystem/internal/meterapi"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeMeterAPI records the uploads and hands out the queued commands
+type fakeMeterAPI struct {
+	mu       sync.Mutex
+	readings []meterapi.Reading
+	commands []meterapi.PolledCommand
+	acks     map[string]meterapi.CommandAck
+	status   int // of the uploads, 200 when zero
+}
+
+func (f *fakeMeterAPI) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/meter/{serial}/readings", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("upload Authorization = %q", r.Header.Get("Authorization"))
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.status != 0 {
+			w.WriteHeader(f.status)
+			w.Write([]byte(`{"error":"unavailable"}`))
+			return
+		}
+		var batch meterapi.ReadingBatch
+		json.NewDecoder(r.Body).Decode(&batch)
+		f.readings = append(f.readings, batch.Readings...)
+		json.NewEncoder(w).Encode(meterapi.ReadingResult{Accepted: len(batch.Readings)})
+	})
+	mux.HandleFunc("GET /v1/meter/{serial}/commands", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(meterapi.CommandPoll{ServerTime: time.Now(), Commands: f.commands})
+		f.commands = nil
+	})
+	mux.HandleFunc("POST /v1/meter/{serial}/commands/{id}/ack", func(w http.ResponseWriter, r *http.Request) {
+		var ack meterapi.CommandAck
+		json.NewDecoder(r.Body).Decode(&ack)
+		f.mu.Lock()
+		f.acks[r.PathValue("id")] = ack
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func testMeter(t *testing.T, api *fakeMeterAPI) *virtualMeter {
+	server := httptest.NewServer(api.handler(t))
+	t.Cleanup(server.Close)
+	config := &simConfig{BaseURL: server.URL, Interval: 15 * time.Minute, OutageMax: time.Hour}
+	meter := newVirtualMeter("SIM-00001", "token", classResidential, 1, server.Client(), config, &stats{}, zap.NewNop().Sugar())
+	meter.resume(nil)
+	return meter
+}
+
+func TestVirtualMeterBacklog(t *testing.T) {
+	api := &fakeMeterAPI{acks: map[string]meterapi.CommandAck{}}
+	meter := testMeter(t, api)
+	ctx := context.Background()
+	start := time.Now().Truncate(time.Hour).Add(-3 * time.Hour)
+
+	// Offline for the next two readings, which are kept for later
+	meter.offlineUntil = start.Add(31 * time.Minute)
+	meter.tick(ctx, start.Add(15*time.Minute))
+	meter.tick(ctx, start.Add(30*time.Minute))
+	if len(api.readings) != 0 || len(meter.backlog) != 2 {
+		t.Fatalf("offline ticks uploaded %d, kept %d, want 0 and 2", len(api.readings), len(meter.backlog))
+	}
+
+	// A failing server keeps the backlog too
+	api.status = http.StatusServiceUnavailable
+	meter.tick(ctx, start.Add(45*time.Minute))
+	if len(meter.backlog) != 3 {
+		t.Fatalf("failed upload kept %d readings, want 3", len(meter.backlog))
+	}
+
+	api.status = 0
+	meter.tick(ctx, start.Add(time.Hour))
+	if len(api.readings) != 4 || len(meter.backlog) != 0 {
+		t.Fatalf("uploaded %d, kept %d, want 4 and 0", len(api.readings), len(meter.backlog))
+	}
+	for i := 1; i < len(api.readings); i++ {
+		if *api.readings[i].EnergyKWh < *api.readings[i-1].EnergyKWh || !api.readings[i].Timestamp.After(api.readings[i-1].Timestamp) {
+			t.Errorf("reading %d = %+v after %+v, want the register and clock moving forward", i, api.readings[i], api.readings[i-1])
+		}
+	}
+}
+
+func TestVirtualMeterCommands(t *testing.T) {
+	api := &fakeMeterAPI{acks: map[string]meterapi.CommandAck{}}
+	meter := testMeter(t, api)
+	meter.clockOffset = time.Minute
+	api.commands = []meterapi.PolledCommand{
+		{ID: "1", Type: database.CommandDisconnect},
+		{ID: "2", Type: database.CommandSyncClock},
+		{ID: "3", Type: database.CommandReadNow},
+		{ID: "4", Type: "reboot"},
+	}
+
+	meter.pollCommands(context.Background())
+	if !meter.disconnected {
+		t.Error("disconnect left the meter connected")
+	}
+	if meter.clockOffset > time.Second || meter.clockOffset < -time.Second {
+		t.Errorf("sync_clock left the clock %s off", meter.clockOffset)
+	}
+	if len(api.readings) != 1 || *api.readings[0].PowerKW != 0 {
+		t.Errorf("read_now uploaded %+v, want one reading without power", api.readings)
+	}
+	want := map[string]string{"1": "succeeded", "2": "succeeded", "3": "succeeded", "4": "failed"}
+	for id, status := range want {
+		if api.acks[id].Status != status {
+			t.Errorf("command %s acknowledged %+v, want %s", id, api.acks[id], status)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	valid := simConfig{Interval: 15 * time.Minute, CommandPoll: time.Minute, Jitter: 30 * time.Second, OutageRate: 0.01, OutageMax: time.Hour}
+	if err := validateConfig(valid, 10); err != nil {
+		t.Errorf("validateConfig() error = %v", err)
+	}
+	for name, change := range map[string]func(*simConfig){
+		"jitter over the interval": func(c *simConfig) { c.Jitter = time.Hour },
+		"outage rate over 1":       func(c *simConfig) { c.OutageRate = 2 },
+		"backfill past retention":  func(c *simConfig) { c.Backfill = database.RawReadingRetention },
+	} {
+		config := valid
+		change(&config)
+		if err := validateConfig(config, 10); err == nil {
+			t.Errorf("%s: validateConfig() error = nil", name)
+		}
+	}
+	if err := validateConfig(valid, 0); err == nil {
+		t.Error("validateConfig() of no meters error = nil")
+	}
+}
+
+// TestProvisionMetersLeavesRealMeters checks that a prefix matching meters
+// the simulator did not register does not reissue their device tokens
+func TestProvisionMetersLeavesRealMeters(t *testing.T) {
+	meters := &databasetest.MeterStore{Meters: []database.Meter{
+		{SerialNumber: "SIM-00001", Location: "Barangay Poblacion", DeviceTokenHash: "issued"},
+	}}
+	db := &databasetest.Service{MeterStore: meters}
+
+	_, err := provisionMeters(context.Background(), db, "SIM", 1, []string{classResidential}, placement{}, 1, zap.NewNop().Sugar())
+	if err == nil || meters.Meters[0].DeviceTokenHash != "issued" {
+		t.Errorf("provisionMeters() over a real meter error = %v, token hash = %q, want an error and the hash kept", err, meters.Meters[0].DeviceTokenHash)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * @file cmd/simulator/profile.go
+ * @brief profile.go file holds the daily load profiles the virtual meters draw power from
+ */
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consumer classes the simulator models
+const (
+	classResidential = "residential"
+	classCommercial  = "commercial"
+	classIndustrial  = "industrial"
+)
+
+// loadProfile is the daily shape of the demand of a class
+type loadProfile struct {
+	// hourly is the share of the peak demand drawn at the start of each hour
+	// of a weekday, interpolated in between
+	hourly [24]float64
+	// saturday and sunday scale the demand on those days
+	saturday, sunday float64
+	// peakKW bounds the peak demand a meter of the class is given
+	minPeakKW, maxPeakKW float64
+	// noise is the standard deviation of the demand, as a share of it
+	noise float64
+}
+
+var profiles = map[string]loadProfile{
+	// Households: a morning bump, a low midday, and the evening peak
+	classResidential: {
+		hourly: [24]float64{
+			0.30, 0.26, 0.24, 0.24, 0.26, 0.38, 0.62, 0.70, 0.55, 0.45, 0.42, 0.45,
+			0.50, 0.48, 0.45, 0.48, 0.58, 0.78, 0.95, 1.00, 0.92, 0.75, 0.55, 0.40,
+		},
+		saturday: 1.10, sunday: 1.15,
+		minPeakKW: 0.8, maxPeakKW: 3.5,
+		noise: 0.15,
+	},
+	// Shops and offices: open from morning to early evening
+	classCommercial: {
+		hourly: [24]float64{
+			0.20, 0.20, 0.20, 0.20, 0.20, 0.22, 0.30, 0.55, 0.85, 0.95, 1.00, 1.00,
+			0.95, 1.00, 1.00, 0.98, 0.92, 0.80, 0.60, 0.45, 0.35, 0.28, 0.24, 0.22,
+		},
+		saturday: 0.70, sunday: 0.40,
+		minPeakKW: 8, maxPeakKW: 40,
+		noise: 0.08,
+	},
+	// Plants running two shifts with a base load overnight
+	classIndustrial: {
+		hourly: [24]float64{
+			0.55, 0.55, 0.55, 0.55, 0.55, 0.60, 0.90, 1.00, 1.00, 1.00, 1.00, 0.95,
+			0.92, 1.00, 1.00, 1.00, 1.00, 0.98, 0.95, 0.95, 0.90, 0.85, 0.60, 0.55,
+		},
+		saturday: 0.85, sunday: 0.45,
+		minPeakKW: 60, maxPeakKW: 400,
+		noise: 0.05,
+	},
+}
+
+// demand is the share of the peak drawn at t, before noise
+func (p loadProfile) demand(t time.Time) float64 {
+	hour := t.Hour()
+	fraction := (float64(t.Minute()) + float64(t.Second())/60) / 60
+	share := p.hourly[hour] + (p.hourly[(hour+1)%24]-p.hourly[hour])*fraction
+	switch t.Weekday() {
+	case time.Saturday:
+		share *= p.saturday
+	case time.Sunday:
+		share *= p.sunday
+	}
+	return share
+}
+
+// power draws the demand in kW of a meter with the peak at t
+func (p loadProfile) power(t time.Time, peakKW float64, rng *rand.Rand) float64 {
+	return math.Max(peakKW*p.demand(t)*(1+rng.NormFloat64()*p.noise), 0)
+}
+
+// classMix is the share of the meters of each class
+type classMix map[string]float64
+
+// parseClassMix parses "residential=80,commercial=15,industrial=5"; the
+// weights need not add up to 100
+func parseClassMix(value string) (classMix, error) {
+	mix := classMix{}
+	for _, part := range strings.Split(value, ",") {
+		class, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("mix: %q is not class=weight", part)
+		}
+		if _, known := profiles[class]; !known {
+			return nil, fmt.Errorf("mix: unknown class %q", class)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("mix: weight of %s must be a positive number", class)
+		}
+		mix[class] += w
+	}
+	total := 0.0
+	for _, w := range mix {
+		total += w
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("mix: at least one class needs a weight")
+	}
+	return mix, nil
+}
+
+// classes assigns a class to each of n meters in proportion to the mix, in
+// a fixed order so meter i keeps its class between runs
+func (m classMix) classes(n int) []string {
+	names := make([]string, 0, len(m))
+	total := 0.0
+	for class, w := range m {
+		names = append(names, class)
+		total += w
+	}
+	sort.Strings(names)
+
+	classes := make([]string, n)
+	for i := range classes {
+		position := (float64(i) + 0.5) / float64(n) * total
+		for _, class := range names {
+			if position < m[class] {
+				classes[i] = class
+				break
+			}
+			position -= m[class]
+		}
+		if classes[i] == "" {
+			classes[i] = names[len(names)-1]
+		}
+	}
+	return classes
+}
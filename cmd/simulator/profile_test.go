@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func TestParseClassMix(t *testing.T) {
+	mix, err := parseClassMix("residential=3, industrial=1")
+	if err != nil {
+		t.Fatalf("parseClassMix() error = %v", err)
+	}
+	classes := mix.classes(8)
+	counts := map[string]int{}
+	for _, class := range classes {
+		counts[class]++
+	}
+	if counts[classResidential] != 6 || counts[classIndustrial] != 2 {
+		t.Errorf("classes(8) = %v, want 6 residential and 2 industrial", classes)
+	}
+
+	for _, value := range []string{"residential", "farm=1", "commercial=-1", "commercial=0"} {
+		if _, err := parseClassMix(value); err == nil {
+			t.Errorf("parseClassMix(%q) error = nil", value)
+		}
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	monday := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	residential := profiles[classResidential]
+	if evening, night := residential.demand(monday.Add(19*time.Hour)), residential.demand(monday.Add(3*time.Hour)); evening <= 2*night {
+		t.Errorf("residential demand at 19:00 = %.2f, at 03:00 = %.2f, want an evening peak", evening, night)
+	}
+	commercial := profiles[classCommercial]
+	if weekday, sunday := commercial.demand(monday.Add(11*time.Hour)), commercial.demand(monday.AddDate(0, 0, 6).Add(11*time.Hour)); sunday >= weekday {
+		t.Errorf("commercial demand on Sunday = %.2f, weekday = %.2f, want less on Sunday", sunday, weekday)
+	}
+	// Halfway between two hours the demand is halfway between theirs
+	if got, want := residential.demand(monday.Add(18*time.Hour+30*time.Minute)), (residential.hourly[18]+residential.hourly[19])/2; got-want > 1e-9 || want-got > 1e-9 {
+		t.Errorf("demand at 18:30 = %v, want %v", got, want)
+	}
+
+	rng := rand.New(rand.NewPCG(1, 1))
+	for _, class := range []string{classResidential, classCommercial, classIndustrial} {
+		for i := range 1000 {
+			if power := profiles[class].power(monday.Add(time.Duration(i)*time.Minute), 10, rng); power < 0 {
+				t.Fatalf("%s power = %v, want no negative demand", class, power)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * @file internal/alerting/engine.go
+ * @brief engine.go file holds the engine running the rules over each reading upload and raising the alerts
+ */
+package alerting
+
+import (
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/telemetry"
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Engine checks the readings a meter uploads against the rules, raising an
+// alert for each rule broken and pushing new alerts to the dashboards
+type Engine struct {
+	db        database.Service
+	telemetry *telemetry.Hub
+	logger    *zap.Logger
+	config    Config
+}
+
+func NewEngine(db database.Service, hub *telemetry.Hub, logger *zap.Logger, cfg Config) *Engine {
+	return &Engine{db: db, telemetry: hub, logger: logger, config: cfg}
+}
+
+// Check runs the rules over readings just stored for the meter
+func (e *Engine) Check(ctx context.Context, meter *database.Meter, readings []database.Reading) error {
+	if len(readings) == 0 {
+		return nil
+	}
+	input, err := e.input(ctx, meter, readings)
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, finding := range Evaluate(input, e.config) {
+		if err := e.raise(ctx, meter.SerialNumber, finding); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// raise records the finding, announcing the alert when it is a new one
+func (e *Engine) raise(ctx context.Context, serial string, finding Finding) error {
+	alert := &database.Alert{
+		SerialNumber: serial,
+		Rule:         finding.Rule,
+		Severity:     finding.Severity,
+		Message:      finding.Message,
+		RaisedAt:     finding.At,
+	}
+	created, err := e.db.Alerts().Raise(ctx, alert)
+	if err != nil || !created {
+		return err
+	}
+
+	e.telemetry.Publish(telemetry.Event{
+		Type:     telemetry.EventAlert,
+		Serial:   serial,
+		Severity: alert.Severity,
+		Message:  RuleLabels[alert.Rule] + ": " + alert.Message,
+		At:       alert.RaisedAt,
+	})
+	e.logger.Sugar().Warnf("Alert %s raised on meter %s: %s", alert.Rule, serial, alert.Message)
+	return nil
+}
+
+// input gathers the history the rules compare the upload with
+func (e *Engine) input(ctx context.Context, meter *database.Meter, readings []database.Reading) (Input, error) {
+	input := Input{Readings: make([]Sample, 0, len(readings))}
+	first, latest := readings[0].Timestamp, readings[0].Timestamp
+	for _, reading := range readings {
+		input.Readings = append(input.Readings, sample(reading))
+		if reading.Timestamp.Before(first) {
+			first = reading.Timestamp
+		}
+		if reading.Timestamp.After(latest) {
+			latest = reading.Timestamp
+		}
+	}
+
+	var err error
+	if input.Previous, err = e.lastBefore(ctx, meter.SerialNumber, first); err != nil {
+		return input, err
+	}
+	windowEnd := latest.Add(-e.config.ZeroConsumptionWindow).Add(time.Nanosecond)
+	if input.WindowStart, err = e.lastBefore(ctx, meter.SerialNumber, windowEnd); err != nil {
+		return input, err
+	}
+	if input.AccountActive, err = e.accountActive(ctx, meter); err != nil {
+		return input, err
+	}
+	if input.BaselineKWhPerHour, err = e.baseline(ctx, meter.SerialNumber, first); err != nil {
+		return input, err
+	}
+	return input, nil
+}
+
+// lastBefore returns the latest stored reading before the time, nil if none
+func (e *Engine) lastBefore(ctx context.Context, serial string, before time.Time) (*Sample, error) {
+	reading, err := e.db.Readings().Last(ctx, serial, before)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := sample(*reading)
+	return &s, nil
+}
+
+// accountActive reports whether the meter is in service on an active account
+// and supplying it
+func (e *Engine) accountActive(ctx context.Context, meter *database.Meter) (bool, error) {
+	if meter.Status != database.MeterStatusActive || meter.Disconnected || meter.ConsumerID.IsZero() {
+		return false, nil
+	}
+	consumer, err := e.db.Consumers().GetByID(ctx, meter.ConsumerID)
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return consumer.Status == database.ConsumerStatusActive, nil
+}
+
+// baseline averages the hourly consumption of the meter over the whole days
+// before the one of the time, zero without any
+func (e *Engine) baseline(ctx context.Context, serial string, before time.Time) (float64, error) {
+	to := database.PeriodStart(database.GranularityDay, before)
+	rollups, err := e.db.Rollups().List(ctx, database.RollupFilter{
+		SerialNumbers: []string{serial},
+		Granularity:   database.GranularityDay,
+		From:          database.AddPeriods(database.GranularityDay, to, -e.config.BaselineDays),
+		To:            to,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	days, total := 0, 0.0
+	for _, rollup := range rollups {
+		if rollup.Samples > 0 {
+			days++
+			total += rollup.EnergyKWh
+		}
+	}
+	if days == 0 {
+		return 0, nil
+	}
+	return total / float64(days) / 24, nil
+}
+
+func sample(reading database.Reading) Sample {
+	return Sample{
+		Timestamp:   reading.Timestamp,
+		EnergyKWh:   reading.EnergyKWh,
+		PowerKW:     reading.PowerKW,
+		Voltage:     reading.Voltage,
+		TamperFlags: reading.TamperFlags,
+	}
+}
@@ -0,0 +1,242 @@
+/*
+ * @file internal/alerting/rules.go
+ * @brief rules.go file holds the rules raising alerts from the readings of a meter
+ */
+package alerting
+
+import (
+	"SmartMeterSystem/internal/config"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rules
+const (
+	RuleZeroConsumption  = "zero_consumption"
+	RuleReverseFlow      = "reverse_flow"
+	RuleVoltageSag       = "voltage_sag"
+	RuleVoltageSwell     = "voltage_swell"
+	RuleConsumptionSpike = "consumption_spike"
+	RuleTamper           = "tamper"
+)
+
+// Severities, least severe first
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// RuleLabels names the rules for the dashboard
+var RuleLabels = map[string]string{
+	RuleZeroConsumption:  "Zero Consumption",
+	RuleReverseFlow:      "Reverse Energy Flow",
+	RuleVoltageSag:       "Voltage Sag",
+	RuleVoltageSwell:     "Voltage Swell",
+	RuleConsumptionSpike: "Consumption Spike",
+	RuleTamper:           "Tamper",
+}
+
+type Config struct {
+	NominalVoltage        float64       // volts at the service entrance
+	SagRatio              float64       // share of the nominal voltage below which a reading sags
+	SwellRatio            float64       // share of the nominal voltage above which a reading swells
+	ReverseFlowKW         float64       // power exported, as a positive figure, that counts as reverse flow
+	ZeroConsumptionWindow time.Duration // how long an active account may use nothing
+	SpikeFactor           float64       // multiple of the baseline hourly consumption that is a spike
+	SpikeMinKWhPerHour    float64       // hourly consumption below which nothing is a spike
+	BaselineDays          int           // days of daily rollups the baseline averages
+}
+
+// ConfigFromEnv reads the ALERT_* environment variables, falling back to
+// defaults for a 230 V residential service
+func ConfigFromEnv() Config {
+	return Config{
+		NominalVoltage:        config.Float("ALERT_NOMINAL_VOLTAGE", 230),
+		SagRatio:              config.Float("ALERT_SAG_RATIO", 0.9),
+		SwellRatio:            config.Float("ALERT_SWELL_RATIO", 1.1),
+		ReverseFlowKW:         config.Float("ALERT_REVERSE_FLOW_KW", 0.05),
+		ZeroConsumptionWindow: config.Duration("ALERT_ZERO_CONSUMPTION_WINDOW", 24*time.Hour),
+		SpikeFactor:           config.Float("ALERT_SPIKE_FACTOR", 3),
+		SpikeMinKWhPerHour:    config.Float("ALERT_SPIKE_MIN_KWH_PER_HOUR", 1),
+		BaselineDays:          config.Int("ALERT_BASELINE_DAYS", 14, 1),
+	}
+}
+
+// Sample is one reading as the rules see it
+type Sample struct {
+	Timestamp   time.Time
+	EnergyKWh   float64 // cumulative register
+	PowerKW     float64 // negative on reverse flow
+	Voltage     float64
+	TamperFlags []string
+}
+
+// Input is what the rules look at for one upload of a meter
+type Input struct {
+	Readings []Sample // the upload
+	Previous *Sample  // the reading stored before the upload, if any
+	// WindowStart is the latest reading from ZeroConsumptionWindow or more
+	// before the newest of the upload, nil without history that long
+	WindowStart        *Sample
+	AccountActive      bool    // the meter measures an active consumer account
+	BaselineKWhPerHour float64 // average hourly consumption, zero when unknown
+}
+
+// Finding is one rule broken by an upload
+type Finding struct {
+	Rule     string
+	Severity string
+	Message  string
+	At       time.Time // timestamp of the reading breaking the rule
+}
+
+// Evaluate runs every rule over the upload, returning at most one finding
+// per rule
+func Evaluate(input Input, cfg Config) []Finding {
+	if len(input.Readings) == 0 {
+		return nil
+	}
+	readings := append([]Sample(nil), input.Readings...)
+	sort.Slice(readings, func(i, j int) bool { return readings[i].Timestamp.Before(readings[j].Timestamp) })
+
+	findings := []Finding{}
+	for _, rule := range []func([]Sample, Input, Config) *Finding{
+		tamper, reverseFlow, voltageSag, voltageSwell, consumptionSpike, zeroConsumption,
+	} {
+		if finding := rule(readings, input, cfg); finding != nil {
+			findings = append(findings, *finding)
+		}
+	}
+	return findings
+}
+
+// tamper reports the first reading flagged by the meter
+func tamper(readings []Sample, _ Input, _ Config) *Finding {
+	for _, reading := range readings {
+		if len(reading.TamperFlags) > 0 {
+			return &Finding{
+				Rule:     RuleTamper,
+				Severity: SeverityCritical,
+				Message:  "Meter reported " + strings.Join(reading.TamperFlags, ", "),
+				At:       reading.Timestamp,
+			}
+		}
+	}
+	return nil
+}
+
+// reverseFlow reports power exported through the meter or a register
+// running backwards
+func reverseFlow(readings []Sample, input Input, cfg Config) *Finding {
+	previous := input.Previous
+	for i := range readings {
+		reading := &readings[i]
+		if -reading.PowerKW >= cfg.ReverseFlowKW {
+			return &Finding{
+				Rule:     RuleReverseFlow,
+				Severity: SeverityCritical,
+				Message:  fmt.Sprintf("Power flowing back at %.2f kW", -reading.PowerKW),
+				At:       reading.Timestamp,
+			}
+		}
+		if previous != nil && reading.EnergyKWh < previous.EnergyKWh {
+			return &Finding{
+				Rule:     RuleReverseFlow,
+				Severity: SeverityCritical,
+				Message:  fmt.Sprintf("Energy register fell from %.2f to %.2f kWh", previous.EnergyKWh, reading.EnergyKWh),
+				At:       reading.Timestamp,
+			}
+		}
+		previous = reading
+	}
+	return nil
+}
+
+// voltageSag reports the lowest voltage under the sag threshold
+func voltageSag(readings []Sample, _ Input, cfg Config) *Finding {
+	limit := cfg.NominalVoltage * cfg.SagRatio
+	var worst *Sample
+	for i := range readings {
+		if readings[i].Voltage < limit && (worst == nil || readings[i].Voltage < worst.Voltage) {
+			worst = &readings[i]
+		}
+	}
+	if worst == nil {
+		return nil
+	}
+	return &Finding{
+		Rule:     RuleVoltageSag,
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf("Voltage sagged to %.1f V, below %.1f V", worst.Voltage, limit),
+		At:       worst.Timestamp,
+	}
+}
+
+// voltageSwell reports the highest voltage over the swell threshold
+func voltageSwell(readings []Sample, _ Input, cfg Config) *Finding {
+	limit := cfg.NominalVoltage * cfg.SwellRatio
+	var worst *Sample
+	for i := range readings {
+		if readings[i].Voltage > limit && (worst == nil || readings[i].Voltage > worst.Voltage) {
+			worst = &readings[i]
+		}
+	}
+	if worst == nil {
+		return nil
+	}
+	return &Finding{
+		Rule:     RuleVoltageSwell,
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf("Voltage swelled to %.1f V, above %.1f V", worst.Voltage, limit),
+		At:       worst.Timestamp,
+	}
+}
+
+// consumptionSpike reports an interval used at several times the baseline
+// hourly rate of the consumer
+func consumptionSpike(readings []Sample, input Input, cfg Config) *Finding {
+	if input.BaselineKWhPerHour <= 0 {
+		return nil
+	}
+	limit := max(input.BaselineKWhPerHour*cfg.SpikeFactor, cfg.SpikeMinKWhPerHour)
+	previous := input.Previous
+	for i := range readings {
+		reading := &readings[i]
+		if previous != nil {
+			hours := reading.Timestamp.Sub(previous.Timestamp).Hours()
+			used := reading.EnergyKWh - previous.EnergyKWh
+			if hours > 0 && used/hours > limit {
+				return &Finding{
+					Rule:     RuleConsumptionSpike,
+					Severity: SeverityWarning,
+					Message: fmt.Sprintf("Used %.2f kWh/h against a baseline of %.2f kWh/h",
+						used/hours, input.BaselineKWhPerHour),
+					At: reading.Timestamp,
+				}
+			}
+		}
+		previous = reading
+	}
+	return nil
+}
+
+// zeroConsumption reports an active account whose register has not moved
+// over the whole window
+func zeroConsumption(readings []Sample, input Input, cfg Config) *Finding {
+	if !input.AccountActive || input.WindowStart == nil {
+		return nil
+	}
+	latest := readings[len(readings)-1]
+	if latest.EnergyKWh != input.WindowStart.EnergyKWh {
+		return nil
+	}
+	return &Finding{
+		Rule:     RuleZeroConsumption,
+		Severity: SeverityWarning,
+		Message: fmt.Sprintf("No consumption in %.0f hours on an active account",
+			latest.Timestamp.Sub(input.WindowStart.Timestamp).Hours()),
+		At: latest.Timestamp,
+	}
+}
@@ -0,0 +1,110 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		NominalVoltage:        230,
+		SagRatio:              0.9,
+		SwellRatio:            1.1,
+		ReverseFlowKW:         0.05,
+		ZeroConsumptionWindow: 24 * time.Hour,
+		SpikeFactor:           3,
+		SpikeMinKWhPerHour:    1,
+		BaselineDays:          14,
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2025, 3, 8, 12, 0, 0, 0, time.UTC)
+	normal := func(minutes int, energy float64) Sample {
+		return Sample{Timestamp: now.Add(time.Duration(minutes) * time.Minute), EnergyKWh: energy, PowerKW: 0.8, Voltage: 230}
+	}
+	with := func(s Sample, change func(*Sample)) Sample {
+		change(&s)
+		return s
+	}
+	previous := normal(-15, 100)
+	dayAgo := Sample{Timestamp: now.Add(-25 * time.Hour), EnergyKWh: 100, Voltage: 230}
+
+	tests := []struct {
+		name  string
+		input Input
+		want  []string
+	}{
+		{
+			name:  "normal readings",
+			input: Input{Readings: []Sample{normal(0, 100.2), normal(15, 100.4)}, Previous: &previous, AccountActive: true, BaselineKWhPerHour: 0.8},
+			want:  nil,
+		},
+		{
+			name:  "tamper flag",
+			input: Input{Readings: []Sample{with(normal(0, 100.2), func(s *Sample) { s.TamperFlags = []string{"cover_open"} })}},
+			want:  []string{RuleTamper},
+		},
+		{
+			name:  "power exported",
+			input: Input{Readings: []Sample{with(normal(0, 100.2), func(s *Sample) { s.PowerKW = -1.5 })}},
+			want:  []string{RuleReverseFlow},
+		},
+		{
+			name:  "register running backwards",
+			input: Input{Readings: []Sample{normal(0, 99.5)}, Previous: &previous},
+			want:  []string{RuleReverseFlow},
+		},
+		{
+			name: "sag and swell",
+			input: Input{Readings: []Sample{
+				with(normal(0, 100.2), func(s *Sample) { s.Voltage = 190 }),
+				with(normal(15, 100.4), func(s *Sample) { s.Voltage = 260 }),
+			}},
+			want: []string{RuleVoltageSag, RuleVoltageSwell},
+		},
+		{
+			name:  "spike over the baseline",
+			input: Input{Readings: []Sample{normal(0, 101.5)}, Previous: &previous, BaselineKWhPerHour: 0.8},
+			want:  []string{RuleConsumptionSpike},
+		},
+		{
+			name:  "spike under the minimum",
+			input: Input{Readings: []Sample{normal(0, 100.2)}, Previous: &previous, BaselineKWhPerHour: 0.1},
+			want:  nil,
+		},
+		{
+			name:  "no consumption for a day",
+			input: Input{Readings: []Sample{normal(0, 100)}, WindowStart: &dayAgo, AccountActive: true},
+			want:  []string{RuleZeroConsumption},
+		},
+		{
+			name:  "no consumption on an inactive account",
+			input: Input{Readings: []Sample{normal(0, 100)}, WindowStart: &dayAgo},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		findings := Evaluate(tt.input, testConfig())
+		if len(findings) != len(tt.want) {
+			t.Errorf("%s: Evaluate() = %+v, want %v", tt.name, findings, tt.want)
+			continue
+		}
+		for i, finding := range findings {
+			if finding.Rule != tt.want[i] {
+				t.Errorf("%s: Evaluate()[%d].Rule = %s, want %s", tt.name, i, finding.Rule, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestEvaluateReportsTheWorstSag(t *testing.T) {
+	now := time.Date(2025, 3, 8, 12, 0, 0, 0, time.UTC)
+	findings := Evaluate(Input{Readings: []Sample{
+		{Timestamp: now.Add(15 * time.Minute), Voltage: 180},
+		{Timestamp: now, Voltage: 200},
+	}}, testConfig())
+	if len(findings) != 1 || !findings[0].At.Equal(now.Add(15*time.Minute)) {
+		t.Errorf("Evaluate() = %+v, want the 180 V sag", findings)
+	}
+}
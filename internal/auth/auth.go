@@ -0,0 +1,82 @@
+/*
+ * @file internal/auth/auth.go
+ * @brief auth.go file contains the credential based authenticator
+ */
+package auth
+
+import (
+	"SmartMeterSystem/internal/database"
+	"context"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned for an unknown email, a wrong password or
+// an account that does not belong to the login page it was submitted from.
+// The three cases are deliberately indistinguishable to the caller.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// dummyHash is compared against when the email is unknown so that a failed
+// lookup takes as long as a failed password check
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("smartmeter-dummy-password"), bcrypt.DefaultCost)
+
+type Authenticator struct {
+	users database.UserStore
+}
+
+func NewAuthenticator(users database.UserStore) *Authenticator {
+	return &Authenticator{users: users}
+}
+
+// Authenticate verifies the email and password of an account of the given
+// client type ("employee" or "consumer")
+func (a *Authenticator) Authenticate(ctx context.Context, clientType, email, password string) (*database.User, error) {
+	if strings.TrimSpace(email) == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	user, err := a.users.FindByEmail(ctx, email)
+	if errors.Is(err, database.ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !CheckPassword(user.PasswordHash, password) || user.ClientType != clientType {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// CreateUser stores a new account with the given password. It returns
+// database.ErrDuplicate when the email is already taken.
+func (a *Authenticator) CreateUser(ctx context.Context, user *database.User, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	return a.users.Create(ctx, user)
+}
+
+// EnsureUser creates the account if no account with the same email exists.
+// It is used to bootstrap the first system administrator.
+func (a *Authenticator) EnsureUser(ctx context.Context, user *database.User, password string) error {
+	_, err := a.users.FindByEmail(ctx, user.Email)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+
+	if err := a.CreateUser(ctx, user, password); err != nil && !errors.Is(err, database.ErrDuplicate) {
+		return err
+	}
+	return nil
+}
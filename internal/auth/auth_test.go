@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"SmartMeterSystem/internal/database"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeUserStore struct {
+	users map[string]*database.User
+}
+
+func (f *fakeUserStore) Create(_ context.Context, user *database.User) error {
+	email := database.NormalizeEmail(user.Email)
+	if _, ok := f.users[email]; ok {
+		return database.ErrDuplicate
+	}
+	user.ID = primitive.NewObjectID()
+	user.Email = email
+	f.users[email] = user
+	return nil
+}
+
+func (f *fakeUserStore) FindByEmail(_ context.Context, email string) (*database.User, error) {
+	user, ok := f.users[database.NormalizeEmail(email)]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return user, nil
+}
+
+func (f *fakeUserStore) FindByID(_ context.Context, id primitive.ObjectID) (*database.User, error) {
+	for _, user := range f.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	a := NewAuthenticator(&fakeUserStore{users: map[string]*database.User{}})
+	err := a.EnsureUser(context.Background(), &database.User{
+		Email:      "Admin@Example.com",
+		ClientType: "employee",
+		Role:       "system_admin",
+	}, "correct-horse")
+	if err != nil {
+		t.Fatalf("EnsureUser() error = %v", err)
+	}
+	return a
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := newTestAuthenticator(t)
+
+	tests := []struct {
+		name       string
+		clientType string
+		email      string
+		password   string
+		wantErr    error
+	}{
+		{"valid credentials", "employee", "admin@example.com", "correct-horse", nil},
+		{"email is case-insensitive", "employee", " ADMIN@example.com ", "correct-horse", nil},
+		{"wrong password", "employee", "admin@example.com", "wrong-horse", ErrInvalidCredentials},
+		{"unknown email", "employee", "nobody@example.com", "correct-horse", ErrInvalidCredentials},
+		{"wrong login page", "consumer", "admin@example.com", "correct-horse", ErrInvalidCredentials},
+		{"empty password", "employee", "admin@example.com", "", ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := a.Authenticate(context.Background(), tt.clientType, tt.email, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && user.Role != "system_admin" {
+				t.Errorf("Authenticate() role = %q, want system_admin", user.Role)
+			}
+		})
+	}
+}
+
+func TestEnsureUserKeepsExistingPassword(t *testing.T) {
+	a := newTestAuthenticator(t)
+
+	err := a.EnsureUser(context.Background(), &database.User{Email: "admin@example.com", ClientType: "employee"}, "another-password")
+	if err != nil {
+		t.Fatalf("EnsureUser() error = %v", err)
+	}
+	if _, err := a.Authenticate(context.Background(), "employee", "admin@example.com", "correct-horse"); err != nil {
+		t.Errorf("existing password no longer valid: %v", err)
+	}
+}
+
+func TestHashPasswordTooShort(t *testing.T) {
+	if _, err := HashPassword("short"); !errors.Is(err, ErrPasswordTooShort) {
+		t.Errorf("HashPassword() error = %v, want %v", err, ErrPasswordTooShort)
+	}
+}
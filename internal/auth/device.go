@@ -0,0 +1,38 @@
+/*
+ * @file internal/auth/device.go
+ * @brief device.go file contains the device tokens smart meters authenticate with
+ */
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// NewDeviceToken returns a random token for a smart meter and the hash to
+// store with the meter. Only the hash is persisted; the token is shown once.
+func NewDeviceToken() (token, hash string, err error) {
+	token, err = newToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, hashToken(token), nil
+}
+
+// CheckDeviceToken reports whether the token matches the stored hash
+func CheckDeviceToken(hash, token string) bool {
+	if hash == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashToken(token))) == 1
+}
+
+// BearerToken returns the token of an "Authorization: Bearer <token>" header
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeviceToken(t *testing.T) {
+	token, hash, err := NewDeviceToken()
+	if err != nil {
+		t.Fatalf("NewDeviceToken() error = %v", err)
+	}
+	if !CheckDeviceToken(hash, token) {
+		t.Error("CheckDeviceToken() rejected the issued token")
+	}
+	if CheckDeviceToken(hash, token+"x") || CheckDeviceToken("", "") {
+		t.Error("CheckDeviceToken() accepted a wrong token")
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := map[string]string{
+		"Bearer abc":  "abc",
+		"bearer  abc": "abc",
+		"Basic abc":   "",
+		"":            "",
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("Authorization", header)
+		if got := BearerToken(r); got != want {
+			t.Errorf("BearerToken(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ * @file internal/auth/session.go
+ * @brief session.go file contains the cookie based session manager
+ */
+package auth
+
+import (
+	"SmartMeterSystem/internal/config"
+	"SmartMeterSystem/internal/database"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const SessionCookieName = "smartmeter_session"
+
+// touchInterval limits how often the last-seen time is written back
+const touchInterval = time.Minute
+
+var ErrNoSession = errors.New("no valid session")
+
+type SessionConfig struct {
+	IdleTimeout         time.Duration // idle timeout of a normal session
+	Lifetime            time.Duration // absolute lifetime of a normal session
+	RememberIdleTimeout time.Duration // idle timeout when "Remember me" is checked
+	RememberLifetime    time.Duration // absolute lifetime when "Remember me" is checked
+	SecureCookie        bool
+}
+
+// SessionConfigFromEnv reads the SESSION_* environment variables, falling back
+// to defaults for anything unset or malformed
+func SessionConfigFromEnv() SessionConfig {
+	secure, _ := strconv.ParseBool(os.Getenv("SESSION_COOKIE_SECURE"))
+	return SessionConfig{
+		IdleTimeout:         config.Duration("SESSION_IDLE_TIMEOUT", 30*time.Minute),
+		Lifetime:            config.Duration("SESSION_LIFETIME", 12*time.Hour),
+		RememberIdleTimeout: config.Duration("SESSION_REMEMBER_IDLE_TIMEOUT", 7*24*time.Hour),
+		RememberLifetime:    config.Duration("SESSION_REMEMBER_LIFETIME", 30*24*time.Hour),
+		SecureCookie:        secure,
+	}
+}
+
+type SessionManager struct {
+	store  database.SessionStore
+	config SessionConfig
+	now    func() time.Time
+}
+
+func NewSessionManager(store database.SessionStore, config SessionConfig) *SessionManager {
+	return &SessionManager{store: store, config: config, now: time.Now}
+}
+
+// Start creates a session for the user and sets the session cookie. Any
+// session the request already carried is destroyed first.
+func (m *SessionManager) Start(w http.ResponseWriter, r *http.Request, user *database.User, remember bool) (*database.Session, error) {
+	if err := m.Destroy(w, r); err != nil {
+		return nil, err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now().UTC()
+	idle, lifetime := m.config.IdleTimeout, m.config.Lifetime
+	if remember {
+		idle, lifetime = m.config.RememberIdleTimeout, m.config.RememberLifetime
+	}
+
+	session := &database.Session{
+		ID:          hashToken(token),
+		UserID:      user.ID,
+		ClientType:  user.ClientType,
+		Role:        user.Role,
+		Remember:    remember,
+		IdleTimeout: idle,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(lifetime),
+	}
+	if err := m.store.Create(r.Context(), session); err != nil {
+		return nil, err
+	}
+
+	cookie := m.cookie(token)
+	if remember {
+		// Only remembered sessions survive a browser restart
+		cookie.Expires = session.ExpiresAt
+	}
+	http.SetCookie(w, cookie)
+
+	return session, nil
+}
+
+// Load returns the session referenced by the request cookie, enforcing the
+// idle and absolute expiry. Expired sessions are deleted.
+func (m *SessionManager) Load(r *http.Request) (*database.Session, error) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, ErrNoSession
+	}
+
+	session, err := m.store.Get(r.Context(), hashToken(cookie.Value))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now().UTC()
+	if session.Expired(now) {
+		m.store.Delete(r.Context(), session.ID)
+		return nil, ErrNoSession
+	}
+
+	if now.Sub(session.LastSeenAt) >= touchInterval {
+		if err := m.store.Touch(r.Context(), session.ID, now); err != nil {
+			return nil, err
+		}
+		session.LastSeenAt = now
+	}
+
+	return session, nil
+}
+
+// Destroy deletes the session referenced by the request cookie, if any, and
+// clears the cookie
+func (m *SessionManager) Destroy(w http.ResponseWriter, r *http.Request) error {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+
+	if err := m.store.Delete(r.Context(), hashToken(cookie.Value)); err != nil {
+		return err
+	}
+
+	expired := m.cookie("")
+	expired.MaxAge = -1
+	http.SetCookie(w, expired)
+	return nil
+}
+
+func (m *SessionManager) cookie(value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   m.config.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type sessionContextKey struct{}
+
+// WithSession returns a copy of ctx carrying the session
+func WithSession(ctx context.Context, session *database.Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, session)
+}
+
+// SessionFromContext returns the session stored by WithSession, or nil
+func SessionFromContext(ctx context.Context) *database.Session {
+	session, _ := ctx.Value(sessionContextKey{}).(*database.Session)
+	return session
+}
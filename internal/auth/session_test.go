@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"SmartMeterSystem/internal/database"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testSessionConfig = SessionConfig{
+	IdleTimeout:         30 * time.Minute,
+	Lifetime:            12 * time.Hour,
+	RememberIdleTimeout: 7 * 24 * time.Hour,
+	RememberLifetime:    30 * 24 * time.Hour,
+}
+
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func newTestSessionManager() (*SessionManager, *testClock) {
+	clock := &testClock{now: time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)}
+	m := NewSessionManager(database.NewMemorySessionStore(), testSessionConfig)
+	m.now = clock.Now
+	return m, clock
+}
+
+// startSession logs a user in and returns a request carrying the session cookie
+func startSession(t *testing.T, m *SessionManager, remember bool) *http.Request {
+	t.Helper()
+	user := &database.User{ID: primitive.NewObjectID(), ClientType: "employee", Role: "cashier"}
+
+	rec := httptest.NewRecorder()
+	if _, err := m.Start(rec, httptest.NewRequest("POST", "/login", nil), user, remember); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Start() set %d cookies, want 1", len(cookies))
+	}
+	if !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Errorf("session cookie is not HttpOnly/SameSite: %+v", cookies[0])
+	}
+	if remember == cookies[0].Expires.IsZero() {
+		t.Errorf("remember=%v but cookie expiry = %v", remember, cookies[0].Expires)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	return r
+}
+
+func TestSessionLoad(t *testing.T) {
+	m, _ := newTestSessionManager()
+	r := startSession(t, m, false)
+
+	session, err := m.Load(r)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if session.Role != "cashier" {
+		t.Errorf("Load() role = %q, want cashier", session.Role)
+	}
+
+	if _, err := m.Load(httptest.NewRequest("GET", "/", nil)); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() without cookie error = %v, want %v", err, ErrNoSession)
+	}
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	m, clock := newTestSessionManager()
+	r := startSession(t, m, false)
+
+	// Activity keeps the session alive past the idle timeout
+	for range 4 {
+		clock.now = clock.now.Add(20 * time.Minute)
+		if _, err := m.Load(r); err != nil {
+			t.Fatalf("Load() after activity error = %v", err)
+		}
+	}
+
+	clock.now = clock.now.Add(31 * time.Minute)
+	if _, err := m.Load(r); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() after idle timeout error = %v, want %v", err, ErrNoSession)
+	}
+}
+
+func TestSessionAbsoluteLifetime(t *testing.T) {
+	tests := []struct {
+		name     string
+		remember bool
+		alive    time.Duration
+		dead     time.Duration
+	}{
+		{"normal", false, 11 * time.Hour, 13 * time.Hour},
+		{"remember me", true, 29 * 24 * time.Hour, 31 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, clock := newTestSessionManager()
+			r := startSession(t, m, tt.remember)
+			start := clock.now
+
+			// Stay active so only the absolute lifetime can expire the session
+			for clock.now.Sub(start) < tt.alive {
+				clock.now = clock.now.Add(10 * time.Minute)
+				if _, err := m.Load(r); err != nil {
+					t.Fatalf("Load() at %v error = %v", clock.now.Sub(start), err)
+				}
+			}
+
+			clock.now = start.Add(tt.dead)
+			if _, err := m.Load(r); !errors.Is(err, ErrNoSession) {
+				t.Errorf("Load() after lifetime error = %v, want %v", err, ErrNoSession)
+			}
+		})
+	}
+}
+
+func TestSessionDestroy(t *testing.T) {
+	m, _ := newTestSessionManager()
+	r := startSession(t, m, false)
+
+	rec := httptest.NewRecorder()
+	if err := m.Destroy(rec, r); err != nil {
+		t.Fatalf("Destroy() error = %v", err)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Destroy() did not clear the cookie: %+v", cookies)
+	}
+
+	if _, err := m.Load(r); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load() after Destroy() error = %v, want %v", err, ErrNoSession)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * @file internal/billing/bill.go
+ * @brief bill.go file contains the billing engine computing itemised bills
+ */
+package billing
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// centavos is the precision charges are rounded to
+const centavos = 2
+
+// Usage is what a consumer used over one billing period
+type Usage struct {
+	EnergyKWh decimal.Decimal `bson:"energy_kwh"`
+	DemandKW  decimal.Decimal `bson:"demand_kw"` // peak demand
+}
+
+// LineItem is the charge of one rate. Amount is Rate times Quantity rounded
+// to centavos.
+type LineItem struct {
+	Group       string          `bson:"group"`
+	Particulars string          `bson:"particulars"`
+	Unit        Unit            `bson:"unit"`
+	Rate        decimal.Decimal `bson:"rate"`
+	Quantity    decimal.Decimal `bson:"quantity"`
+	Amount      decimal.Decimal `bson:"amount"`
+}
+
+// GroupTotal is the sum of the line items under one rate group
+type GroupTotal struct {
+	Particulars string          `bson:"particulars"`
+	Amount      decimal.Decimal `bson:"amount"`
+}
+
+// Bill is the itemised bill of one billing period. Total is the sum of the
+// rounded line items, so the printed items always add up to it.
+type Bill struct {
+	Class     string
+	Usage     Usage
+	Items     []LineItem
+	Subtotals []GroupTotal
+	Total     decimal.Decimal
+}
+
+// Compute charges the usage against the rate table. Every rate is applied
+// once: per kWh of energy, per kW of demand or once per customer month.
+func Compute(table RateTable, usage Usage) (Bill, error) {
+	if usage.EnergyKWh.IsNegative() || usage.DemandKW.IsNegative() {
+		return Bill{}, fmt.Errorf("usage cannot be negative")
+	}
+
+	bill := Bill{Class: table.Class, Usage: usage, Items: []LineItem{}, Subtotals: []GroupTotal{}}
+	for _, group := range table.Groups {
+		subtotal := GroupTotal{Particulars: group.Particulars}
+		for _, rate := range group.Rates {
+			quantity, err := quantityOf(rate.Unit, usage)
+			if err != nil {
+				return Bill{}, fmt.Errorf("%s / %s: %w", group.Particulars, rate.Particulars, err)
+			}
+			item := LineItem{
+				Group:       group.Particulars,
+				Particulars: rate.Particulars,
+				Unit:        rate.Unit,
+				Rate:        rate.Amount,
+				Quantity:    quantity,
+				Amount:      rate.Amount.Mul(quantity).Round(centavos),
+			}
+			bill.Items = append(bill.Items, item)
+			subtotal.Amount = subtotal.Amount.Add(item.Amount)
+		}
+		bill.Subtotals = append(bill.Subtotals, subtotal)
+		bill.Total = bill.Total.Add(subtotal.Amount)
+	}
+	return bill, nil
+}
+
+// quantityOf returns how many units of the rate the usage amounts to
+func quantityOf(unit Unit, usage Usage) (decimal.Decimal, error) {
+	switch unit {
+	case UnitPerKWh:
+		return usage.EnergyKWh, nil
+	case UnitPerKW:
+		return usage.DemandKW, nil
+	case UnitPerCustomerMonth:
+		return decimal.NewFromInt(1), nil
+	default:
+		return decimal.Decimal{}, fmt.Errorf("unknown rate unit %q", unit)
+	}
+}
@@ -0,0 +1,80 @@
+package billing
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func residentialTable() RateTable {
+	rate := func(particulars string, unit Unit, amount string) Rate {
+		return Rate{Particulars: particulars, Unit: unit, Amount: decimal.RequireFromString(amount)}
+	}
+	return RateTable{
+		Class: "RESIDENTIAL",
+		Groups: []RateGroup{
+			{Particulars: "Generation Charges", Rates: []Rate{
+				rate("Generation Energy Charge", UnitPerKWh, "5.6092"),
+			}},
+			{Particulars: "Transmission Charges (NCCP)", Rates: []Rate{
+				rate("Transmission Demand Charge", UnitPerKW, "10.2500"),
+				rate("Transmission System Charge", UnitPerKWh, "0.6853"),
+			}},
+			{Particulars: "Supply Charges", Rates: []Rate{
+				rate("Supply Retail Customer Charge", UnitPerCustomerMonth, "5.0000"),
+			}},
+		},
+	}
+}
+
+func TestCompute(t *testing.T) {
+	usage := Usage{EnergyKWh: decimal.RequireFromString("123.45"), DemandKW: decimal.RequireFromString("2.5")}
+	bill, err := Compute(residentialTable(), usage)
+	if err != nil {
+		t.Fatalf("Compute() error = %v", err)
+	}
+
+	// 5.6092 * 123.45 = 692.45574, 10.25 * 2.5 = 25.625, 0.6853 * 123.45 = 84.600285
+	want := []string{"692.46", "25.63", "84.60", "5.00"}
+	if len(bill.Items) != len(want) {
+		t.Fatalf("Compute() items = %+v", bill.Items)
+	}
+	for i, amount := range want {
+		if got := bill.Items[i].Amount.StringFixed(2); got != amount {
+			t.Errorf("item %d (%s) = %s, want %s", i, bill.Items[i].Particulars, got, amount)
+		}
+	}
+	if got := bill.Subtotals[1].Amount.StringFixed(2); got != "110.23" {
+		t.Errorf("transmission subtotal = %s, want 110.23", got)
+	}
+	if got := bill.Total.StringFixed(2); got != "807.69" {
+		t.Errorf("total = %s, want 807.69", got)
+	}
+}
+
+func TestComputeRejects(t *testing.T) {
+	if _, err := Compute(residentialTable(), Usage{EnergyKWh: decimal.NewFromInt(-1)}); err == nil {
+		t.Error("Compute() accepted negative usage")
+	}
+
+	table := residentialTable()
+	table.Groups[0].Rates[0].Unit = "PhP/day"
+	if _, err := Compute(table, Usage{}); err == nil {
+		t.Error("Compute() accepted an unknown unit")
+	}
+}
+
+func TestParse(t *testing.T) {
+	if unit, err := ParseUnit(" PhP/Cust/Mo "); err != nil || unit != UnitPerCustomerMonth {
+		t.Errorf("ParseUnit() = %q, %v", unit, err)
+	}
+	if _, err := ParseUnit("kWh"); err == nil {
+		t.Error("ParseUnit() accepted an unknown unit")
+	}
+	if rate, err := ParseRate("0.1822"); err != nil || rate.String() != "0.1822" {
+		t.Errorf("ParseRate() = %s, %v", rate, err)
+	}
+	if _, err := ParseRate("1,000"); err == nil {
+		t.Error("ParseRate() accepted a malformed rate")
+	}
+}
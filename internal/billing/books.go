@@ -0,0 +1,76 @@
+/*
+ * @file internal/billing/books.go
+ * @brief books.go file holds the meter reading routes consumers are billed by
+ */
+package billing
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Book is a meter reading route. Its consumers are read, and their billing
+// cycle closed, on the same day of every month.
+type Book struct {
+	Code    string
+	ReadDay int // 1 to 28, so every month has it
+}
+
+// Books are the reading routes, read from BILLING_BOOKS as comma separated
+// code:day pairs, e.g. "B01:5,B02:15". The first one is the default book of
+// consumers not assigned to any.
+var Books = booksFromEnv("BILLING_BOOKS", "B01:1")
+
+func booksFromEnv(key, fallback string) []Book {
+	books, err := ParseBooks(os.Getenv(key))
+	if err != nil || len(books) == 0 {
+		books, _ = ParseBooks(fallback)
+	}
+	return books
+}
+
+// ParseBooks reads a list of code:day pairs
+func ParseBooks(value string) ([]Book, error) {
+	books := []Book{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		code, day, ok := strings.Cut(pair, ":")
+		code = strings.TrimSpace(code)
+		readDay, err := strconv.Atoi(strings.TrimSpace(day))
+		if !ok || code == "" || err != nil || readDay < 1 || readDay > 28 {
+			return nil, fmt.Errorf("invalid book %q, want code:day with a day from 1 to 28", pair)
+		}
+		for _, book := range books {
+			if book.Code == code {
+				return nil, fmt.Errorf("book %s is listed twice", code)
+			}
+		}
+		books = append(books, Book{Code: code, ReadDay: readDay})
+	}
+	return books, nil
+}
+
+// BookCodes lists the codes of Books in order
+func BookCodes() []string {
+	codes := make([]string, 0, len(Books))
+	for _, book := range Books {
+		codes = append(codes, book.Code)
+	}
+	return codes
+}
+
+// ReadDate returns the latest read date of the book at or before now, at
+// midnight in loc. The billing period it closes started a month earlier.
+func (b Book) ReadDate(now time.Time, loc *time.Location) time.Time {
+	now = now.In(loc)
+	date := time.Date(now.Year(), now.Month(), b.ReadDay, 0, 0, 0, 0, loc)
+	if date.After(now) {
+		date = date.AddDate(0, -1, 0)
+	}
+	return date
+}
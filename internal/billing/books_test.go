@@ -0,0 +1,36 @@
+package billing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBooks(t *testing.T) {
+	books, err := ParseBooks(" B01:5, B02:15 ,")
+	if err != nil || len(books) != 2 || books[1] != (Book{Code: "B02", ReadDay: 15}) {
+		t.Errorf("ParseBooks() = %+v, %v", books, err)
+	}
+	for _, value := range []string{"B01", "B01:0", "B01:29", ":5", "B01:5,B01:6"} {
+		if _, err := ParseBooks(value); err == nil {
+			t.Errorf("ParseBooks(%q) accepted an invalid list", value)
+		}
+	}
+}
+
+func TestBookReadDate(t *testing.T) {
+	loc := time.FixedZone("PHT", 8*60*60)
+	book := Book{Code: "B01", ReadDay: 15}
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2025, 3, 20, 9, 0, 0, 0, loc), time.Date(2025, 3, 15, 0, 0, 0, 0, loc)},
+		{time.Date(2025, 3, 15, 0, 0, 0, 0, loc), time.Date(2025, 3, 15, 0, 0, 0, 0, loc)},
+		{time.Date(2025, 1, 10, 9, 0, 0, 0, loc), time.Date(2024, 12, 15, 0, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := book.ReadDate(tt.now, loc); !got.Equal(tt.want) {
+			t.Errorf("ReadDate(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
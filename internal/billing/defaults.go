@@ -0,0 +1,50 @@
+/*
+ * @file internal/billing/defaults.go
+ * @brief defaults.go file contains the rate components the system ships with
+ */
+package billing
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultEffectiveDate is when the default rates are in force from
+var DefaultEffectiveDate = time.Date(2025, 1, 1, 0, 0, 0, 0, time.FixedZone("PHT", 8*60*60))
+
+// DefaultGroups returns the BATELEC I residential rate components, used to
+// seed the first schedules and as the layout of classes without a schedule
+func DefaultGroups() []RateGroup {
+	rate := func(particulars string, unit Unit, amount string) Rate {
+		return Rate{Particulars: particulars, Unit: unit, Amount: decimal.RequireFromString(amount)}
+	}
+	return []RateGroup{
+		{Particulars: "Generation Charges", Rates: []Rate{
+			rate("Generation Energy Charge", UnitPerKWh, "5.6092"),
+			rate("Other Generation Rate Adjustment", UnitPerKWh, "0.0000"),
+		}},
+		{Particulars: "Transmission Charges (NCCP)", Rates: []Rate{
+			rate("Transmission Demand Charge", UnitPerKW, "0.0000"),
+			rate("Transmission System Charge", UnitPerKWh, "0.6853"),
+		}},
+		{Particulars: "System Loss Charge", Rates: []Rate{
+			rate("System Loss Charge", UnitPerKWh, "0.9344"),
+		}},
+		{Particulars: "Distribution Charges", Rates: []Rate{
+			rate("Distribution Demand Charge", UnitPerKW, "0.0000"),
+			rate("Distribution System Charge", UnitPerKWh, "0.4613"),
+		}},
+		{Particulars: "Supply Charges", Rates: []Rate{
+			rate("Supply Retail Customer Charge", UnitPerCustomerMonth, "0.0000"),
+			rate("Supply System Charge", UnitPerKWh, "0.5376"),
+		}},
+		{Particulars: "VAT", Rates: []Rate{
+			rate("Generation", UnitPerKWh, "0.6376"),
+			rate("Transmission", UnitPerKWh, "0.1096"),
+		}},
+		{Particulars: "Universal Charge", Rates: []Rate{
+			rate("Missionary Electrification", UnitPerKWh, "0.1822"),
+		}},
+	}
+}
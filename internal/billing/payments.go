@@ -0,0 +1,23 @@
+/*
+ * @file internal/billing/payments.go
+ * @brief payments.go file spreads a payment over the unpaid bills of an account
+ */
+package billing
+
+import "github.com/shopspring/decimal"
+
+// Allocate spends funds on the balances in order, paying each in full before
+// the next, so passing the oldest bill first settles the arrears first. It
+// returns the amount applied to each balance and what is left over, which the
+// account keeps as a credit.
+func Allocate(funds decimal.Decimal, balances []decimal.Decimal) ([]decimal.Decimal, decimal.Decimal) {
+	applied := make([]decimal.Decimal, len(balances))
+	for i, balance := range balances {
+		if !funds.IsPositive() || !balance.IsPositive() {
+			continue
+		}
+		applied[i] = decimal.Min(funds, balance)
+		funds = funds.Sub(applied[i])
+	}
+	return applied, funds
+}
@@ -0,0 +1,48 @@
+package billing
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestAllocate(t *testing.T) {
+	amounts := func(values ...string) []decimal.Decimal {
+		list := make([]decimal.Decimal, 0, len(values))
+		for _, value := range values {
+			list = append(list, decimal.RequireFromString(value))
+		}
+		return list
+	}
+
+	tests := []struct {
+		name     string
+		funds    string
+		balances []decimal.Decimal
+		applied  []decimal.Decimal
+		left     string
+	}{
+		{"exact", "1500.50", amounts("1000.00", "500.50"), amounts("1000.00", "500.50"), "0"},
+		{"partial pays oldest first", "1200", amounts("1000.00", "500.50"), amounts("1000.00", "200"), "0"},
+		{"overpayment", "2000", amounts("1000.00", "500.50"), amounts("1000.00", "500.50"), "499.50"},
+		{"no bills", "300", nil, amounts(), "300"},
+		{"settled bill skipped", "100", amounts("0", "250"), amounts("0", "100"), "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied, left := Allocate(decimal.RequireFromString(tt.funds), tt.balances)
+			if len(applied) != len(tt.applied) {
+				t.Fatalf("Allocate() applied %v, want %v", applied, tt.applied)
+			}
+			for i := range applied {
+				if !applied[i].Equal(tt.applied[i]) {
+					t.Errorf("Allocate() applied %v, want %v", applied, tt.applied)
+					break
+				}
+			}
+			if !left.Equal(decimal.RequireFromString(tt.left)) {
+				t.Errorf("Allocate() left %s, want %s", left, tt.left)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ * @file internal/billing/rates.go
+ * @brief rates.go file contains the typed rate tables bills are computed from
+ */
+package billing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Unit is what a rate is charged per
+type Unit string
+
+const (
+	UnitPerKWh           Unit = "PhP/kWh"     // per kWh of energy used
+	UnitPerKW            Unit = "PhP/kW"      // per kW of peak demand
+	UnitPerCustomerMonth Unit = "PhP/Cust/Mo" // fixed per customer per month
+)
+
+// ParseUnit reads a unit as written in the rate tables
+func ParseUnit(value string) (Unit, error) {
+	switch unit := Unit(strings.TrimSpace(value)); unit {
+	case UnitPerKWh, UnitPerKW, UnitPerCustomerMonth:
+		return unit, nil
+	default:
+		return "", fmt.Errorf("unknown rate unit %q", value)
+	}
+}
+
+// ParseRate reads a rate as written in the rate tables, e.g. "5.6092"
+func ParseRate(value string) (decimal.Decimal, error) {
+	rate, err := decimal.NewFromString(strings.TrimSpace(value))
+	if err != nil {
+		return decimal.Decimal{}, fmt.Errorf("invalid rate %q", value)
+	}
+	return rate, nil
+}
+
+// Rate is one charge of a rate table, e.g. the Generation Energy Charge
+type Rate struct {
+	Particulars string          `bson:"particulars"`
+	Unit        Unit            `bson:"unit"`
+	Amount      decimal.Decimal `bson:"amount"`
+}
+
+// RateGroup is a heading of a rate table, e.g. Generation Charges, and the
+// rates under it
+type RateGroup struct {
+	Particulars string `bson:"particulars"`
+	Rates       []Rate `bson:"rates"`
+}
+
+// RateTable holds the rates of one consumer class, e.g. RESIDENTIAL
+type RateTable struct {
+	Class  string      `bson:"class"`
+	Groups []RateGroup `bson:"groups"`
+}
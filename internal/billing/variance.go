@@ -0,0 +1,96 @@
+/*
+ * @file internal/billing/variance.go
+ * @brief variance.go file compares the billed rates against the ERC approved ones
+ */
+package billing
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// ClassUsage is what all consumers of a class used over one billing cycle
+type ClassUsage struct {
+	Consumers int
+	EnergyKWh decimal.Decimal
+	DemandKW  decimal.Decimal // sum of the peak demand of every consumer
+}
+
+// quantity returns how many units of a rate the class was billed
+func (u ClassUsage) quantity(unit Unit) decimal.Decimal {
+	switch unit {
+	case UnitPerKWh:
+		return u.EnergyKWh
+	case UnitPerKW:
+		return u.DemandKW
+	case UnitPerCustomerMonth:
+		return decimal.NewFromInt(int64(u.Consumers))
+	default:
+		return decimal.Zero
+	}
+}
+
+// Variance compares one rate of the billed and ERC tables. Difference is
+// Billed minus ERC; Impact is what the difference amounted to over the
+// cycle, positive when consumers were overcharged.
+type Variance struct {
+	Group       string
+	Particulars string
+	Unit        Unit
+	Billed      *decimal.Decimal // nil when only the ERC table has the rate
+	ERC         *decimal.Decimal // nil when the rate is not ERC approved
+	Difference  decimal.Decimal
+	Impact      decimal.Decimal
+	Flagged     bool
+}
+
+// Variances compares every rate of the two tables. A rate is flagged when it
+// differs by more than tolerance or is missing from either table; the
+// difference of a missing rate is taken against zero.
+func Variances(billed, erc RateTable, tolerance decimal.Decimal, usage ClassUsage) []Variance {
+	type key struct{ group, rate string }
+	ercRates := map[key]Rate{}
+	for _, group := range erc.Groups {
+		for _, rate := range group.Rates {
+			ercRates[key{group.Particulars, rate.Particulars}] = rate
+		}
+	}
+
+	variances := []Variance{}
+	add := func(group string, rate Rate, billedAmount, ercAmount *decimal.Decimal) {
+		v := Variance{Group: group, Particulars: rate.Particulars, Unit: rate.Unit, Billed: billedAmount, ERC: ercAmount}
+		var b, e decimal.Decimal
+		if billedAmount != nil {
+			b = *billedAmount
+		}
+		if ercAmount != nil {
+			e = *ercAmount
+		}
+		v.Difference = b.Sub(e)
+		v.Impact = v.Difference.Mul(usage.quantity(rate.Unit)).Round(centavos)
+		v.Flagged = billedAmount == nil || ercAmount == nil || v.Difference.Abs().GreaterThan(tolerance)
+		variances = append(variances, v)
+	}
+
+	for _, group := range billed.Groups {
+		for _, rate := range group.Rates {
+			k := key{group.Particulars, rate.Particulars}
+			billedAmount := rate.Amount
+			if approved, ok := ercRates[k]; ok {
+				ercAmount := approved.Amount
+				add(group.Particulars, rate, &billedAmount, &ercAmount)
+				delete(ercRates, k)
+			} else {
+				add(group.Particulars, rate, &billedAmount, nil)
+			}
+		}
+	}
+	for _, group := range erc.Groups {
+		for _, rate := range group.Rates {
+			if _, ok := ercRates[key{group.Particulars, rate.Particulars}]; ok {
+				ercAmount := rate.Amount
+				add(group.Particulars, rate, nil, &ercAmount)
+			}
+		}
+	}
+	return variances
+}
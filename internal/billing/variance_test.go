@@ -0,0 +1,58 @@
+package billing
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestVariances(t *testing.T) {
+	rate := func(particulars string, unit Unit, amount string) Rate {
+		return Rate{Particulars: particulars, Unit: unit, Amount: decimal.RequireFromString(amount)}
+	}
+	billed := RateTable{Groups: []RateGroup{
+		{Particulars: "Generation Charges", Rates: []Rate{
+			rate("Generation Energy Charge", UnitPerKWh, "5.6100"),
+			rate("Other Generation Rate Adjustment", UnitPerKWh, "0.00005"),
+		}},
+		{Particulars: "Supply Charges", Rates: []Rate{
+			rate("Supply Retail Customer Charge", UnitPerCustomerMonth, "5.0000"),
+		}},
+	}}
+	erc := RateTable{Groups: []RateGroup{
+		{Particulars: "Generation Charges", Rates: []Rate{
+			rate("Generation Energy Charge", UnitPerKWh, "5.6092"),
+			rate("Other Generation Rate Adjustment", UnitPerKWh, "0.0000"),
+		}},
+		{Particulars: "Universal Charge", Rates: []Rate{
+			rate("Missionary Electrification", UnitPerKWh, "0.1822"),
+		}},
+	}}
+	usage := ClassUsage{Consumers: 3, EnergyKWh: decimal.NewFromInt(1000)}
+
+	variances := Variances(billed, erc, decimal.RequireFromString("0.0001"), usage)
+	if len(variances) != 4 {
+		t.Fatalf("Variances() = %+v", variances)
+	}
+
+	tests := []struct {
+		particulars string
+		impact      string
+		flagged     bool
+	}{
+		{"Generation Energy Charge", "0.80", true},          // 0.0008 * 1000 kWh
+		{"Other Generation Rate Adjustment", "0.05", false}, // within tolerance
+		{"Supply Retail Customer Charge", "15.00", true},    // not ERC approved, 5 * 3 consumers
+		{"Missionary Electrification", "-182.20", true},     // approved but not billed
+	}
+	for i, tt := range tests {
+		v := variances[i]
+		if v.Particulars != tt.particulars || v.Impact.StringFixed(2) != tt.impact || v.Flagged != tt.flagged {
+			t.Errorf("variance %d = %s impact %s flagged %v, want %s %s %v",
+				i, v.Particulars, v.Impact.StringFixed(2), v.Flagged, tt.particulars, tt.impact, tt.flagged)
+		}
+	}
+	if variances[2].ERC != nil || variances[3].Billed != nil {
+		t.Error("Variances() did not mark the rates missing from one table")
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * @file internal/config/env.go
+ * @brief env.go file reads typed settings from the environment, falling back to defaults
+ */
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Duration reads a positive duration such as "15m", falling back when the
+// variable is unset, malformed or not positive
+func Duration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// Float reads a positive number, falling back when the variable is unset,
+// malformed or not positive
+func Float(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// Int reads a whole number of at least min, falling back when the variable
+// is unset, malformed or below min
+func Int(key string, fallback, min int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < min {
+		return fallback
+	}
+	return value
+}
+
+// Decimal reads a non-negative decimal such as a rate, falling back when the
+// variable is unset, malformed or negative
+func Decimal(key string, fallback decimal.Decimal) decimal.Decimal {
+	value, err := decimal.NewFromString(os.Getenv(key))
+	if err != nil || value.IsNegative() {
+		return fallback
+	}
+	return value
+}
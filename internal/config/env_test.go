@@ -0,0 +1,87 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", time.Minute},
+		{"90s", 90 * time.Second},
+		{"soon", time.Minute},
+		{"0s", time.Minute},
+		{"-5m", time.Minute},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_DURATION", tt.value)
+		if got := Duration("TEST_DURATION", time.Minute); got != tt.want {
+			t.Errorf("Duration(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFloat(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"", 1.5},
+		{"0.9", 0.9},
+		{"high", 1.5},
+		{"0", 1.5},
+		{"-2", 1.5},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_FLOAT", tt.value)
+		if got := Float("TEST_FLOAT", 1.5); got != tt.want {
+			t.Errorf("Float(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestInt(t *testing.T) {
+	tests := []struct {
+		value string
+		min   int
+		want  int
+	}{
+		{"", 0, 7},
+		{"3", 0, 3},
+		{"0", 0, 0},
+		{"0", 1, 7},
+		{"-1", 0, 7},
+		{"week", 0, 7},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_INT", tt.value)
+		if got := Int("TEST_INT", 7, tt.min); got != tt.want {
+			t.Errorf("Int(%q, min %d) = %d, want %d", tt.value, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	fallback := decimal.RequireFromString("0.02")
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "0.02"},
+		{"0.05", "0.05"},
+		{"0", "0"},
+		{"-0.01", "0.02"},
+		{"two", "0.02"},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_DECIMAL", tt.value)
+		if got := Decimal("TEST_DECIMAL", fallback); !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("Decimal(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
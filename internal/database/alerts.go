@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Alert statuses. An alert is raised open, may be acknowledged by the
+// employee looking into it, and is finally resolved.
+const (
+	AlertStatusOpen         = "open"
+	AlertStatusAcknowledged = "acknowledged"
+	AlertStatusResolved     = "resolved"
+)
+
+// Alert is a meter anomaly raised by a rule. While unresolved, later
+// occurrences of the same rule on the same meter are counted on it instead
+// of raising new alerts.
+type Alert struct {
+	ID                 primitive.ObjectID `bson:"_id,omitempty"`
+	SerialNumber       string             `bson:"serial_number"`
+	Rule               string             `bson:"rule"`
+	Severity           string             `bson:"severity"`
+	Message            string             `bson:"message"` // of the latest occurrence
+	Status             string             `bson:"status"`
+	Unresolved         bool               `bson:"unresolved,omitempty"` // keys the one unresolved alert per meter and rule
+	Occurrences        int                `bson:"occurrences"`
+	RaisedAt           time.Time          `bson:"raised_at"`
+	LastOccurredAt     time.Time          `bson:"last_occurred_at"`
+	AcknowledgedBy     primitive.ObjectID `bson:"acknowledged_by,omitempty"`
+	AcknowledgedByName string             `bson:"acknowledged_by_name,omitempty"`
+	AcknowledgedAt     time.Time          `bson:"acknowledged_at,omitempty"`
+	ResolvedBy         primitive.ObjectID `bson:"resolved_by,omitempty"`
+	ResolvedByName     string             `bson:"resolved_by_name,omitempty"`
+	ResolvedAt         time.Time          `bson:"resolved_at,omitempty"`
+	Resolution         string             `bson:"resolution,omitempty"` // what was found or done
+}
+
+// AlertFilter narrows AlertStore.List, zero values match everything
+type AlertFilter struct {
+	Statuses     []string
+	SerialNumber string
+	Limit        int64
+}
+
+// AlertStore persists the alerts raised on the meters
+type AlertStore interface {
+	// Raise records an occurrence of the rule on the meter at alert.RaisedAt.
+	// It opens a new alert unless one is unresolved, and reports whether it
+	// did.
+	Raise(ctx context.Context, alert *Alert) (bool, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*Alert, error)
+	// List lists the alerts, latest raised first
+	List(ctx context.Context, filter AlertFilter) ([]Alert, error)
+	// Acknowledge moves an open alert to acknowledged
+	Acknowledge(ctx context.Context, id, userID primitive.ObjectID, userName string) error
+	// Resolve closes an open or acknowledged alert
+	Resolve(ctx context.Context, id, userID primitive.ObjectID, userName, resolution string) error
+}
+
+type mongoAlertStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoAlertStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "serial_number", Value: 1}, {Key: "rule", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"unresolved": true}),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "raised_at", Value: -1}},
+		},
+	})
+	return err
+}
+
+func (s *mongoAlertStore) Raise(ctx context.Context, alert *Alert) (bool, error) {
+	at := alert.RaisedAt.UTC()
+	if alert.RaisedAt.IsZero() {
+		at = time.Now().UTC()
+	}
+	filter := bson.M{"serial_number": alert.SerialNumber, "rule": alert.Rule, "unresolved": true}
+	update := bson.M{
+		"$setOnInsert": bson.M{"severity": alert.Severity, "status": AlertStatusOpen, "raised_at": at},
+		"$set":         bson.M{"message": alert.Message},
+		"$max":         bson.M{"last_occurred_at": at},
+		"$inc":         bson.M{"occurrences": 1},
+	}
+
+	// Two uploads racing to open the alert both upsert; the loser hits the
+	// unique index and counts its occurrence on the winner's alert
+	var result *mongo.UpdateResult
+	var err error
+	for range 2 {
+		result, err = s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	if result.UpsertedID == nil {
+		return false, nil
+	}
+	alert.ID = result.UpsertedID.(primitive.ObjectID)
+	alert.Status = AlertStatusOpen
+	alert.Unresolved = true
+	alert.Occurrences = 1
+	alert.RaisedAt = at
+	alert.LastOccurredAt = at
+	return true, nil
+}
+
+func (s *mongoAlertStore) Get(ctx context.Context, id primitive.ObjectID) (*Alert, error) {
+	var alert Alert
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&alert)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+func (s *mongoAlertStore) List(ctx context.Context, filter AlertFilter) ([]Alert, error) {
+	query := bson.M{}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+	if filter.SerialNumber != "" {
+		query["serial_number"] = filter.SerialNumber
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "raised_at", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := []Alert{}
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+func (s *mongoAlertStore) Acknowledge(ctx context.Context, id, userID primitive.ObjectID, userName string) error {
+	return s.transition(ctx, id, []string{AlertStatusOpen}, bson.M{"$set": bson.M{
+		"status":               AlertStatusAcknowledged,
+		"acknowledged_by":      userID,
+		"acknowledged_by_name": userName,
+		"acknowledged_at":      time.Now().UTC(),
+	}})
+}
+
+func (s *mongoAlertStore) Resolve(ctx context.Context, id, userID primitive.ObjectID, userName, resolution string) error {
+	return s.transition(ctx, id, []string{AlertStatusOpen, AlertStatusAcknowledged}, bson.M{
+		"$set": bson.M{
+			"status":           AlertStatusResolved,
+			"resolved_by":      userID,
+			"resolved_by_name": userName,
+			"resolved_at":      time.Now().UTC(),
+			"resolution":       resolution,
+		},
+		"$unset": bson.M{"unresolved": ""},
+	})
+}
+
+// transition applies the update when the alert is in one of the from
+// statuses, so two employees cannot both act on it
+func (s *mongoAlertStore) transition(ctx context.Context, id primitive.ObjectID, from []string, update bson.M) error {
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id, "status": bson.M{"$in": from}}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if _, err := s.Get(ctx, id); err != nil {
+			return err
+		}
+		return ErrInvalidStatusTransition
+	}
+	return nil
+}
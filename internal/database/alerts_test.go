@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAlertStore(t *testing.T) {
+	alerts := New().Alerts()
+	ctx := context.Background()
+
+	at := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	raise := func(at time.Time, message string) (*Alert, bool) {
+		alert := &Alert{SerialNumber: "SM-ALERT-001", Rule: "voltage_sag", Severity: "warning", Message: message, RaisedAt: at}
+		created, err := alerts.Raise(ctx, alert)
+		if err != nil {
+			t.Fatalf("Raise() error = %v", err)
+		}
+		return alert, created
+	}
+
+	first, created := raise(at, "Voltage sagged to 200.0 V")
+	if !created || first.ID.IsZero() {
+		t.Fatalf("Raise() = %+v, %v, want a new alert", first, created)
+	}
+	if _, created := raise(at.Add(time.Hour), "Voltage sagged to 190.0 V"); created {
+		t.Errorf("Raise() of an unresolved rule created a new alert")
+	}
+
+	stored, err := alerts.Get(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if stored.Occurrences != 2 || stored.Message != "Voltage sagged to 190.0 V" || !stored.LastOccurredAt.Equal(at.Add(time.Hour)) {
+		t.Errorf("Get() = %+v, want the second occurrence counted", stored)
+	}
+
+	employee := primitive.NewObjectID()
+	if err := alerts.Acknowledge(ctx, first.ID, employee, "Ana"); err != nil {
+		t.Fatalf("Acknowledge() error = %v", err)
+	}
+	if err := alerts.Acknowledge(ctx, first.ID, employee, "Ana"); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("Acknowledge() twice error = %v, want ErrInvalidStatusTransition", err)
+	}
+	if err := alerts.Resolve(ctx, first.ID, employee, "Ana", "Loose neutral fixed"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if err := alerts.Resolve(ctx, primitive.NewObjectID(), employee, "Ana", "-"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Resolve() of an unknown alert error = %v, want ErrNotFound", err)
+	}
+
+	// Once resolved, the rule raises a new alert
+	second, created := raise(at.Add(2*time.Hour), "Voltage sagged to 180.0 V")
+	if !created || second.ID == first.ID {
+		t.Errorf("Raise() after Resolve() = %+v, %v, want a new alert", second, created)
+	}
+
+	open, err := alerts.List(ctx, AlertFilter{Statuses: []string{AlertStatusOpen}, SerialNumber: "SM-ALERT-001"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(open) != 1 || open[0].ID != second.ID {
+		t.Errorf("List() = %+v, want the second alert only", open)
+	}
+}
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"SmartMeterSystem/internal/billing"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Bill statuses. A bill is drafted when its cycle closes and issued once the
+// whole cycle is billed; it is then paid, or falls overdue past its due date
+// and may still be paid late.
+const (
+	BillStatusDraft   = "draft"
+	BillStatusIssued  = "issued"
+	BillStatusPaid    = "paid"
+	BillStatusOverdue = "overdue"
+)
+
+// billTransitions lists the statuses each bill status may move to
+var billTransitions = map[string][]string{
+	BillStatusDraft:   {BillStatusIssued},
+	BillStatusIssued:  {BillStatusPaid, BillStatusOverdue},
+	BillStatusOverdue: {BillStatusPaid},
+}
+
+// CanTransitionBill reports whether a bill may move from one status to another
+func CanTransitionBill(from, to string) bool {
+	return slices.Contains(billTransitions[from], to)
+}
+
+// Bill is what a consumer owes for one billing period. A consumer has at
+// most one bill per period, which makes closing a cycle safe to repeat.
+type Bill struct {
+	ID             primitive.ObjectID   `bson:"_id,omitempty"`
+	Number         string               `bson:"number"`
+	ConsumerID     primitive.ObjectID   `bson:"consumer_id"`
+	AccountNumber  string               `bson:"account_number"`
+	Book           string               `bson:"book"`
+	Class          string               `bson:"class"`
+	PeriodStart    time.Time            `bson:"period_start"`
+	PeriodEnd      time.Time            `bson:"period_end"` // exclusive, the read date
+	Meters         []BillMeter          `bson:"meters"`
+	Usage          billing.Usage        `bson:"usage"`
+	RateScheduleID primitive.ObjectID   `bson:"rate_schedule_id"`
+	RateVersion    int                  `bson:"rate_version"`
+	Items          []billing.LineItem   `bson:"items"`
+	Subtotals      []billing.GroupTotal `bson:"subtotals"`
+	Total          decimal.Decimal      `bson:"total"`
+	AmountPaid     decimal.Decimal      `bson:"amount_paid"`
+	Surcharged     bool                 `bson:"surcharged"` // the late payment surcharge was charged
+	Status         string               `bson:"status"`
+	IssuedAt       time.Time            `bson:"issued_at,omitempty"`
+	DueDate        time.Time            `bson:"due_date,omitempty"`
+	PaidAt         time.Time            `bson:"paid_at,omitempty"`
+	CreatedAt      time.Time            `bson:"created_at"`
+	UpdatedAt      time.Time            `bson:"updated_at"`
+}
+
+// Balance is what is left to pay on the bill
+func (b *Bill) Balance() decimal.Decimal {
+	return b.Total.Sub(b.AmountPaid)
+}
+
+// BillMeter holds the register readings of one meter that bound a bill
+type BillMeter struct {
+	SerialNumber string  `bson:"serial_number"`
+	PreviousKWh  float64 `bson:"previous_kwh"`
+	PresentKWh   float64 `bson:"present_kwh"`
+}
+
+// BillStore persists the bills
+type BillStore interface {
+	// Create stores a bill under the next bill number, as a draft unless a
+	// status is set. A second bill of the same consumer and period returns
+	// ErrDuplicate.
+	Create(ctx context.Context, bill *Bill) error
+	Get(ctx context.Context, id primitive.ObjectID) (*Bill, error)
+	// ListByConsumer lists the bills of the consumer, newest period first
+	ListByConsumer(ctx context.Context, consumerID primitive.ObjectID) ([]Bill, error)
+	// ListUnpaid lists the issued and overdue bills of the consumer, oldest
+	// period first
+	ListUnpaid(ctx context.Context, consumerID primitive.ObjectID) ([]Bill, error)
+	// ListCycle lists the bills of the book and period
+	ListCycle(ctx context.Context, book string, periodStart time.Time) ([]Bill, error)
+	// ListUnsurcharged lists the overdue bills not surcharged yet
+	ListUnsurcharged(ctx context.Context) ([]Bill, error)
+	// MarkSurcharged records that the surcharge of the bill was charged
+	MarkSurcharged(ctx context.Context, id primitive.ObjectID) error
+	// Issue issues a draft bill. A bill no longer a draft returns
+	// ErrInvalidStatusTransition.
+	Issue(ctx context.Context, id primitive.ObjectID, issuedAt, dueDate time.Time) error
+	// MarkOverdue moves the issued bills due before now to overdue
+	MarkOverdue(ctx context.Context, now time.Time) (int64, error)
+	// SetStatus moves a bill to a new status if the transition is allowed,
+	// returning ErrInvalidStatusTransition otherwise
+	SetStatus(ctx context.Context, id primitive.ObjectID, status string) error
+	// ApplyPayment adds amount to what was paid on an issued or overdue bill,
+	// marking it paid once nothing is left. Nothing may have been paid on the
+	// bill since it was read, or ErrConflict is returned.
+	ApplyPayment(ctx context.Context, bill *Bill, amount decimal.Decimal) error
+}
+
+type mongoBillStore struct {
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+func (s *mongoBillStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "consumer_id", Value: 1}, {Key: "period_start", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "number", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "book", Value: 1}, {Key: "period_start", Value: 1}, {Key: "status", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "due_date", Value: 1}},
+		},
+	})
+	return err
+}
+
+func (s *mongoBillStore) Create(ctx context.Context, bill *Bill) error {
+	seq, err := nextSequence(ctx, s.counters, "bill_number")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	bill.Number = fmt.Sprintf("B%08d", seq)
+	if bill.Status == "" {
+		bill.Status = BillStatusDraft
+	}
+	bill.CreatedAt = now
+	bill.UpdatedAt = now
+
+	result, err := s.collection.InsertOne(ctx, bill)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	bill.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoBillStore) Get(ctx context.Context, id primitive.ObjectID) (*Bill, error) {
+	var bill Bill
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&bill)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bill, nil
+}
+
+func (s *mongoBillStore) ListByConsumer(ctx context.Context, consumerID primitive.ObjectID) ([]Bill, error) {
+	return s.list(ctx, bson.M{"consumer_id": consumerID}, bson.D{{Key: "period_start", Value: -1}})
+}
+
+func (s *mongoBillStore) ListUnpaid(ctx context.Context, consumerID primitive.ObjectID) ([]Bill, error) {
+	return s.list(ctx,
+		bson.M{"consumer_id": consumerID, "status": bson.M{"$in": bson.A{BillStatusIssued, BillStatusOverdue}}},
+		bson.D{{Key: "period_start", Value: 1}},
+	)
+}
+
+func (s *mongoBillStore) ListCycle(ctx context.Context, book string, periodStart time.Time) ([]Bill, error) {
+	return s.list(ctx, bson.M{"book": book, "period_start": periodStart}, bson.D{{Key: "number", Value: 1}})
+}
+
+func (s *mongoBillStore) ListUnsurcharged(ctx context.Context) ([]Bill, error) {
+	return s.list(ctx, bson.M{"status": BillStatusOverdue, "surcharged": bson.M{"$ne": true}}, bson.D{{Key: "due_date", Value: 1}})
+}
+
+func (s *mongoBillStore) list(ctx context.Context, filter bson.M, sort bson.D) ([]Bill, error) {
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, err
+	}
+
+	bills := []Bill{}
+	if err := cursor.All(ctx, &bills); err != nil {
+		return nil, err
+	}
+	return bills, nil
+}
+
+func (s *mongoBillStore) MarkSurcharged(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"surcharged": true, "updated_at": time.Now().UTC()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoBillStore) Issue(ctx context.Context, id primitive.ObjectID, issuedAt, dueDate time.Time) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": BillStatusDraft},
+		bson.M{"$set": bson.M{
+			"status":     BillStatusIssued,
+			"issued_at":  issuedAt,
+			"due_date":   dueDate,
+			"updated_at": time.Now().UTC(),
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidStatusTransition
+	}
+	return nil
+}
+
+func (s *mongoBillStore) MarkOverdue(ctx context.Context, now time.Time) (int64, error) {
+	result, err := s.collection.UpdateMany(ctx,
+		bson.M{"status": BillStatusIssued, "due_date": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"status": BillStatusOverdue, "updated_at": time.Now().UTC()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (s *mongoBillStore) SetStatus(ctx context.Context, id primitive.ObjectID, status string) error {
+	bill, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !CanTransitionBill(bill.Status, status) {
+		return ErrInvalidStatusTransition
+	}
+
+	now := time.Now().UTC()
+	set := bson.M{"status": status, "updated_at": now}
+	if status == BillStatusPaid {
+		set["paid_at"] = now
+	}
+	// Matching the old status makes a concurrent change lose instead of both
+	// writes succeeding
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id, "status": bill.Status}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidStatusTransition
+	}
+	return nil
+}
+
+func (s *mongoBillStore) ApplyPayment(ctx context.Context, bill *Bill, amount decimal.Decimal) error {
+	if bill.Status != BillStatusIssued && bill.Status != BillStatusOverdue {
+		return ErrInvalidStatusTransition
+	}
+
+	now := time.Now().UTC()
+	paid := bill.AmountPaid.Add(amount)
+	set := bson.M{"amount_paid": paid, "updated_at": now}
+	if !paid.LessThan(bill.Total) {
+		set["status"] = BillStatusPaid
+		set["paid_at"] = now
+	}
+	// Matching what was paid makes two cashiers paying the same bill at once
+	// conflict instead of both applying against the same balance; the bill
+	// may still fall overdue meanwhile
+	filter := bson.M{
+		"_id":         bill.ID,
+		"status":      bson.M{"$in": bson.A{BillStatusIssued, BillStatusOverdue}},
+		"amount_paid": bill.AmountPaid,
+	}
+	if bill.AmountPaid.IsZero() {
+		filter["amount_paid"] = bson.M{"$in": bson.A{bill.AmountPaid, nil}} // stored before payments existed
+	}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+
+	bill.AmountPaid = paid
+	if status, ok := set["status"].(string); ok {
+		bill.Status = status
+		bill.PaidAt = now
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCanTransitionBill(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{BillStatusDraft, BillStatusIssued, true},
+		{BillStatusIssued, BillStatusOverdue, true},
+		{BillStatusOverdue, BillStatusPaid, true},
+		{BillStatusDraft, BillStatusPaid, false},
+		{BillStatusPaid, BillStatusIssued, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransitionBill(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransitionBill(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestBillStore(t *testing.T) {
+	db := New()
+	bills := db.Bills()
+	ctx := context.Background()
+
+	book := "T" + primitive.NewObjectID().Hex()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, RollupLocation)
+	bill := &Bill{
+		ConsumerID:  primitive.NewObjectID(),
+		Book:        book,
+		PeriodStart: start,
+		PeriodEnd:   start.AddDate(0, 1, 0),
+		Total:       decimal.RequireFromString("1234.56"),
+	}
+	if err := bills.Create(ctx, bill); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if bill.Number == "" || bill.Status != BillStatusDraft {
+		t.Errorf("Create() = %+v", bill)
+	}
+
+	again := *bill
+	again.ID = primitive.NilObjectID
+	if err := bills.Create(ctx, &again); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Create() of the same period error = %v, want ErrDuplicate", err)
+	}
+
+	issuedAt := start.AddDate(0, 1, 0)
+	if err := bills.Issue(ctx, bill.ID, issuedAt, issuedAt.AddDate(0, 0, 10)); err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if err := bills.Issue(ctx, bill.ID, issuedAt, issuedAt.AddDate(0, 0, 10)); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("Issue() twice error = %v, want ErrInvalidStatusTransition", err)
+	}
+	if _, err := bills.MarkOverdue(ctx, issuedAt.AddDate(0, 0, 11)); err != nil {
+		t.Fatalf("MarkOverdue() error = %v", err)
+	}
+
+	stored, err := bills.Get(ctx, bill.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if stored.Status != BillStatusOverdue || !stored.Total.Equal(bill.Total) {
+		t.Errorf("Get() = %+v, want an overdue bill of %s", stored, bill.Total)
+	}
+
+	if err := bills.SetStatus(ctx, bill.ID, BillStatusIssued); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("SetStatus(issued) error = %v, want ErrInvalidStatusTransition", err)
+	}
+	if err := bills.SetStatus(ctx, bill.ID, BillStatusPaid); err != nil {
+		t.Fatalf("SetStatus(paid) error = %v", err)
+	}
+	list, err := bills.ListByConsumer(ctx, bill.ConsumerID)
+	if err != nil {
+		t.Fatalf("ListByConsumer() error = %v", err)
+	}
+	if len(list) != 1 || list[0].Status != BillStatusPaid || list[0].PaidAt.IsZero() {
+		t.Errorf("ListByConsumer() = %+v", list)
+	}
+}
+
+func TestLeaseStore(t *testing.T) {
+	db := New()
+	leases := db.Leases()
+	ctx := context.Background()
+	name := "test-" + primitive.NewObjectID().Hex()
+
+	if held, err := leases.Acquire(ctx, name, "a", time.Minute); err != nil || !held {
+		t.Fatalf("Acquire(a) = %v, %v, want true", held, err)
+	}
+	if held, err := leases.Acquire(ctx, name, "b", time.Minute); err != nil || held {
+		t.Errorf("Acquire(b) while held = %v, %v, want false", held, err)
+	}
+	if held, err := leases.Acquire(ctx, name, "a", time.Minute); err != nil || !held {
+		t.Errorf("Acquire(a) renewal = %v, %v, want true", held, err)
+	}
+	if err := leases.Release(ctx, name, "a"); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if held, err := leases.Acquire(ctx, name, "b", time.Minute); err != nil || !held {
+		t.Errorf("Acquire(b) after release = %v, %v, want true", held, err)
+	}
+}
+
+func TestBillStoreApplyPayment(t *testing.T) {
+	db := New()
+	bills := db.Bills()
+	ctx := context.Background()
+
+	start := time.Date(2025, 2, 1, 0, 0, 0, 0, RollupLocation)
+	bill := &Bill{
+		ConsumerID:  primitive.NewObjectID(),
+		Book:        "T" + primitive.NewObjectID().Hex(),
+		PeriodStart: start,
+		PeriodEnd:   start.AddDate(0, 1, 0),
+		Total:       decimal.RequireFromString("1000.00"),
+		Status:      BillStatusIssued,
+	}
+	if err := bills.Create(ctx, bill); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	stale := *bill
+	if err := bills.ApplyPayment(ctx, bill, decimal.RequireFromString("400.00")); err != nil {
+		t.Fatalf("ApplyPayment() error = %v", err)
+	}
+	if err := bills.ApplyPayment(ctx, &stale, decimal.RequireFromString("400.00")); !errors.Is(err, ErrConflict) {
+		t.Errorf("ApplyPayment() of a stale bill error = %v, want ErrConflict", err)
+	}
+
+	unpaid, err := bills.ListUnpaid(ctx, bill.ConsumerID)
+	if err != nil || len(unpaid) != 1 || !unpaid[0].Balance().Equal(decimal.RequireFromString("600")) {
+		t.Fatalf("ListUnpaid() = %+v, %v, want a balance of 600", unpaid, err)
+	}
+	if err := bills.ApplyPayment(ctx, &unpaid[0], decimal.RequireFromString("600.00")); err != nil {
+		t.Fatalf("ApplyPayment() error = %v", err)
+	}
+	stored, err := bills.Get(ctx, bill.ID)
+	if err != nil || stored.Status != BillStatusPaid || stored.PaidAt.IsZero() {
+		t.Errorf("Get() after full payment = %+v, %v", stored, err)
+	}
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Meter command types
+const (
+	CommandDisconnect = "disconnect" // switch the supply off
+	CommandReconnect  = "reconnect"  // switch the supply back on
+	CommandSyncClock  = "sync_clock" // set the meter clock to the server time
+	CommandReadNow    = "read_now"   // upload a reading at once
+)
+
+// Reasons a meter is disconnected
+const (
+	DisconnectNonPayment      = "non_payment"
+	DisconnectCustomerRequest = "customer_request"
+	DisconnectMaintenance     = "maintenance"
+	DisconnectSafety          = "safety"
+)
+
+// Meter command statuses. A command is queued pending and delivered when the
+// meter polls; delivered commands are sent again on every poll until the
+// meter acknowledges them as succeeded or failed. Pending commands may be
+// cancelled, and expire when not delivered in time.
+const (
+	CommandStatusPending   = "pending"
+	CommandStatusDelivered = "delivered"
+	CommandStatusSucceeded = "succeeded"
+	CommandStatusFailed    = "failed"
+	CommandStatusCancelled = "cancelled"
+	CommandStatusExpired   = "expired"
+)
+
+// MeterCommand is an instruction queued for a meter by an employee
+type MeterCommand struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	SerialNumber    string             `bson:"serial_number"`
+	Type            string             `bson:"type"`
+	Reason          string             `bson:"reason,omitempty"` // of a disconnection
+	Status          string             `bson:"status"`
+	Open            bool               `bson:"open,omitempty"` // keys the one open command per meter and type
+	RequestedBy     primitive.ObjectID `bson:"requested_by"`
+	RequestedByName string             `bson:"requested_by_name"`
+	RequestedAt     time.Time          `bson:"requested_at"`
+	ExpiresAt       time.Time          `bson:"expires_at"` // when a command not delivered yet expires
+	DeliveredAt     time.Time          `bson:"delivered_at,omitempty"`
+	Deliveries      int                `bson:"deliveries"`
+	CompletedAt     time.Time          `bson:"completed_at,omitempty"`
+	Result          string             `bson:"result,omitempty"` // as reported by the meter
+	CancelledByName string             `bson:"cancelled_by_name,omitempty"`
+}
+
+// CommandFilter narrows CommandStore.List, zero values match everything
+type CommandFilter struct {
+	SerialNumber string
+	Open         bool // only the commands awaiting their meter
+	Limit        int64
+}
+
+// CommandStore persists the command queue of the meters
+type CommandStore interface {
+	// Queue adds a pending command, returning ErrDuplicate while a command of
+	// the same type is open on the meter
+	Queue(ctx context.Context, command *MeterCommand) error
+	Get(ctx context.Context, id primitive.ObjectID) (*MeterCommand, error)
+	// List lists the commands, latest requested first
+	List(ctx context.Context, filter CommandFilter) ([]MeterCommand, error)
+	// Deliver marks the pending and delivered commands of the meter that
+	// have not expired as delivered at now and returns them, oldest first
+	Deliver(ctx context.Context, serialNumber string, now time.Time) ([]MeterCommand, error)
+	// Complete records the outcome the meter acknowledged for its command
+	// and returns the command as updated
+	Complete(ctx context.Context, id primitive.ObjectID, serialNumber string, succeeded bool, result string, at time.Time) (*MeterCommand, error)
+	// Cancel withdraws a command the meter has not received
+	Cancel(ctx context.Context, id primitive.ObjectID, userName string) error
+}
+
+type mongoCommandStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoCommandStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "serial_number", Value: 1}, {Key: "type", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"open": true}),
+		},
+		{
+			Keys: bson.D{{Key: "serial_number", Value: 1}, {Key: "requested_at", Value: -1}},
+		},
+	})
+	return err
+}
+
+func (s *mongoCommandStore) Queue(ctx context.Context, command *MeterCommand) error {
+	now := time.Now().UTC()
+	if command.RequestedAt.IsZero() {
+		command.RequestedAt = now
+	}
+
+	// An expired command no longer blocks queueing the same type again
+	_, err := s.collection.UpdateMany(ctx,
+		bson.M{
+			"serial_number": command.SerialNumber,
+			"type":          command.Type,
+			"status":        CommandStatusPending,
+			"expires_at":    bson.M{"$lte": now},
+		},
+		bson.M{"$set": bson.M{"status": CommandStatusExpired}, "$unset": bson.M{"open": ""}},
+	)
+	if err != nil {
+		return err
+	}
+
+	command.Status = CommandStatusPending
+	command.Open = true
+	result, err := s.collection.InsertOne(ctx, command)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	command.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoCommandStore) Get(ctx context.Context, id primitive.ObjectID) (*MeterCommand, error) {
+	var command MeterCommand
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&command)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
+
+func (s *mongoCommandStore) List(ctx context.Context, filter CommandFilter) ([]MeterCommand, error) {
+	query := bson.M{}
+	if filter.SerialNumber != "" {
+		query["serial_number"] = filter.SerialNumber
+	}
+	if filter.Open {
+		query["open"] = true
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "requested_at", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+	return s.find(ctx, query, opts)
+}
+
+func (s *mongoCommandStore) Deliver(ctx context.Context, serialNumber string, now time.Time) ([]MeterCommand, error) {
+	now = now.UTC()
+	// Commands delivered once are due until acknowledged even past their
+	// expiry, the meter may already be carrying them out
+	query := bson.M{
+		"serial_number": serialNumber,
+		"$or": bson.A{
+			bson.M{"status": CommandStatusPending, "expires_at": bson.M{"$gt": now}},
+			bson.M{"status": CommandStatusDelivered},
+		},
+	}
+	commands, err := s.find(ctx, query, options.Find().SetSort(bson.D{{Key: "requested_at", Value: 1}}))
+	if err != nil || len(commands) == 0 {
+		return commands, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(commands))
+	for _, command := range commands {
+		ids = append(ids, command.ID)
+	}
+	// A command cancelled since it was read is not marked, nor handed out
+	_, err = s.collection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "status": bson.M{"$in": bson.A{CommandStatusPending, CommandStatusDelivered}}},
+		bson.M{"$set": bson.M{"status": CommandStatusDelivered, "delivered_at": now}, "$inc": bson.M{"deliveries": 1}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.find(ctx, bson.M{"_id": bson.M{"$in": ids}, "status": CommandStatusDelivered},
+		options.Find().SetSort(bson.D{{Key: "requested_at", Value: 1}}))
+}
+
+func (s *mongoCommandStore) Complete(ctx context.Context, id primitive.ObjectID, serialNumber string, succeeded bool, result string, at time.Time) (*MeterCommand, error) {
+	status := CommandStatusFailed
+	if succeeded {
+		status = CommandStatusSucceeded
+	}
+	var command MeterCommand
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":           id,
+			"serial_number": serialNumber,
+			"status":        bson.M{"$in": bson.A{CommandStatusPending, CommandStatusDelivered}},
+		},
+		bson.M{
+			"$set":   bson.M{"status": status, "completed_at": at.UTC(), "result": result},
+			"$unset": bson.M{"open": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&command)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Commands of other meters are not told apart from unknown ones
+		existing, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if existing.SerialNumber != serialNumber {
+			return nil, ErrNotFound
+		}
+		return nil, ErrInvalidStatusTransition
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
+
+func (s *mongoCommandStore) Cancel(ctx context.Context, id primitive.ObjectID, userName string) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": CommandStatusPending},
+		bson.M{
+			"$set":   bson.M{"status": CommandStatusCancelled, "completed_at": time.Now().UTC(), "cancelled_by_name": userName},
+			"$unset": bson.M{"open": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if _, err := s.Get(ctx, id); err != nil {
+			return err
+		}
+		return ErrInvalidStatusTransition
+	}
+	return nil
+}
+
+func (s *mongoCommandStore) find(ctx context.Context, query bson.M, opts *options.FindOptions) ([]MeterCommand, error) {
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	commands := []MeterCommand{}
+	if err := cursor.All(ctx, &commands); err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCommandStore(t *testing.T) {
+	commands := New().Commands()
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	queue := func(commandType string, expiresAt time.Time) (*MeterCommand, error) {
+		command := &MeterCommand{
+			SerialNumber:    "SM-CMD-001",
+			Type:            commandType,
+			RequestedBy:     primitive.NewObjectID(),
+			RequestedByName: "Ana",
+			ExpiresAt:       expiresAt,
+		}
+		return command, commands.Queue(ctx, command)
+	}
+
+	disconnect, err := queue(CommandDisconnect, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Queue() error = %v", err)
+	}
+	if _, err := queue(CommandDisconnect, now.Add(time.Hour)); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Queue() of an open type error = %v, want ErrDuplicate", err)
+	}
+	if _, err := queue(CommandReadNow, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Queue() expired error = %v", err)
+	}
+	// The expired read_now is replaced, not a duplicate
+	readNow, err := queue(CommandReadNow, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Queue() after expiry error = %v", err)
+	}
+	syncClock, err := queue(CommandSyncClock, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Queue() error = %v", err)
+	}
+	if err := commands.Cancel(ctx, syncClock.ID, "Ana"); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+
+	delivered, err := commands.Deliver(ctx, "SM-CMD-001", now)
+	if err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	if len(delivered) != 2 || delivered[0].ID != disconnect.ID || delivered[1].ID != readNow.ID || delivered[0].Deliveries != 1 {
+		t.Fatalf("Deliver() = %+v, want the disconnect and the live read_now", delivered)
+	}
+	if err := commands.Cancel(ctx, disconnect.ID, "Ana"); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("Cancel() of a delivered command error = %v, want ErrInvalidStatusTransition", err)
+	}
+
+	// Unacknowledged commands are delivered again
+	again, err := commands.Deliver(ctx, "SM-CMD-001", now.Add(2*time.Hour))
+	if err != nil || len(again) != 2 || again[0].Deliveries != 2 {
+		t.Errorf("Deliver() again = %+v, %v", again, err)
+	}
+
+	if _, err := commands.Complete(ctx, disconnect.ID, "SM-CMD-002", true, "", now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Complete() by another meter error = %v, want ErrNotFound", err)
+	}
+	completed, err := commands.Complete(ctx, disconnect.ID, "SM-CMD-001", true, "relay open", now)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if completed.Status != CommandStatusSucceeded || completed.Type != CommandDisconnect || completed.Open {
+		t.Errorf("Complete() = %+v", completed)
+	}
+	if _, err := commands.Complete(ctx, disconnect.ID, "SM-CMD-001", false, "", now); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("Complete() twice error = %v, want ErrInvalidStatusTransition", err)
+	}
+	if _, err := queue(CommandDisconnect, now.Add(time.Hour)); err != nil {
+		t.Errorf("Queue() after Complete() error = %v", err)
+	}
+
+	// The new disconnect and the delivered read_now await the meter
+	open, err := commands.List(ctx, CommandFilter{SerialNumber: "SM-CMD-001", Open: true})
+	if err != nil || len(open) != 2 || open[0].Type != CommandDisconnect || open[1].ID != readNow.ID {
+		t.Errorf("List() of open commands = %+v, %v", open, err)
+	}
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ConnectivityTransition records a meter going online, stale or offline
+type ConnectivityTransition struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	SerialNumber string             `bson:"serial_number"`
+	From         string             `bson:"from,omitempty"` // empty the first time the meter is checked
+	To           string             `bson:"to"`
+	LastSeenAt   time.Time          `bson:"last_seen_at,omitempty"` // when the meter was last heard from
+	At           time.Time          `bson:"at"`
+}
+
+// ConnectivityFilter narrows ConnectivityStore.List, zero values match everything
+type ConnectivityFilter struct {
+	SerialNumber string
+	From         time.Time // inclusive
+	To           time.Time // exclusive
+}
+
+// ConnectivityStore persists the connectivity transitions of the meters
+type ConnectivityStore interface {
+	Record(ctx context.Context, transition *ConnectivityTransition) error
+	// List lists the transitions, oldest first
+	List(ctx context.Context, filter ConnectivityFilter) ([]ConnectivityTransition, error)
+}
+
+type mongoConnectivityStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoConnectivityStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "serial_number", Value: 1}, {Key: "at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "at", Value: 1}},
+		},
+	})
+	return err
+}
+
+func (s *mongoConnectivityStore) Record(ctx context.Context, transition *ConnectivityTransition) error {
+	if transition.At.IsZero() {
+		transition.At = time.Now().UTC()
+	}
+	result, err := s.collection.InsertOne(ctx, transition)
+	if err != nil {
+		return err
+	}
+	transition.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoConnectivityStore) List(ctx context.Context, filter ConnectivityFilter) ([]ConnectivityTransition, error) {
+	query := bson.M{}
+	if filter.SerialNumber != "" {
+		query["serial_number"] = filter.SerialNumber
+	}
+	at := bson.M{}
+	if !filter.From.IsZero() {
+		at["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		at["$lt"] = filter.To
+	}
+	if len(at) > 0 {
+		query["at"] = at
+	}
+
+	cursor, err := s.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	transitions := []ConnectivityTransition{}
+	if err := cursor.All(ctx, &transitions); err != nil {
+		return nil, err
+	}
+	return transitions, nil
+}
+
+// Outage is a stretch of time a meter was offline. It starts when the meter
+// was last heard from before going offline and ends when it was heard from
+// again; End is zero while the meter is still offline.
+type Outage struct {
+	SerialNumber string
+	Start        time.Time
+	End          time.Time
+}
+
+// Duration returns how long the outage lasted, or has lasted by now
+func (o Outage) Duration(now time.Time) time.Duration {
+	if o.End.IsZero() {
+		return now.Sub(o.Start)
+	}
+	return o.End.Sub(o.Start)
+}
+
+// Outages pairs each transition to offline with the next transition of the
+// meter out of offline. The transitions must be oldest first; the outages
+// are returned most recent first.
+func Outages(transitions []ConnectivityTransition) []Outage {
+	open := map[string]int{}
+	outages := []Outage{}
+	for _, transition := range transitions {
+		i, offline := open[transition.SerialNumber]
+		switch {
+		case transition.To == ConnectivityOffline && !offline:
+			start := transition.LastSeenAt
+			if start.IsZero() {
+				start = transition.At
+			}
+			open[transition.SerialNumber] = len(outages)
+			outages = append(outages, Outage{SerialNumber: transition.SerialNumber, Start: start})
+		case transition.To != ConnectivityOffline && offline:
+			outages[i].End = transition.LastSeenAt
+			if outages[i].End.IsZero() {
+				outages[i].End = transition.At
+			}
+			delete(open, transition.SerialNumber)
+		}
+	}
+	sort.SliceStable(outages, func(i, j int) bool { return outages[i].Start.After(outages[j].Start) })
+	return outages
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConnectivityStore(t *testing.T) {
+	connectivity := New().Connectivity()
+	ctx := context.Background()
+
+	at := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	for _, transition := range []*ConnectivityTransition{
+		{SerialNumber: "SM-CONN-001", To: ConnectivityOnline, At: at},
+		{SerialNumber: "SM-CONN-001", From: ConnectivityOnline, To: ConnectivityOffline, LastSeenAt: at, At: at.Add(time.Hour)},
+		{SerialNumber: "SM-CONN-002", To: ConnectivityOffline, At: at.Add(2 * time.Hour)},
+	} {
+		if err := connectivity.Record(ctx, transition); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	listed, err := connectivity.List(ctx, ConnectivityFilter{SerialNumber: "SM-CONN-001", From: at.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(listed) != 1 || listed[0].To != ConnectivityOffline || !listed[0].LastSeenAt.Equal(at) {
+		t.Errorf("List() = %+v", listed)
+	}
+}
+
+func TestOutages(t *testing.T) {
+	at := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	outages := Outages([]ConnectivityTransition{
+		{SerialNumber: "A", To: ConnectivityStale, LastSeenAt: at, At: at.Add(20 * time.Minute)},
+		{SerialNumber: "A", From: ConnectivityStale, To: ConnectivityOffline, LastSeenAt: at, At: at.Add(time.Hour)},
+		{SerialNumber: "B", To: ConnectivityOffline, At: at.Add(time.Hour)},
+		{SerialNumber: "A", From: ConnectivityOffline, To: ConnectivityOnline, LastSeenAt: at.Add(3 * time.Hour), At: at.Add(3 * time.Hour)},
+	})
+	if len(outages) != 2 {
+		t.Fatalf("Outages() = %+v", outages)
+	}
+	if outages[0].SerialNumber != "B" || !outages[0].End.IsZero() || outages[0].Duration(at.Add(2*time.Hour)) != time.Hour {
+		t.Errorf("Outages()[0] = %+v, want B ongoing since it was checked", outages[0])
+	}
+	if outages[1].SerialNumber != "A" || outages[1].Duration(time.Time{}) != 3*time.Hour {
+		t.Errorf("Outages()[1] = %+v, want A down 3h from when last seen", outages[1])
+	}
+}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Consumer account types, matching web.ConsumerAccountTypeData
+const (
+	ConsumerTypeResidential = "residential"
+	ConsumerTypeCommercial  = "commercial"
+	ConsumerTypeIndustrial  = "industrial"
+)
+
+// Consumer account statuses, matching web.ConsumerAccountStatusData
+const (
+	ConsumerStatusActive   = "active"
+	ConsumerStatusInactive = "inactive"
+)
+
+// Consumer is a customer account, holding the fields of NewConsumerAccountForm
+type Consumer struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty"`
+	AccountNumber    string             `bson:"account_number"`
+	FirstName        string             `bson:"first_name"`
+	MiddleName       string             `bson:"middle_name"`
+	LastName         string             `bson:"last_name"`
+	Suffix           string             `bson:"suffix"`
+	BirthDate        time.Time          `bson:"birth_date"`
+	Province         string             `bson:"province"`
+	PostalCode       string             `bson:"postal_code"`
+	CityMunicipality string             `bson:"city_municipality"`
+	Barangay         string             `bson:"barangay"`
+	HouseStreet      string             `bson:"house_street"`
+	PhoneNumber      string             `bson:"phone_number"`
+	Email            string             `bson:"email"`
+	AccountType      string             `bson:"account_type"`
+	TransformerID    string             `bson:"transformer_id"`
+	SNID             string             `bson:"snid"`
+	Book             string             `bson:"book"` // reading route, billing.Books
+	Status           string             `bson:"status"`
+	CreatedAt        time.Time          `bson:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at"`
+}
+
+// FullName joins the name parts, skipping the empty ones
+func (c *Consumer) FullName() string {
+	return strings.Join(strings.Fields(strings.Join([]string{c.FirstName, c.MiddleName, c.LastName, c.Suffix}, " ")), " ")
+}
+
+// Address joins the address parts from the most to the least specific
+func (c *Consumer) Address() string {
+	parts := []string{}
+	for _, part := range []string{c.HouseStreet, c.Barangay, c.CityMunicipality, strings.TrimSpace(c.Province + " " + c.PostalCode)} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ConsumerFilter narrows ConsumerStore.List, zero values match everything
+type ConsumerFilter struct {
+	Search      string // matched against the account number and the name parts
+	AccountType string
+	Status      string
+	Email       string   // matched whole, ignoring case
+	Books       []string // when non-nil, consumers of any of these books; "" matches those without one
+}
+
+// ConsumerStore persists consumer accounts
+type ConsumerStore interface {
+	Create(ctx context.Context, consumer *Consumer) error
+	Get(ctx context.Context, accountNumber string) (*Consumer, error)
+	GetByID(ctx context.Context, id primitive.ObjectID) (*Consumer, error)
+	Update(ctx context.Context, consumer *Consumer) error
+	List(ctx context.Context, filter ConsumerFilter) ([]Consumer, error)
+}
+
+type mongoConsumerStore struct {
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+func (s *mongoConsumerStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "account_number", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "last_name", Value: 1}, {Key: "first_name", Value: 1}},
+		},
+	})
+	return err
+}
+
+// Create stores the consumer under the next free account number
+func (s *mongoConsumerStore) Create(ctx context.Context, consumer *Consumer) error {
+	seq, err := nextSequence(ctx, s.counters, "consumer_account_number")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	consumer.AccountNumber = fmt.Sprintf("C%06d", seq)
+	if consumer.Status == "" {
+		consumer.Status = ConsumerStatusActive
+	}
+	consumer.CreatedAt = now
+	consumer.UpdatedAt = now
+
+	result, err := s.collection.InsertOne(ctx, consumer)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	consumer.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoConsumerStore) Get(ctx context.Context, accountNumber string) (*Consumer, error) {
+	return s.findOne(ctx, bson.M{"account_number": accountNumber})
+}
+
+func (s *mongoConsumerStore) GetByID(ctx context.Context, id primitive.ObjectID) (*Consumer, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+func (s *mongoConsumerStore) findOne(ctx context.Context, filter bson.M) (*Consumer, error) {
+	var consumer Consumer
+	err := s.collection.FindOne(ctx, filter).Decode(&consumer)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &consumer, nil
+}
+
+// Update saves the editable fields; the account number never changes
+func (s *mongoConsumerStore) Update(ctx context.Context, consumer *Consumer) error {
+	consumer.UpdatedAt = time.Now().UTC()
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"account_number": consumer.AccountNumber},
+		bson.M{"$set": bson.M{
+			"first_name":        consumer.FirstName,
+			"middle_name":       consumer.MiddleName,
+			"last_name":         consumer.LastName,
+			"suffix":            consumer.Suffix,
+			"birth_date":        consumer.BirthDate,
+			"province":          consumer.Province,
+			"postal_code":       consumer.PostalCode,
+			"city_municipality": consumer.CityMunicipality,
+			"barangay":          consumer.Barangay,
+			"house_street":      consumer.HouseStreet,
+			"phone_number":      consumer.PhoneNumber,
+			"email":             consumer.Email,
+			"account_type":      consumer.AccountType,
+			"transformer_id":    consumer.TransformerID,
+			"snid":              consumer.SNID,
+			"book":              consumer.Book,
+			"status":            consumer.Status,
+			"updated_at":        consumer.UpdatedAt,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoConsumerStore) List(ctx context.Context, filter ConsumerFilter) ([]Consumer, error) {
+	query := bson.M{}
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(search), Options: "i"}
+		query["$or"] = bson.A{
+			bson.M{"account_number": pattern},
+			bson.M{"first_name": pattern},
+			bson.M{"middle_name": pattern},
+			bson.M{"last_name": pattern},
+		}
+	}
+	if filter.AccountType != "" {
+		query["account_type"] = filter.AccountType
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if email := strings.TrimSpace(filter.Email); email != "" {
+		query["email"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(email) + "$", Options: "i"}
+	}
+	if filter.Books != nil {
+		books := bson.A{}
+		for _, book := range filter.Books {
+			books = append(books, book)
+			if book == "" {
+				books = append(books, nil) // stored before books existed
+			}
+		}
+		query["book"] = bson.M{"$in": books}
+	}
+
+	cursor, err := s.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "account_number", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	consumers := []Consumer{}
+	if err := cursor.All(ctx, &consumers); err != nil {
+		return nil, err
+	}
+	return consumers, nil
+}
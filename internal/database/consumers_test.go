@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestConsumerFullNameAndAddress(t *testing.T) {
+	consumer := Consumer{
+		FirstName:        "Juan",
+		LastName:         "Dela Cruz",
+		Suffix:           "Jr.",
+		HouseStreet:      "123 Rizal St.",
+		Barangay:         "Poblacion",
+		CityMunicipality: "Calatagan",
+		Province:         "Batangas",
+		PostalCode:       "4215",
+	}
+	if got, want := consumer.FullName(), "Juan Dela Cruz Jr."; got != want {
+		t.Errorf("FullName() = %q, want %q", got, want)
+	}
+	if got, want := consumer.Address(), "123 Rizal St., Poblacion, Calatagan, Batangas 4215"; got != want {
+		t.Errorf("Address() = %q, want %q", got, want)
+	}
+}
+
+func TestConsumerStore(t *testing.T) {
+	db := New()
+	consumers := db.Consumers()
+	ctx := context.Background()
+
+	consumer := &Consumer{FirstName: "Juan", LastName: "Dela Cruz", AccountType: ConsumerTypeResidential}
+	if err := consumers.Create(ctx, consumer); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if consumer.AccountNumber == "" || consumer.Status != ConsumerStatusActive {
+		t.Errorf("Create() = %+v", consumer)
+	}
+
+	other := &Consumer{FirstName: "Maria", LastName: "Santos"}
+	if err := consumers.Create(ctx, other); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if other.AccountNumber == consumer.AccountNumber {
+		t.Errorf("Create() reused account number %q", other.AccountNumber)
+	}
+
+	consumer.PhoneNumber = "09171234567"
+	if err := consumers.Update(ctx, consumer); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	got, err := consumers.Get(ctx, consumer.AccountNumber)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.PhoneNumber != "09171234567" {
+		t.Errorf("Get() = %+v", got)
+	}
+	if _, err := consumers.Get(ctx, "C999999"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() unknown account error = %v, want %v", err, ErrNotFound)
+	}
+
+	listed, err := consumers.List(ctx, ConsumerFilter{Search: "dela"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(listed) != 1 || listed[0].AccountNumber != consumer.AccountNumber {
+		t.Errorf("List() = %+v", listed)
+	}
+
+	meter := &Meter{SerialNumber: "SM-TEST-CONSUMER"}
+	if err := db.Meters().Create(ctx, meter); err != nil {
+		t.Fatalf("Meters().Create() error = %v", err)
+	}
+	if err := db.Meters().AssignConsumer(ctx, meter.SerialNumber, consumer.ID); err != nil {
+		t.Fatalf("AssignConsumer() error = %v", err)
+	}
+	linked, err := db.Meters().List(ctx, MeterFilter{ConsumerID: consumer.ID})
+	if err != nil {
+		t.Fatalf("Meters().List() error = %v", err)
+	}
+	if len(linked) != 1 || linked[0].SerialNumber != meter.SerialNumber {
+		t.Errorf("Meters().List() by consumer = %+v", linked)
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Billing cycle statuses. A cycle is open while its bills are drafted and
+// issued once they all went out; an open cycle is resumed by the next run.
+const (
+	CycleStatusOpen   = "open"
+	CycleStatusIssued = "issued"
+)
+
+// BillingCycle records the closing of one book for one billing period
+type BillingCycle struct {
+	Book        string    `bson:"book"`
+	PeriodStart time.Time `bson:"period_start"`
+	PeriodEnd   time.Time `bson:"period_end"` // exclusive, the read date
+	Status      string    `bson:"status"`
+	Bills       int64     `bson:"bills"` // bills of the cycle when it was issued
+	OpenedAt    time.Time `bson:"opened_at"`
+	IssuedAt    time.Time `bson:"issued_at,omitempty"`
+}
+
+// BillingCycleStore tracks which cycles were closed
+type BillingCycleStore interface {
+	// Open records the cycle as open unless it is already recorded, and
+	// returns the stored cycle
+	Open(ctx context.Context, book string, periodStart, periodEnd time.Time) (*BillingCycle, error)
+	// Issue marks the cycle issued with the number of bills it issued
+	Issue(ctx context.Context, book string, periodStart time.Time, bills int64) error
+	// Latest returns the cycle of the book with the latest period
+	Latest(ctx context.Context, book string) (*BillingCycle, error)
+}
+
+type mongoBillingCycleStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoBillingCycleStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "book", Value: 1}, {Key: "period_start", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (s *mongoBillingCycleStore) Open(ctx context.Context, book string, periodStart, periodEnd time.Time) (*BillingCycle, error) {
+	var cycle BillingCycle
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"book": book, "period_start": periodStart},
+		bson.M{"$setOnInsert": BillingCycle{
+			Book:        book,
+			PeriodStart: periodStart,
+			PeriodEnd:   periodEnd,
+			Status:      CycleStatusOpen,
+			OpenedAt:    time.Now().UTC(),
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&cycle)
+	if err != nil {
+		return nil, err
+	}
+	return &cycle, nil
+}
+
+func (s *mongoBillingCycleStore) Issue(ctx context.Context, book string, periodStart time.Time, bills int64) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"book": book, "period_start": periodStart},
+		bson.M{"$set": bson.M{"status": CycleStatusIssued, "bills": bills, "issued_at": time.Now().UTC()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoBillingCycleStore) Latest(ctx context.Context, book string) (*BillingCycle, error) {
+	var cycle BillingCycle
+	err := s.collection.FindOne(ctx,
+		bson.M{"book": book},
+		options.FindOne().SetSort(bson.D{{Key: "period_start", Value: -1}}),
+	).Decode(&cycle)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cycle, nil
+}
@@ -2,18 +2,35 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Service interface {
 	Health() map[string]string
+	Users() UserStore
+	Sessions() SessionStore
+	Meters() MeterStore
+	Consumers() ConsumerStore
+	Readings() ReadingStore
+	Rollups() RollupStore
+	RateSchedules() RateScheduleStore
+	Bills() BillStore
+	BillingCycles() BillingCycleStore
+	Leases() LeaseStore
+	Payments() PaymentStore
+	Ledger() LedgerStore
+	Connectivity() ConnectivityStore
+	Alerts() AlertStore
+	Commands() CommandStore
 }
 
 type service struct {
@@ -21,21 +38,41 @@ type service struct {
 }
 
 var (
-	host = os.Getenv("BLUEPRINT_DB_HOST")
-	port = os.Getenv("BLUEPRINT_DB_PORT")
-	//database = os.Getenv("BLUEPRINT_DB_DATABASE")
+	host     = os.Getenv("BLUEPRINT_DB_HOST")
+	port     = os.Getenv("BLUEPRINT_DB_PORT")
+	database = os.Getenv("BLUEPRINT_DB_DATABASE")
+)
+
+var (
+	// ErrNotFound is returned when a lookup matches no document
+	ErrNotFound = errors.New("database: not found")
+	// ErrDuplicate is returned when an insert or update violates a unique index
+	ErrDuplicate = errors.New("database: duplicate key")
+	// ErrConflict is returned when a document changed between being read and
+	// being updated; the caller should read it again and retry
+	ErrConflict = errors.New("database: concurrent update")
 )
 
 func New() Service {
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(fmt.Sprintf("mongodb://%s:%s", host, port)))
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(fmt.Sprintf("mongodb://%s:%s", host, port)).SetRegistry(newRegistry()))
 
 	if err != nil {
 		log.Fatal(err)
 
 	}
-	return &service{
+	s := &service{
 		db: client,
 	}
+
+	// The unique indexes are what refuses duplicate accounts, bills and
+	// ledger entries, so the process does not start without them
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.ensureIndexes(ctx); err != nil {
+		log.Fatalf("could not ensure database indexes: %v", err)
+	}
+
+	return s
 }
 
 func (s *service) Health() map[string]string {
@@ -51,3 +88,126 @@ func (s *service) Health() map[string]string {
 		"message": "It's healthy",
 	}
 }
+
+func (s *service) Users() UserStore {
+	return &mongoUserStore{collection: s.collection("users")}
+}
+
+func (s *service) Sessions() SessionStore {
+	return &mongoSessionStore{collection: s.collection("sessions")}
+}
+
+func (s *service) Meters() MeterStore {
+	return &mongoMeterStore{collection: s.collection("meters")}
+}
+
+func (s *service) Consumers() ConsumerStore {
+	return &mongoConsumerStore{collection: s.collection("consumers"), counters: s.collection("counters")}
+}
+
+func (s *service) Readings() ReadingStore {
+	return &mongoReadingStore{collection: s.collection("readings")}
+}
+
+func (s *service) Rollups() RollupStore {
+	return &mongoRollupStore{collection: s.collection("reading_rollups"), readings: s.collection("readings")}
+}
+
+func (s *service) RateSchedules() RateScheduleStore {
+	return &mongoRateScheduleStore{collection: s.collection("rate_schedules"), counters: s.collection("counters")}
+}
+
+func (s *service) Bills() BillStore {
+	return &mongoBillStore{collection: s.collection("bills"), counters: s.collection("counters")}
+}
+
+func (s *service) BillingCycles() BillingCycleStore {
+	return &mongoBillingCycleStore{collection: s.collection("billing_cycles")}
+}
+
+func (s *service) Leases() LeaseStore {
+	return &mongoLeaseStore{collection: s.collection("leases")}
+}
+
+func (s *service) Payments() PaymentStore {
+	return &mongoPaymentStore{collection: s.collection("payments"), counters: s.collection("counters")}
+}
+
+func (s *service) Ledger() LedgerStore {
+	return &mongoLedgerStore{collection: s.collection("ledger")}
+}
+
+func (s *service) Connectivity() ConnectivityStore {
+	return &mongoConnectivityStore{collection: s.collection("meter_connectivity")}
+}
+
+func (s *service) Alerts() AlertStore {
+	return &mongoAlertStore{collection: s.collection("alerts")}
+}
+
+func (s *service) Commands() CommandStore {
+	return &mongoCommandStore{collection: s.collection("meter_commands")}
+}
+
+// collection returns a handle to the named collection in the application database
+func (s *service) collection(name string) *mongo.Collection {
+	dbName := database
+	if dbName == "" {
+		dbName = "smartmeter"
+	}
+	return s.db.Database(dbName).Collection(name)
+}
+
+// indexer is implemented by stores that need indexes on their collection
+type indexer interface {
+	ensureIndexes(ctx context.Context) error
+}
+
+// ensureIndexes creates the indexes every store relies on, trying every
+// store and returning the failures of all
+func (s *service) ensureIndexes(ctx context.Context) error {
+	stores := []struct {
+		name  string
+		store indexer
+	}{
+		{"users", &mongoUserStore{collection: s.collection("users")}},
+		{"sessions", &mongoSessionStore{collection: s.collection("sessions")}},
+		{"meters", &mongoMeterStore{collection: s.collection("meters")}},
+		{"consumers", &mongoConsumerStore{collection: s.collection("consumers")}},
+		{"readings", &mongoReadingStore{collection: s.collection("readings")}},
+		{"reading_rollups", &mongoRollupStore{collection: s.collection("reading_rollups")}},
+		{"rate_schedules", &mongoRateScheduleStore{collection: s.collection("rate_schedules")}},
+		{"bills", &mongoBillStore{collection: s.collection("bills")}},
+		{"billing_cycles", &mongoBillingCycleStore{collection: s.collection("billing_cycles")}},
+		{"payments", &mongoPaymentStore{collection: s.collection("payments")}},
+		{"ledger", &mongoLedgerStore{collection: s.collection("ledger")}},
+		{"meter_connectivity", &mongoConnectivityStore{collection: s.collection("meter_connectivity")}},
+		{"alerts", &mongoAlertStore{collection: s.collection("alerts")}},
+		{"meter_commands", &mongoCommandStore{collection: s.collection("meter_commands")}},
+	}
+
+	var errs []error
+	for _, item := range stores {
+		if err := item.store.ensureIndexes(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", item.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// nextSequence atomically increments and returns the named counter, used for
+// human readable numbers such as consumer account numbers
+func nextSequence(ctx context.Context, counters *mongo.Collection, name string) (int64, error) {
+	var counter struct {
+		Value int64 `bson:"value"`
+	}
+	err := counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"value": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return counter.Value, nil
+}
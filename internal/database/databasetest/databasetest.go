@@ -0,0 +1,302 @@
+// Package databasetest provides in-memory stores for the tests of code
+// using the database service. Each store implements only the methods those
+// tests exercise; calling any other one panics on the nil embedded store.
+package databasetest
+
+import (
+	"SmartMeterSystem/internal/database"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Service returns the stores set on it. Stores left nil panic when used.
+type Service struct {
+	database.Service
+	UserStore         *UserStore
+	ConsumerStore     *ConsumerStore
+	RateScheduleStore *RateScheduleStore
+	BillStore         *BillStore
+	BillingCycleStore *BillingCycleStore
+	LedgerStore       *LedgerStore
+	CommandStore      *CommandStore
+	LeaseStore        *LeaseStore
+	PaymentStore      *PaymentStore
+	MeterStore        *MeterStore
+}
+
+func (s *Service) Users() database.UserStore                 { return s.UserStore }
+func (s *Service) Consumers() database.ConsumerStore         { return s.ConsumerStore }
+func (s *Service) RateSchedules() database.RateScheduleStore { return s.RateScheduleStore }
+func (s *Service) Bills() database.BillStore                 { return s.BillStore }
+func (s *Service) BillingCycles() database.BillingCycleStore { return s.BillingCycleStore }
+func (s *Service) Ledger() database.LedgerStore              { return s.LedgerStore }
+func (s *Service) Commands() database.CommandStore           { return s.CommandStore }
+func (s *Service) Leases() database.LeaseStore               { return s.LeaseStore }
+func (s *Service) Payments() database.PaymentStore           { return s.PaymentStore }
+func (s *Service) Meters() database.MeterStore               { return s.MeterStore }
+
+// UserStore finds the users it holds by ID
+type UserStore struct {
+	database.UserStore
+	Users []database.User
+}
+
+func (s *UserStore) FindByID(_ context.Context, id primitive.ObjectID) (*database.User, error) {
+	for _, user := range s.Users {
+		if user.ID == id {
+			return &user, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+// ConsumerStore lists the consumers it holds, ignoring the filter
+type ConsumerStore struct {
+	database.ConsumerStore
+	Consumers []database.Consumer
+}
+
+func (s *ConsumerStore) Get(_ context.Context, accountNumber string) (*database.Consumer, error) {
+	for _, consumer := range s.Consumers {
+		if consumer.AccountNumber == accountNumber {
+			return &consumer, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (s *ConsumerStore) List(context.Context, database.ConsumerFilter) ([]database.Consumer, error) {
+	return slices.Clone(s.Consumers), nil
+}
+
+// MeterStore finds the meters it holds by serial number and sets their
+// device tokens
+type MeterStore struct {
+	database.MeterStore
+	Meters []database.Meter
+}
+
+func (s *MeterStore) Get(_ context.Context, serialNumber string) (*database.Meter, error) {
+	for _, meter := range s.Meters {
+		if meter.SerialNumber == serialNumber {
+			return &meter, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (s *MeterStore) SetDeviceToken(_ context.Context, serialNumber, tokenHash string) error {
+	i := slices.IndexFunc(s.Meters, func(meter database.Meter) bool { return meter.SerialNumber == serialNumber })
+	if i < 0 {
+		return database.ErrNotFound
+	}
+	s.Meters[i].DeviceTokenHash = tokenHash
+	return nil
+}
+
+// RateScheduleStore records the created schedules as pending versions
+type RateScheduleStore struct {
+	database.RateScheduleStore
+	Created []database.RateSchedule
+}
+
+func (s *RateScheduleStore) Create(_ context.Context, schedule *database.RateSchedule) error {
+	schedule.ID = primitive.NewObjectID()
+	schedule.Version = len(s.Created) + 1
+	if schedule.Status == "" {
+		schedule.Status = database.RateStatusPending
+	}
+	s.Created = append(s.Created, *schedule)
+	return nil
+}
+
+// BillStore holds bills in the order given
+type BillStore struct {
+	database.BillStore
+	Bills []database.Bill
+}
+
+func (s *BillStore) ListCycle(_ context.Context, book string, periodStart time.Time) ([]database.Bill, error) {
+	bills := []database.Bill{}
+	for _, bill := range s.Bills {
+		if bill.Book == book && bill.PeriodStart.Equal(periodStart) {
+			bills = append(bills, bill)
+		}
+	}
+	return bills, nil
+}
+
+func (s *BillStore) ListUnpaid(_ context.Context, consumerID primitive.ObjectID) ([]database.Bill, error) {
+	bills := []database.Bill{}
+	for _, bill := range s.Bills {
+		if bill.ConsumerID == consumerID && (bill.Status == database.BillStatusIssued || bill.Status == database.BillStatusOverdue) {
+			bills = append(bills, bill)
+		}
+	}
+	return bills, nil
+}
+
+func (s *BillStore) Issue(_ context.Context, id primitive.ObjectID, issuedAt, dueDate time.Time) error {
+	i := slices.IndexFunc(s.Bills, func(bill database.Bill) bool { return bill.ID == id })
+	if i < 0 || s.Bills[i].Status != database.BillStatusDraft {
+		return database.ErrInvalidStatusTransition
+	}
+	s.Bills[i].Status = database.BillStatusIssued
+	s.Bills[i].IssuedAt = issuedAt
+	s.Bills[i].DueDate = dueDate
+	return nil
+}
+
+// BillingCycleStore opens every cycle asked for and records the last issued
+type BillingCycleStore struct {
+	database.BillingCycleStore
+	Issued *database.BillingCycle
+}
+
+func (s *BillingCycleStore) Open(_ context.Context, book string, periodStart, periodEnd time.Time) (*database.BillingCycle, error) {
+	return &database.BillingCycle{Book: book, PeriodStart: periodStart, PeriodEnd: periodEnd, Status: database.CycleStatusOpen}, nil
+}
+
+func (s *BillingCycleStore) Issue(_ context.Context, book string, periodStart time.Time, bills int64) error {
+	s.Issued = &database.BillingCycle{Book: book, PeriodStart: periodStart, Status: database.CycleStatusIssued, Bills: bills}
+	return nil
+}
+
+// LedgerStore appends entries once per source, failing every append while
+// Err is set
+type LedgerStore struct {
+	database.LedgerStore
+	Entries []database.LedgerEntry
+	Err     error
+}
+
+func (s *LedgerStore) Append(_ context.Context, entry *database.LedgerEntry) error {
+	if s.Err != nil {
+		return s.Err
+	}
+	if slices.ContainsFunc(s.Entries, func(e database.LedgerEntry) bool {
+		return e.Type == entry.Type && e.SourceID == entry.SourceID
+	}) {
+		return database.ErrDuplicate
+	}
+	s.Entries = append(s.Entries, *entry)
+	return nil
+}
+
+func (s *LedgerStore) Balance(_ context.Context, consumerID primitive.ObjectID) (decimal.Decimal, error) {
+	balance := decimal.Zero
+	for _, entry := range s.Entries {
+		if entry.ConsumerID == consumerID {
+			balance = balance.Add(entry.Amount)
+		}
+	}
+	return balance, nil
+}
+
+// LeaseStore holds leases by name, ignoring their expiry
+type LeaseStore struct {
+	database.LeaseStore
+	Holders map[string]string
+}
+
+func (s *LeaseStore) Acquire(_ context.Context, name, holder string, _ time.Duration) (bool, error) {
+	if current, ok := s.Holders[name]; ok && current != holder {
+		return false, nil
+	}
+	if s.Holders == nil {
+		s.Holders = map[string]string{}
+	}
+	s.Holders[name] = holder
+	return true, nil
+}
+
+func (s *LeaseStore) Release(_ context.Context, name, holder string) error {
+	if s.Holders[name] == holder {
+		delete(s.Holders, name)
+	}
+	return nil
+}
+
+// PaymentStore numbers the payments it holds in the order created
+type PaymentStore struct {
+	database.PaymentStore
+	Payments []database.Payment
+}
+
+func (s *PaymentStore) Create(_ context.Context, payment *database.Payment) error {
+	payment.ID = primitive.NewObjectID()
+	payment.ReceiptNumber = fmt.Sprintf("OR%08d", len(s.Payments)+1)
+	s.Payments = append(s.Payments, *payment)
+	return nil
+}
+
+func (s *PaymentStore) ListUnentered(_ context.Context, consumerID primitive.ObjectID) ([]database.Payment, error) {
+	payments := []database.Payment{}
+	for _, payment := range s.Payments {
+		if !payment.Entered && (consumerID.IsZero() || payment.ConsumerID == consumerID) {
+			payments = append(payments, payment)
+		}
+	}
+	return payments, nil
+}
+
+func (s *PaymentStore) MarkEntered(_ context.Context, id primitive.ObjectID) error {
+	i := slices.IndexFunc(s.Payments, func(payment database.Payment) bool { return payment.ID == id })
+	if i < 0 {
+		return database.ErrNotFound
+	}
+	s.Payments[i].Entered = true
+	return nil
+}
+
+// CommandStore lists, delivers and cancels the commands it holds like the
+// MongoDB store, ignoring expiry
+type CommandStore struct {
+	database.CommandStore
+	Commands []database.MeterCommand
+}
+
+func (s *CommandStore) List(_ context.Context, filter database.CommandFilter) ([]database.MeterCommand, error) {
+	commands := []database.MeterCommand{}
+	for _, command := range s.Commands {
+		if (filter.SerialNumber == "" || command.SerialNumber == filter.SerialNumber) && (!filter.Open || commandOpen(command)) {
+			commands = append(commands, command)
+		}
+	}
+	return commands, nil
+}
+
+func (s *CommandStore) Deliver(_ context.Context, serialNumber string, now time.Time) ([]database.MeterCommand, error) {
+	delivered := []database.MeterCommand{}
+	for i, command := range s.Commands {
+		if command.SerialNumber == serialNumber && commandOpen(command) {
+			s.Commands[i].Status = database.CommandStatusDelivered
+			s.Commands[i].DeliveredAt = now
+			delivered = append(delivered, s.Commands[i])
+		}
+	}
+	return delivered, nil
+}
+
+func (s *CommandStore) Cancel(_ context.Context, id primitive.ObjectID, userName string) error {
+	i := slices.IndexFunc(s.Commands, func(command database.MeterCommand) bool { return command.ID == id })
+	if i < 0 {
+		return database.ErrNotFound
+	}
+	if s.Commands[i].Status != database.CommandStatusPending {
+		return database.ErrInvalidStatusTransition
+	}
+	s.Commands[i].Status = database.CommandStatusCancelled
+	s.Commands[i].CancelledByName = userName
+	return nil
+}
+
+// commandOpen reports whether the command still awaits its meter
+func commandOpen(command database.MeterCommand) bool {
+	return command.Status == database.CommandStatusPending || command.Status == database.CommandStatusDelivered
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newRegistry returns the default BSON registry extended to store
+// decimal.Decimal values as Decimal128, so money never passes through floats
+func newRegistry() *bsoncodec.Registry {
+	registry := bson.NewRegistry()
+	decimalType := reflect.TypeOf(decimal.Decimal{})
+	registry.RegisterTypeEncoder(decimalType, bsoncodec.ValueEncoderFunc(encodeDecimal))
+	registry.RegisterTypeDecoder(decimalType, bsoncodec.ValueDecoderFunc(decodeDecimal))
+	return registry
+}
+
+func encodeDecimal(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	value, err := primitive.ParseDecimal128(val.Interface().(decimal.Decimal).String())
+	if err != nil {
+		return err
+	}
+	return vw.WriteDecimal128(value)
+}
+
+func decodeDecimal(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	var text string
+	switch vr.Type() {
+	case bsontype.Decimal128:
+		value, err := vr.ReadDecimal128()
+		if err != nil {
+			return err
+		}
+		text = value.String()
+	case bsontype.String:
+		value, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+		text = value
+	case bsontype.Null:
+		val.Set(reflect.ValueOf(decimal.Decimal{}))
+		return vr.ReadNull()
+	default:
+		return fmt.Errorf("cannot decode %v into a decimal", vr.Type())
+	}
+
+	value, err := decimal.NewFromString(text)
+	if err != nil {
+		return err
+	}
+	val.Set(reflect.ValueOf(value))
+	return nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LeaseStore grants named leases so that background jobs run on only one of
+// several server instances at a time. A lease expires unless renewed, so the
+// job moves to another instance when its holder dies.
+type LeaseStore interface {
+	// Acquire takes or renews the named lease for holder until ttl from now.
+	// It reports false while another holder's lease is unexpired.
+	Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	// Release gives the lease up if holder still holds it
+	Release(ctx context.Context, name, holder string) error
+}
+
+type mongoLeaseStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoLeaseStore) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	// A lease held by someone else matches neither branch, so the upsert
+	// tries to insert a second document with its _id and fails
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": name, "$or": bson.A{
+			bson.M{"holder": holder},
+			bson.M{"expires_at": bson.M{"$lte": now}},
+		}},
+		bson.M{"$set": bson.M{"holder": holder, "expires_at": now.Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *mongoLeaseStore) Release(ctx context.Context, name, holder string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": name, "holder": holder})
+	return err
+}
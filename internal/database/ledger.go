@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ledger entry types. Bills, surcharges and refunds raise what the consumer
+// owes; payments lower it; adjustments go either way.
+const (
+	LedgerTypeBill       = "bill"
+	LedgerTypePayment    = "payment"
+	LedgerTypeAdjustment = "adjustment"
+	LedgerTypeSurcharge  = "surcharge"
+	LedgerTypeRefund     = "refund"
+)
+
+// LedgerEntry is one movement on the account of a consumer. Amount is
+// positive when it raises what the consumer owes and negative when it
+// lowers it, so the balance is the sum of the entries. Entries are never
+// changed or removed; a mistake is corrected by an adjustment.
+type LedgerEntry struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	ConsumerID    primitive.ObjectID `bson:"consumer_id"`
+	AccountNumber string             `bson:"account_number"`
+	Type          string             `bson:"type"`
+	Amount        decimal.Decimal    `bson:"amount"`
+	Description   string             `bson:"description"`
+	Reference     string             `bson:"reference"`            // bill or receipt number
+	SourceID      primitive.ObjectID `bson:"source_id,omitempty"`  // the bill or payment entered, at most once per type
+	Reason        string             `bson:"reason,omitempty"`     // why an employee made the entry
+	CreatedBy     primitive.ObjectID `bson:"created_by,omitempty"` // empty for entries made by the system
+	CreatedByName string             `bson:"created_by_name,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at"`
+}
+
+// BillLedgerEntry is the entry charging a bill to its consumer, made before
+// the bill is issued
+func BillLedgerEntry(bill *Bill) *LedgerEntry {
+	return &LedgerEntry{
+		ConsumerID:    bill.ConsumerID,
+		AccountNumber: bill.AccountNumber,
+		Type:          LedgerTypeBill,
+		Amount:        bill.Total,
+		Description:   "Bill for " + bill.PeriodStart.In(RollupLocation).Format("Jan 2006"),
+		Reference:     bill.Number,
+		SourceID:      bill.ID,
+	}
+}
+
+// SurchargeLedgerEntry is the entry charging the surcharge of a bill paid late
+func SurchargeLedgerEntry(bill *Bill, amount decimal.Decimal) *LedgerEntry {
+	return &LedgerEntry{
+		ConsumerID:    bill.ConsumerID,
+		AccountNumber: bill.AccountNumber,
+		Type:          LedgerTypeSurcharge,
+		Amount:        amount,
+		Description:   "Late payment surcharge",
+		Reference:     bill.Number,
+		SourceID:      bill.ID,
+	}
+}
+
+// PaymentLedgerEntry is the entry crediting a payment to its consumer
+func PaymentLedgerEntry(payment *Payment) *LedgerEntry {
+	return &LedgerEntry{
+		ConsumerID:    payment.ConsumerID,
+		AccountNumber: payment.AccountNumber,
+		Type:          LedgerTypePayment,
+		Amount:        payment.Amount.Neg(),
+		Description:   "Payment received",
+		Reference:     payment.ReceiptNumber,
+		SourceID:      payment.ID,
+		CreatedBy:     payment.CashierID,
+		CreatedByName: payment.CashierName,
+	}
+}
+
+// LedgerStore persists the ledger entries of the consumers
+type LedgerStore interface {
+	// Append records an entry. An entry for a source already entered with
+	// the same type returns ErrDuplicate, so entering a bill or payment is
+	// safe to repeat.
+	Append(ctx context.Context, entry *LedgerEntry) error
+	// List lists the entries of the consumer, oldest first
+	List(ctx context.Context, consumerID primitive.ObjectID) ([]LedgerEntry, error)
+	// Balance sums the entries of the consumer: what they owe, or the credit
+	// they have when negative
+	Balance(ctx context.Context, consumerID primitive.ObjectID) (decimal.Decimal, error)
+}
+
+type mongoLedgerStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoLedgerStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "consumer_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "type", Value: 1}, {Key: "source_id", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"source_id": bson.M{"$exists": true}}),
+		},
+	})
+	return err
+}
+
+func (s *mongoLedgerStore) Append(ctx context.Context, entry *LedgerEntry) error {
+	entry.CreatedAt = time.Now().UTC()
+	result, err := s.collection.InsertOne(ctx, entry)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoLedgerStore) List(ctx context.Context, consumerID primitive.ObjectID) ([]LedgerEntry, error) {
+	cursor, err := s.collection.Find(ctx,
+		bson.M{"consumer_id": consumerID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []LedgerEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *mongoLedgerStore) Balance(ctx context.Context, consumerID primitive.ObjectID) (decimal.Decimal, error) {
+	cursor, err := s.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"consumer_id": consumerID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "balance": bson.M{"$sum": "$amount"}}}},
+	})
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Balance decimal.Decimal `bson:"balance"`
+	}
+	if !cursor.Next(ctx) {
+		return decimal.Zero, cursor.Err()
+	}
+	if err := cursor.Decode(&result); err != nil {
+		return decimal.Decimal{}, err
+	}
+	return result.Balance, nil
+}
+
+// AccountCredit derives the credit of an account from its ledger balance and
+// its unpaid bills: money received but not yet applied to a bill. It is
+// negative while charges outside the bills, such as surcharges, are unpaid.
+func AccountCredit(balance decimal.Decimal, bills []Bill) decimal.Decimal {
+	credit := balance.Neg()
+	for _, bill := range bills {
+		credit = credit.Add(bill.Balance())
+	}
+	return credit
+}
+
+// OverdueBalance is what the account owes on the bills due before dueBefore,
+// less the credit not yet applied to a bill, which pays the oldest bills
+// first. It is zero when nothing that old is owed.
+func OverdueBalance(balance decimal.Decimal, bills []Bill, dueBefore time.Time) decimal.Decimal {
+	overdue := decimal.Zero
+	for _, bill := range bills {
+		if bill.DueDate.Before(dueBefore) {
+			overdue = overdue.Add(bill.Balance())
+		}
+	}
+	overdue = overdue.Sub(decimal.Max(AccountCredit(balance, bills), decimal.Zero))
+	return decimal.Max(overdue, decimal.Zero)
+}
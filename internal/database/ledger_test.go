@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLedgerStore(t *testing.T) {
+	db := New()
+	ledger := db.Ledger()
+	ctx := context.Background()
+
+	bill := &Bill{ID: primitive.NewObjectID(), ConsumerID: primitive.NewObjectID(), Number: "B00000001", Total: decimal.RequireFromString("1200.00")}
+	payment := &Payment{ID: primitive.NewObjectID(), ConsumerID: bill.ConsumerID, ReceiptNumber: "OR00000001", Amount: decimal.RequireFromString("1000.00")}
+	for _, entry := range []*LedgerEntry{BillLedgerEntry(bill), SurchargeLedgerEntry(bill, decimal.RequireFromString("24.00")), PaymentLedgerEntry(payment)} {
+		if err := ledger.Append(ctx, entry); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	if err := ledger.Append(ctx, BillLedgerEntry(bill)); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Append() of an entered bill error = %v, want ErrDuplicate", err)
+	}
+	adjustment := &LedgerEntry{ConsumerID: bill.ConsumerID, Type: LedgerTypeAdjustment, Amount: decimal.RequireFromString("-4.00"), Reason: "Waived"}
+	if err := ledger.Append(ctx, adjustment); err != nil {
+		t.Fatalf("Append() adjustment error = %v", err)
+	}
+
+	entries, err := ledger.List(ctx, bill.ConsumerID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 4 || entries[0].Type != LedgerTypeBill || entries[3].Reason != "Waived" {
+		t.Errorf("List() = %+v", entries)
+	}
+
+	balance, err := ledger.Balance(ctx, bill.ConsumerID)
+	if err != nil {
+		t.Fatalf("Balance() error = %v", err)
+	}
+	if !balance.Equal(decimal.RequireFromString("220.00")) {
+		t.Errorf("Balance() = %s, want 220.00", balance)
+	}
+	if balance, err := ledger.Balance(ctx, primitive.NewObjectID()); err != nil || !balance.IsZero() {
+		t.Errorf("Balance() of an empty ledger = %s, %v", balance, err)
+	}
+}
+
+func TestAccountCredit(t *testing.T) {
+	bills := []Bill{{Total: decimal.RequireFromString("1200.00"), AmountPaid: decimal.RequireFromString("1000.00")}}
+	tests := []struct {
+		balance string
+		want    string
+	}{
+		{"200.00", "0"},     // only the bill is unpaid
+		{"224.00", "-24"},   // and a surcharge
+		{"150.00", "50.00"}, // and money received but not applied
+	}
+	for _, tt := range tests {
+		if got := AccountCredit(decimal.RequireFromString(tt.balance), bills); !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("AccountCredit(%s) = %s, want %s", tt.balance, got, tt.want)
+		}
+	}
+}
+
+func TestOverdueBalance(t *testing.T) {
+	due := time.Date(2025, 3, 10, 0, 0, 0, 0, RollupLocation)
+	bills := []Bill{
+		{Total: decimal.RequireFromString("1200.00"), AmountPaid: decimal.RequireFromString("1000.00"), DueDate: due},
+		{Total: decimal.RequireFromString("900.00"), DueDate: due.AddDate(0, 1, 0)},
+	}
+	tests := []struct {
+		balance   string
+		dueBefore time.Time
+		want      string
+	}{
+		{"1100.00", due.AddDate(0, 0, 1), "200.00"}, // only the first bill is past due
+		{"1124.00", due.AddDate(0, 0, 1), "200.00"}, // surcharges are not bills
+		{"1050.00", due.AddDate(0, 0, 1), "150.00"}, // credit pays the oldest bill
+		{"800.00", due.AddDate(0, 0, 1), "0"},       // credit covers it
+		{"1100.00", due, "0"},                       // not past due yet
+		{"1100.00", due.AddDate(0, 2, 0), "1100.00"},
+	}
+	for _, tt := range tests {
+		got := OverdueBalance(decimal.RequireFromString(tt.balance), bills, tt.dueBefore)
+		if !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("OverdueBalance(%s, %s) = %s, want %s", tt.balance, tt.dueBefore.Format(time.DateOnly), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Meter statuses. A meter is registered as active, can be switched between
+// active and inactive, and is eventually decommissioned, which is final.
+const (
+	MeterStatusActive         = "active"
+	MeterStatusInactive       = "inactive"
+	MeterStatusDecommissioned = "decommissioned"
+)
+
+// Meter connectivity, derived from how long ago the meter was last heard
+// from. It is kept apart from the status employees set: an active meter can
+// be offline.
+const (
+	ConnectivityOnline  = "online"
+	ConnectivityStale   = "stale"
+	ConnectivityOffline = "offline"
+)
+
+var ErrInvalidStatusTransition = errors.New("database: invalid status transition")
+
+// meterTransitions lists the statuses each status may move to
+var meterTransitions = map[string][]string{
+	MeterStatusActive:   {MeterStatusInactive, MeterStatusDecommissioned},
+	MeterStatusInactive: {MeterStatusActive, MeterStatusDecommissioned},
+}
+
+// CanTransitionMeter reports whether a meter may move from one status to another
+func CanTransitionMeter(from, to string) bool {
+	for _, status := range meterTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Meter is an installed smart meter. The serial number is its public identity.
+type Meter struct {
+	ID                    primitive.ObjectID `bson:"_id,omitempty"`
+	SerialNumber          string             `bson:"serial_number"`
+	SNID                  string             `bson:"snid"`
+	Name                  string             `bson:"name"`
+	Location              string             `bson:"location"`
+	Latitude              float64            `bson:"latitude"`
+	Longitude             float64            `bson:"longitude"`
+	TransformerID         string             `bson:"transformer_id"`
+	InstallationDate      time.Time          `bson:"installation_date"`
+	ConsumerID            primitive.ObjectID `bson:"consumer_id,omitempty"`
+	DeviceTokenHash       string             `bson:"device_token_hash,omitempty"`
+	Status                string             `bson:"status"`
+	StatusChangedAt       time.Time          `bson:"status_changed_at"`
+	LastSeenAt            time.Time          `bson:"last_seen_at,omitempty"` // latest reading upload or heartbeat
+	Connectivity          string             `bson:"connectivity,omitempty"` // empty until the monitor first checks the meter
+	ConnectivityChangedAt time.Time          `bson:"connectivity_changed_at,omitempty"`
+	Disconnected          bool               `bson:"disconnected,omitempty"` // supply switched off by a remote disconnect
+	DisconnectedAt        time.Time          `bson:"disconnected_at,omitempty"`
+	CreatedAt             time.Time          `bson:"created_at"`
+	UpdatedAt             time.Time          `bson:"updated_at"`
+}
+
+// MeterFilter narrows MeterStore.List, zero values match everything
+type MeterFilter struct {
+	Statuses    []string
+	ConsumerID  primitive.ObjectID
+	ConsumerIDs []primitive.ObjectID // when non-nil, meters of any of these consumers
+}
+
+// MeterStore persists the smart meter registry
+type MeterStore interface {
+	Create(ctx context.Context, meter *Meter) error
+	Get(ctx context.Context, serialNumber string) (*Meter, error)
+	Update(ctx context.Context, meter *Meter) error
+	List(ctx context.Context, filter MeterFilter) ([]Meter, error)
+	AssignConsumer(ctx context.Context, serialNumber string, consumerID primitive.ObjectID) error
+	SetDeviceToken(ctx context.Context, serialNumber, tokenHash string) error
+	SetStatus(ctx context.Context, serialNumber, status string) error
+	Decommission(ctx context.Context, serialNumber string) error
+	// Touch records that the meter was heard from at seenAt; an earlier time
+	// than the one recorded is ignored
+	Touch(ctx context.Context, serialNumber string, seenAt time.Time) error
+	// SetConnectivity moves the meter from one connectivity to another,
+	// returning ErrConflict when it is no longer in the from connectivity
+	SetConnectivity(ctx context.Context, serialNumber, from, to string, at time.Time) error
+	// SetDisconnected records the meter switching its supply off or back on
+	SetDisconnected(ctx context.Context, serialNumber string, disconnected bool, at time.Time) error
+}
+
+type mongoMeterStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoMeterStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "serial_number", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "consumer_id", Value: 1}},
+		},
+	})
+	return err
+}
+
+func (s *mongoMeterStore) Create(ctx context.Context, meter *Meter) error {
+	now := time.Now().UTC()
+	if meter.Status == "" {
+		meter.Status = MeterStatusActive
+	}
+	meter.StatusChangedAt = now
+	meter.CreatedAt = now
+	meter.UpdatedAt = now
+
+	result, err := s.collection.InsertOne(ctx, meter)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	meter.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoMeterStore) Get(ctx context.Context, serialNumber string) (*Meter, error) {
+	var meter Meter
+	err := s.collection.FindOne(ctx, bson.M{"serial_number": serialNumber}).Decode(&meter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &meter, nil
+}
+
+// Update saves the descriptive fields of a meter. The status only changes
+// through SetStatus so that transitions are checked.
+func (s *mongoMeterStore) Update(ctx context.Context, meter *Meter) error {
+	meter.UpdatedAt = time.Now().UTC()
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"serial_number": meter.SerialNumber},
+		bson.M{"$set": bson.M{
+			"snid":              meter.SNID,
+			"name":              meter.Name,
+			"location":          meter.Location,
+			"latitude":          meter.Latitude,
+			"longitude":         meter.Longitude,
+			"transformer_id":    meter.TransformerID,
+			"installation_date": meter.InstallationDate,
+			"updated_at":        meter.UpdatedAt,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoMeterStore) List(ctx context.Context, filter MeterFilter) ([]Meter, error) {
+	query := bson.M{}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+	if !filter.ConsumerID.IsZero() {
+		query["consumer_id"] = filter.ConsumerID
+	}
+	if filter.ConsumerIDs != nil {
+		query["consumer_id"] = bson.M{"$in": filter.ConsumerIDs}
+	}
+
+	cursor, err := s.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "serial_number", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	meters := []Meter{}
+	if err := cursor.All(ctx, &meters); err != nil {
+		return nil, err
+	}
+	return meters, nil
+}
+
+// AssignConsumer links the meter to the consumer account it measures
+func (s *mongoMeterStore) AssignConsumer(ctx context.Context, serialNumber string, consumerID primitive.ObjectID) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"serial_number": serialNumber},
+		bson.M{"$set": bson.M{"consumer_id": consumerID, "updated_at": time.Now().UTC()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetDeviceToken replaces the hash of the token the meter authenticates with
+func (s *mongoMeterStore) SetDeviceToken(ctx context.Context, serialNumber, tokenHash string) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"serial_number": serialNumber},
+		bson.M{"$set": bson.M{"device_token_hash": tokenHash, "updated_at": time.Now().UTC()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoMeterStore) SetStatus(ctx context.Context, serialNumber, status string) error {
+	var allowedFrom []string
+	for from := range meterTransitions {
+		if CanTransitionMeter(from, status) {
+			allowedFrom = append(allowedFrom, from)
+		}
+	}
+
+	// Only update when the current status allows the transition, so two
+	// concurrent changes cannot both succeed
+	now := time.Now().UTC()
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"serial_number": serialNumber, "status": bson.M{"$in": allowedFrom}},
+		bson.M{"$set": bson.M{"status": status, "status_changed_at": now, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if _, err := s.Get(ctx, serialNumber); err != nil {
+			return err
+		}
+		return ErrInvalidStatusTransition
+	}
+	return nil
+}
+
+func (s *mongoMeterStore) Decommission(ctx context.Context, serialNumber string) error {
+	return s.SetStatus(ctx, serialNumber, MeterStatusDecommissioned)
+}
+
+func (s *mongoMeterStore) Touch(ctx context.Context, serialNumber string, seenAt time.Time) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"serial_number": serialNumber},
+		bson.M{"$max": bson.M{"last_seen_at": seenAt.UTC()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoMeterStore) SetConnectivity(ctx context.Context, serialNumber, from, to string, at time.Time) error {
+	// A meter never checked has no connectivity field, which null matches
+	var current any = from
+	if from == "" {
+		current = nil
+	}
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"serial_number": serialNumber, "connectivity": current},
+		bson.M{"$set": bson.M{"connectivity": to, "connectivity_changed_at": at.UTC()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *mongoMeterStore) SetDisconnected(ctx context.Context, serialNumber string, disconnected bool, at time.Time) error {
+	update := bson.M{"$set": bson.M{"disconnected": true, "disconnected_at": at.UTC()}}
+	if !disconnected {
+		update = bson.M{"$unset": bson.M{"disconnected": "", "disconnected_at": ""}}
+	}
+	result, err := s.collection.UpdateOne(ctx, bson.M{"serial_number": serialNumber}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCanTransitionMeter(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{MeterStatusActive, MeterStatusInactive, true},
+		{MeterStatusInactive, MeterStatusActive, true},
+		{MeterStatusActive, MeterStatusDecommissioned, true},
+		{MeterStatusDecommissioned, MeterStatusActive, false},
+		{MeterStatusActive, MeterStatusActive, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransitionMeter(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransitionMeter(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestMeterStore(t *testing.T) {
+	meters := New().Meters()
+	ctx := context.Background()
+
+	meter := &Meter{SerialNumber: "SM-TEST-001", Name: "Smart Meter 1", Location: "Calatagan", Latitude: 13.838432, Longitude: 120.632360}
+	if err := meters.Create(ctx, meter); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if meter.Status != MeterStatusActive {
+		t.Errorf("Create() status = %q, want %q", meter.Status, MeterStatusActive)
+	}
+	if err := meters.Create(ctx, &Meter{SerialNumber: "SM-TEST-001"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Create() duplicate serial error = %v, want %v", err, ErrDuplicate)
+	}
+
+	meter.Location = "Balayan"
+	if err := meters.Update(ctx, meter); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := meters.SetStatus(ctx, meter.SerialNumber, MeterStatusInactive); err != nil {
+		t.Fatalf("SetStatus() error = %v", err)
+	}
+
+	got, err := meters.Get(ctx, meter.SerialNumber)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Location != "Balayan" || got.Status != MeterStatusInactive {
+		t.Errorf("Get() = %+v", got)
+	}
+
+	if err := meters.Decommission(ctx, meter.SerialNumber); err != nil {
+		t.Fatalf("Decommission() error = %v", err)
+	}
+	if err := meters.SetStatus(ctx, meter.SerialNumber, MeterStatusActive); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("SetStatus() after decommission error = %v, want %v", err, ErrInvalidStatusTransition)
+	}
+
+	listed, err := meters.List(ctx, MeterFilter{Statuses: []string{MeterStatusActive, MeterStatusInactive}})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	for _, m := range listed {
+		if m.SerialNumber == meter.SerialNumber {
+			t.Error("List() returned a decommissioned meter")
+		}
+	}
+}
+
+func TestMeterStoreConnectivity(t *testing.T) {
+	meters := New().Meters()
+	ctx := context.Background()
+
+	meter := &Meter{SerialNumber: "SM-TEST-002"}
+	if err := meters.Create(ctx, meter); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	seen := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	if err := meters.Touch(ctx, meter.SerialNumber, seen); err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+	if err := meters.Touch(ctx, meter.SerialNumber, seen.Add(-time.Hour)); err != nil {
+		t.Fatalf("Touch() earlier error = %v", err)
+	}
+	if err := meters.SetConnectivity(ctx, meter.SerialNumber, "", ConnectivityOnline, seen); err != nil {
+		t.Fatalf("SetConnectivity() error = %v", err)
+	}
+	if err := meters.SetConnectivity(ctx, meter.SerialNumber, ConnectivityStale, ConnectivityOffline, seen); !errors.Is(err, ErrConflict) {
+		t.Errorf("SetConnectivity() from a stale connectivity error = %v, want %v", err, ErrConflict)
+	}
+
+	got, err := meters.Get(ctx, meter.SerialNumber)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !got.LastSeenAt.Equal(seen) || got.Connectivity != ConnectivityOnline {
+		t.Errorf("Get() last seen %s, connectivity %q", got.LastSeenAt, got.Connectivity)
+	}
+	if err := meters.Touch(ctx, "SM-MISSING", seen); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Touch() unknown meter error = %v, want %v", err, ErrNotFound)
+	}
+}
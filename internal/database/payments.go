@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Payment methods accepted over the counter, matching web.PaymentMethods
+const (
+	PaymentMethodCash    = "cash"
+	PaymentMethodCheck   = "check"
+	PaymentMethodEWallet = "ewallet"
+)
+
+// Payment is money received by a cashier for a consumer account, recorded
+// under the number of the official receipt issued for it. Amount and the
+// credit spent with it are applied to the unpaid bills; what is left over is
+// credited to the account. Entered is set once the payment is in the ledger;
+// a payment left out by a failed request is entered by the next one posted
+// to the account or by the billing scheduler.
+type Payment struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty"`
+	ReceiptNumber string              `bson:"receipt_number"`
+	ConsumerID    primitive.ObjectID  `bson:"consumer_id"`
+	AccountNumber string              `bson:"account_number"`
+	PayorName     string              `bson:"payor_name"`
+	Method        string              `bson:"method"`
+	Reference     string              `bson:"reference"` // check number or e-wallet reference, empty for cash
+	Amount        decimal.Decimal     `bson:"amount"`
+	Charges       decimal.Decimal     `bson:"charges"`        // paid toward surcharges and other charges outside the bills
+	CreditApplied decimal.Decimal     `bson:"credit_applied"` // earlier credit spent on the bills
+	Allocations   []PaymentAllocation `bson:"allocations"`
+	Credited      decimal.Decimal     `bson:"credited"` // overpayment kept as credit
+	CashierID     primitive.ObjectID  `bson:"cashier_id"`
+	CashierName   string              `bson:"cashier_name"`
+	ReceivedAt    time.Time           `bson:"received_at"`
+	Entered       bool                `bson:"entered"`
+}
+
+// PaymentAllocation is the part of a payment applied to one bill
+type PaymentAllocation struct {
+	BillID     primitive.ObjectID `bson:"bill_id"`
+	BillNumber string             `bson:"bill_number"`
+	Amount     decimal.Decimal    `bson:"amount"`
+}
+
+// PaymentFilter narrows PaymentStore.List, zero values match everything
+type PaymentFilter struct {
+	ConsumerID primitive.ObjectID
+	CashierID  primitive.ObjectID
+	From       time.Time // inclusive
+	To         time.Time // exclusive
+}
+
+// PaymentStore persists the payments. Payments are never changed once
+// recorded; a mistake is corrected by a later entry.
+type PaymentStore interface {
+	// Create stores a payment under the next official receipt number
+	Create(ctx context.Context, payment *Payment) error
+	Get(ctx context.Context, id primitive.ObjectID) (*Payment, error)
+	// List lists the matching payments in the order they were received
+	List(ctx context.Context, filter PaymentFilter) ([]Payment, error)
+	// ListUnentered lists the payments of the consumer, or of every consumer
+	// when consumerID is zero, not marked entered in the ledger yet
+	ListUnentered(ctx context.Context, consumerID primitive.ObjectID) ([]Payment, error)
+	// MarkEntered records that the payment is in the ledger
+	MarkEntered(ctx context.Context, id primitive.ObjectID) error
+}
+
+// EnterPayment enters the payment in the ledger and marks it entered. An
+// entry made by an earlier attempt is not made twice.
+func EnterPayment(ctx context.Context, db Service, payment *Payment) error {
+	err := db.Ledger().Append(ctx, PaymentLedgerEntry(payment))
+	if err != nil && !errors.Is(err, ErrDuplicate) {
+		return err
+	}
+	return db.Payments().MarkEntered(ctx, payment.ID)
+}
+
+// EnterPayments enters the payments of the consumer, or of every consumer
+// when consumerID is zero, that failed requests left out of the ledger
+func EnterPayments(ctx context.Context, db Service, consumerID primitive.ObjectID) error {
+	payments, err := db.Payments().ListUnentered(ctx, consumerID)
+	if err != nil {
+		return err
+	}
+	for i := range payments {
+		if err := EnterPayment(ctx, db, &payments[i]); err != nil {
+			return fmt.Errorf("receipt %s: %w", payments[i].ReceiptNumber, err)
+		}
+	}
+	return nil
+}
+
+type mongoPaymentStore struct {
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+func (s *mongoPaymentStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "receipt_number", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "received_at", Value: 1}, {Key: "cashier_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "consumer_id", Value: 1}, {Key: "received_at", Value: 1}},
+		},
+	})
+	return err
+}
+
+func (s *mongoPaymentStore) Create(ctx context.Context, payment *Payment) error {
+	seq, err := nextSequence(ctx, s.counters, "receipt_number")
+	if err != nil {
+		return err
+	}
+
+	payment.ReceiptNumber = fmt.Sprintf("OR%08d", seq)
+	if payment.ReceivedAt.IsZero() {
+		payment.ReceivedAt = time.Now().UTC()
+	}
+
+	result, err := s.collection.InsertOne(ctx, payment)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	payment.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoPaymentStore) Get(ctx context.Context, id primitive.ObjectID) (*Payment, error) {
+	var payment Payment
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&payment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (s *mongoPaymentStore) List(ctx context.Context, filter PaymentFilter) ([]Payment, error) {
+	query := bson.M{}
+	if !filter.ConsumerID.IsZero() {
+		query["consumer_id"] = filter.ConsumerID
+	}
+	if !filter.CashierID.IsZero() {
+		query["cashier_id"] = filter.CashierID
+	}
+	received := bson.M{}
+	if !filter.From.IsZero() {
+		received["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		received["$lt"] = filter.To
+	}
+	if len(received) > 0 {
+		query["received_at"] = received
+	}
+
+	cursor, err := s.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	payments := []Payment{}
+	if err := cursor.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (s *mongoPaymentStore) ListUnentered(ctx context.Context, consumerID primitive.ObjectID) ([]Payment, error) {
+	query := bson.M{"entered": bson.M{"$ne": true}}
+	if !consumerID.IsZero() {
+		query["consumer_id"] = consumerID
+	}
+	cursor, err := s.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	payments := []Payment{}
+	if err := cursor.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (s *mongoPaymentStore) MarkEntered(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"entered": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
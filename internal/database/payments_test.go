@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPaymentStore(t *testing.T) {
+	db := New()
+	payments := db.Payments()
+	ctx := context.Background()
+
+	cashier := primitive.NewObjectID()
+	received := time.Date(2025, 3, 3, 9, 0, 0, 0, RollupLocation)
+	first := &Payment{ConsumerID: primitive.NewObjectID(), Method: PaymentMethodCash, Amount: decimal.RequireFromString("100.00"), CashierID: cashier, ReceivedAt: received}
+	second := &Payment{ConsumerID: first.ConsumerID, Method: PaymentMethodEWallet, Reference: "GC-1", Amount: decimal.RequireFromString("50.00"), CashierID: cashier, ReceivedAt: received.Add(time.Hour)}
+	for _, payment := range []*Payment{first, second} {
+		if err := payments.Create(ctx, payment); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	if first.ReceiptNumber == "" || first.ReceiptNumber == second.ReceiptNumber {
+		t.Errorf("Create() receipt numbers = %q, %q", first.ReceiptNumber, second.ReceiptNumber)
+	}
+
+	list, err := payments.List(ctx, PaymentFilter{CashierID: cashier, From: received, To: received.AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list) != 2 || list[0].ID != first.ID || !list[1].Amount.Equal(second.Amount) {
+		t.Errorf("List() = %+v", list)
+	}
+
+	if err := payments.MarkEntered(ctx, first.ID); err != nil {
+		t.Fatalf("MarkEntered() error = %v", err)
+	}
+	unentered, err := payments.ListUnentered(ctx, first.ConsumerID)
+	if err != nil {
+		t.Fatalf("ListUnentered() error = %v", err)
+	}
+	if len(unentered) != 1 || unentered[0].ID != second.ID {
+		t.Errorf("ListUnentered() = %+v, want the second payment only", unentered)
+	}
+}
@@ -0,0 +1,208 @@
+package database
+
+import (
+	"SmartMeterSystem/internal/billing"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Rate schedule kinds. Every consumer class has one version history of the
+// rates it is billed and one of the rates approved by the ERC.
+const (
+	RateKindBilled = "rates"
+	RateKindERC    = "erc"
+)
+
+// Rate schedule statuses. A version is drafted pending, and only becomes
+// effective once a second user approves it; rejection is final.
+const (
+	RateStatusPending  = "pending"
+	RateStatusApproved = "approved"
+	RateStatusRejected = "rejected"
+)
+
+// ErrSelfReview is returned when the author of a version tries to decide it
+var ErrSelfReview = errors.New("database: a version cannot be reviewed by its author")
+
+// RateSchedule is one version of the rates of a consumer class. Versions are
+// never edited, a change is stored as a new version with its effective date.
+type RateSchedule struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty"`
+	Class         string              `bson:"class"` // consumer account type
+	Kind          string              `bson:"kind"`
+	Version       int                 `bson:"version"`
+	EffectiveDate time.Time           `bson:"effective_date"` // start of a day in RollupLocation
+	Groups        []billing.RateGroup `bson:"groups"`
+	CreatedBy     primitive.ObjectID  `bson:"created_by"`
+	CreatedByName string              `bson:"created_by_name"`
+	CreatedAt     time.Time           `bson:"created_at"`
+	Status        string              `bson:"status"`
+	Review        *RateReview         `bson:"review,omitempty"`
+}
+
+// RateReview is the decision of the user checking a drafted version
+type RateReview struct {
+	ReviewedBy     primitive.ObjectID `bson:"reviewed_by"`
+	ReviewedByName string             `bson:"reviewed_by_name"`
+	Comment        string             `bson:"comment"`
+	ReviewedAt     time.Time          `bson:"reviewed_at"`
+}
+
+// Table returns the schedule in the shape the billing engine computes with
+func (s *RateSchedule) Table() billing.RateTable {
+	return billing.RateTable{Class: s.Class, Groups: s.Groups}
+}
+
+// RateScheduleStore persists the versioned rate schedules
+type RateScheduleStore interface {
+	// Create stores the schedule as the next version of its class and kind,
+	// pending unless a status is set
+	Create(ctx context.Context, schedule *RateSchedule) error
+	Get(ctx context.Context, id primitive.ObjectID) (*RateSchedule, error)
+	// Effective returns the approved schedule in force at the given time: the
+	// one with the latest effective date not after it, the newest version on
+	// a tie
+	Effective(ctx context.Context, class, kind string, at time.Time) (*RateSchedule, error)
+	// History lists every version of the class and kind, newest first
+	History(ctx context.Context, class, kind string) ([]RateSchedule, error)
+	// Pending lists the versions of the class awaiting review, oldest first
+	Pending(ctx context.Context, class string) ([]RateSchedule, error)
+	// Decide approves or rejects a pending version. Deciding a version that
+	// is no longer pending returns ErrInvalidStatusTransition, deciding one's
+	// own version ErrSelfReview.
+	Decide(ctx context.Context, id primitive.ObjectID, status string, review RateReview) error
+}
+
+type mongoRateScheduleStore struct {
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+func (s *mongoRateScheduleStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "class", Value: 1}, {Key: "kind", Value: 1}, {Key: "version", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "class", Value: 1}, {Key: "kind", Value: 1}, {Key: "status", Value: 1}, {Key: "effective_date", Value: -1}, {Key: "version", Value: -1}},
+		},
+	})
+	return err
+}
+
+func (s *mongoRateScheduleStore) Create(ctx context.Context, schedule *RateSchedule) error {
+	version, err := nextSequence(ctx, s.counters, "rate_schedule_"+schedule.Class+"_"+schedule.Kind)
+	if err != nil {
+		return err
+	}
+
+	schedule.Version = int(version)
+	schedule.CreatedAt = time.Now().UTC()
+	if schedule.Status == "" {
+		schedule.Status = RateStatusPending
+	}
+
+	result, err := s.collection.InsertOne(ctx, schedule)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	schedule.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoRateScheduleStore) Get(ctx context.Context, id primitive.ObjectID) (*RateSchedule, error) {
+	var schedule RateSchedule
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&schedule)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (s *mongoRateScheduleStore) Effective(ctx context.Context, class, kind string, at time.Time) (*RateSchedule, error) {
+	var schedule RateSchedule
+	err := s.collection.FindOne(ctx,
+		bson.M{"class": class, "kind": kind, "status": RateStatusApproved, "effective_date": bson.M{"$lte": at}},
+		options.FindOne().SetSort(bson.D{{Key: "effective_date", Value: -1}, {Key: "version", Value: -1}}),
+	).Decode(&schedule)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (s *mongoRateScheduleStore) History(ctx context.Context, class, kind string) ([]RateSchedule, error) {
+	cursor, err := s.collection.Find(ctx,
+		bson.M{"class": class, "kind": kind},
+		options.Find().SetSort(bson.D{{Key: "version", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := []RateSchedule{}
+	if err := cursor.All(ctx, &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (s *mongoRateScheduleStore) Pending(ctx context.Context, class string) ([]RateSchedule, error) {
+	cursor, err := s.collection.Find(ctx,
+		bson.M{"class": class, "status": RateStatusPending},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := []RateSchedule{}
+	if err := cursor.All(ctx, &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (s *mongoRateScheduleStore) Decide(ctx context.Context, id primitive.ObjectID, status string, review RateReview) error {
+	if status != RateStatusApproved && status != RateStatusRejected {
+		return ErrInvalidStatusTransition
+	}
+
+	// Only a pending version of someone else can be decided, so two
+	// reviewers cannot both decide the same draft
+	review.ReviewedAt = time.Now().UTC()
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": RateStatusPending, "created_by": bson.M{"$ne": review.ReviewedBy}},
+		bson.M{"$set": bson.M{"status": status, "review": review}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		schedule, err := s.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if schedule.Status == RateStatusPending {
+			return ErrSelfReview
+		}
+		return ErrInvalidStatusTransition
+	}
+	return nil
+}
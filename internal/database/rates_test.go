@@ -0,0 +1,110 @@
+package database
+
+import (
+	"SmartMeterSystem/internal/billing"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRateScheduleStore(t *testing.T) {
+	db := New()
+	schedules := db.RateSchedules()
+	ctx := context.Background()
+
+	schedule := func(day int, amount string) *RateSchedule {
+		return &RateSchedule{
+			Class:         "test-class",
+			Kind:          RateKindBilled,
+			Status:        RateStatusApproved,
+			EffectiveDate: time.Date(2025, 1, day, 0, 0, 0, 0, RollupLocation),
+			Groups: []billing.RateGroup{{Particulars: "Generation Charges", Rates: []billing.Rate{
+				{Particulars: "Generation Energy Charge", Unit: billing.UnitPerKWh, Amount: decimal.RequireFromString(amount)},
+			}}},
+		}
+	}
+
+	january := schedule(1, "5.6092")
+	later := schedule(15, "5.7001")
+	correction := schedule(1, "5.6100")
+	for _, s := range []*RateSchedule{january, later, correction} {
+		if err := schedules.Create(ctx, s); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	if january.Version+2 != correction.Version {
+		t.Errorf("versions = %d, %d, want consecutive", january.Version, correction.Version)
+	}
+
+	// The correction shares the effective date and supersedes the first version
+	effective, err := schedules.Effective(ctx, "test-class", RateKindBilled, time.Date(2025, 1, 10, 0, 0, 0, 0, RollupLocation))
+	if err != nil {
+		t.Fatalf("Effective() error = %v", err)
+	}
+	if effective.Version != correction.Version || effective.Groups[0].Rates[0].Amount.String() != "5.61" {
+		t.Errorf("Effective() = %+v, want version %d", effective, correction.Version)
+	}
+
+	if _, err := schedules.Effective(ctx, "test-class", RateKindBilled, time.Date(2024, 12, 31, 0, 0, 0, 0, RollupLocation)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Effective() before the first version error = %v, want ErrNotFound", err)
+	}
+
+	history, err := schedules.History(ctx, "test-class", RateKindBilled)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(history) != 3 || history[0].Version != correction.Version {
+		t.Errorf("History() = %+v", history)
+	}
+}
+
+func TestRateScheduleStoreReview(t *testing.T) {
+	db := New()
+	schedules := db.RateSchedules()
+	ctx := context.Background()
+
+	maker, checker := primitive.NewObjectID(), primitive.NewObjectID()
+	draft := &RateSchedule{
+		Class:         "test-review",
+		Kind:          RateKindERC,
+		EffectiveDate: time.Date(2025, 1, 1, 0, 0, 0, 0, RollupLocation),
+		CreatedBy:     maker,
+	}
+	if err := schedules.Create(ctx, draft); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if draft.Status != RateStatusPending {
+		t.Errorf("Create() status = %q, want pending", draft.Status)
+	}
+
+	// A draft is not in force until approved
+	at := time.Date(2025, 2, 1, 0, 0, 0, 0, RollupLocation)
+	if _, err := schedules.Effective(ctx, "test-review", RateKindERC, at); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Effective() of a draft error = %v, want ErrNotFound", err)
+	}
+	if pending, err := schedules.Pending(ctx, "test-review"); err != nil || len(pending) != 1 {
+		t.Errorf("Pending() = %+v, %v", pending, err)
+	}
+
+	if err := schedules.Decide(ctx, draft.ID, RateStatusApproved, RateReview{ReviewedBy: maker}); !errors.Is(err, ErrSelfReview) {
+		t.Errorf("Decide() by the author error = %v, want ErrSelfReview", err)
+	}
+	if err := schedules.Decide(ctx, draft.ID, RateStatusApproved, RateReview{ReviewedBy: checker, Comment: "Matches the ERC order"}); err != nil {
+		t.Fatalf("Decide() error = %v", err)
+	}
+	if err := schedules.Decide(ctx, draft.ID, RateStatusRejected, RateReview{ReviewedBy: checker}); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("Decide() twice error = %v, want ErrInvalidStatusTransition", err)
+	}
+
+	effective, err := schedules.Effective(ctx, "test-review", RateKindERC, at)
+	if err != nil {
+		t.Fatalf("Effective() error = %v", err)
+	}
+	if effective.Review == nil || effective.Review.Comment != "Matches the ERC order" {
+		t.Errorf("Effective() review = %+v", effective.Review)
+	}
+}
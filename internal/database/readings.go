@@ -0,0 +1,175 @@
+package database
+
+import (
+	"SmartMeterSystem/internal/config"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RawReadingRetention is how long raw readings are kept before MongoDB expires
+// them, read from READINGS_RAW_RETENTION_DAYS. Rollups are kept indefinitely,
+// and those of hours past the retention are never recomputed.
+var RawReadingRetention = time.Duration(config.Int("READINGS_RAW_RETENTION_DAYS", 90, 1)) * 24 * time.Hour
+
+// indexOptionsConflictCode is the server error code for an index that exists
+// with different options
+const indexOptionsConflictCode = 85
+
+// duplicateKeyCode is the server error code of a unique index violation
+const duplicateKeyCode = 11000
+
+// Reading is one interval reading reported by a smart meter. A meter reports
+// at most one reading per timestamp.
+type Reading struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	SerialNumber string             `bson:"serial_number"`
+	Timestamp    time.Time          `bson:"timestamp"`
+	EnergyKWh    float64            `bson:"energy_kwh"` // cumulative register
+	PowerKW      float64            `bson:"power_kw"`   // instantaneous, negative on reverse flow
+	Voltage      float64            `bson:"voltage"`
+	Current      float64            `bson:"current"`
+	TamperFlags  []string           `bson:"tamper_flags,omitempty"`
+	ReceivedAt   time.Time          `bson:"received_at"`
+}
+
+// ReadingFilter narrows ReadingStore.List to one meter and a time range.
+// From is inclusive and To exclusive; zero values leave the range open.
+type ReadingFilter struct {
+	SerialNumber string
+	From         time.Time
+	To           time.Time
+}
+
+// ReadingStore persists meter readings
+type ReadingStore interface {
+	// Insert stores the readings, skipping those already stored for the same
+	// meter and timestamp. It returns the readings actually inserted.
+	Insert(ctx context.Context, readings []Reading) ([]Reading, error)
+	List(ctx context.Context, filter ReadingFilter) ([]Reading, error)
+	// Last returns the latest reading of the meter before the given time
+	Last(ctx context.Context, serialNumber string, before time.Time) (*Reading, error)
+}
+
+type mongoReadingStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoReadingStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "serial_number", Value: 1}, {Key: "timestamp", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	expireAfter := int32(RawReadingRetention.Seconds())
+	_, err = s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "timestamp", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(expireAfter),
+	})
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(indexOptionsConflictCode) {
+		// The retention changed since the index was created
+		return s.collection.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: s.collection.Name()},
+			{Key: "index", Value: bson.D{
+				{Key: "keyPattern", Value: bson.D{{Key: "timestamp", Value: 1}}},
+				{Key: "expireAfterSeconds", Value: expireAfter},
+			}},
+		}).Err()
+	}
+	return err
+}
+
+func (s *mongoReadingStore) Insert(ctx context.Context, readings []Reading) ([]Reading, error) {
+	if len(readings) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now().UTC()
+	documents := make([]interface{}, len(readings))
+	for i := range readings {
+		// MongoDB keeps millisecond precision, truncate so a retried upload
+		// hits the unique index
+		readings[i].ID = primitive.NewObjectID()
+		readings[i].Timestamp = readings[i].Timestamp.UTC().Truncate(time.Millisecond)
+		readings[i].ReceivedAt = now
+		documents[i] = readings[i]
+	}
+
+	// Unordered, so one duplicate does not stop the rest of the batch
+	_, err := s.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return readings, nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return nil, err
+	}
+	duplicates := map[int]bool{}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != duplicateKeyCode {
+			return nil, err
+		}
+		duplicates[writeErr.Index] = true
+	}
+
+	inserted := make([]Reading, 0, len(readings)-len(duplicates))
+	for i, reading := range readings {
+		if !duplicates[i] {
+			inserted = append(inserted, reading)
+		}
+	}
+	return inserted, nil
+}
+
+func (s *mongoReadingStore) List(ctx context.Context, filter ReadingFilter) ([]Reading, error) {
+	query := bson.M{}
+	if filter.SerialNumber != "" {
+		query["serial_number"] = filter.SerialNumber
+	}
+	timestamp := bson.M{}
+	if !filter.From.IsZero() {
+		timestamp["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timestamp["$lt"] = filter.To
+	}
+	if len(timestamp) > 0 {
+		query["timestamp"] = timestamp
+	}
+
+	cursor, err := s.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	readings := []Reading{}
+	if err := cursor.All(ctx, &readings); err != nil {
+		return nil, err
+	}
+	return readings, nil
+}
+
+func (s *mongoReadingStore) Last(ctx context.Context, serialNumber string, before time.Time) (*Reading, error) {
+	var reading Reading
+	err := s.collection.FindOne(ctx,
+		bson.M{"serial_number": serialNumber, "timestamp": bson.M{"$lt": before}},
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}}),
+	).Decode(&reading)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReadingStoreInsertIsIdempotent(t *testing.T) {
+	readings := New().Readings()
+	ctx := context.Background()
+
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	batch := []Reading{
+		{SerialNumber: "SM-TEST-READ", Timestamp: start, EnergyKWh: 100},
+		{SerialNumber: "SM-TEST-READ", Timestamp: start.Add(15 * time.Minute), EnergyKWh: 100.4},
+	}
+	inserted, err := readings.Insert(ctx, batch)
+	if err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if len(inserted) != 2 {
+		t.Errorf("Insert() inserted %d readings, want 2", len(inserted))
+	}
+
+	// A retried upload with one new reading only stores the new one
+	retry := append(batch, Reading{SerialNumber: "SM-TEST-READ", Timestamp: start.Add(30 * time.Minute), EnergyKWh: 100.9})
+	inserted, err = readings.Insert(ctx, retry)
+	if err != nil {
+		t.Fatalf("Insert() retry error = %v", err)
+	}
+	if len(inserted) != 1 || !inserted[0].Timestamp.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("Insert() retry inserted %+v, want only the new reading", inserted)
+	}
+
+	listed, err := readings.List(ctx, ReadingFilter{SerialNumber: "SM-TEST-READ", From: start, To: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(listed) != 3 {
+		t.Errorf("List() returned %d readings, want 3", len(listed))
+	}
+}
@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Rollup granularities. Quarter hours are not rolled up, they are computed
+// from the raw readings while those are retained.
+const (
+	GranularityQuarterHour = "15min"
+	GranularityHour        = "hour"
+	GranularityDay         = "day"
+	GranularityMonth       = "month"
+)
+
+// RollupLocation is the time zone days and months are cut in. The
+// Philippines does not observe daylight saving time, so a fixed offset is exact.
+var RollupLocation = time.FixedZone("PHT", 8*60*60)
+
+// Rollup summarises the readings of one meter over one hour, day or month.
+// Rollups are kept after the raw readings expire.
+type Rollup struct {
+	SerialNumber string    `bson:"serial_number"`
+	Granularity  string    `bson:"granularity"`
+	PeriodStart  time.Time `bson:"period_start"`
+	EnergyKWh    float64   `bson:"energy_kwh"` // consumption within the period
+	PeakPowerKW  float64   `bson:"peak_power_kw"`
+	MinVoltage   float64   `bson:"min_voltage"`
+	MaxVoltage   float64   `bson:"max_voltage"`
+	Samples      int       `bson:"samples"`
+	UpdatedAt    time.Time `bson:"updated_at"`
+}
+
+// RollupFilter narrows RollupStore.List. From is inclusive and To exclusive.
+type RollupFilter struct {
+	SerialNumbers []string
+	Granularity   string
+	From          time.Time
+	To            time.Time
+}
+
+// RollupStore maintains the hourly, daily and monthly reading rollups
+type RollupStore interface {
+	// Refresh recomputes the rollups of the periods covering [from, to] from
+	// the raw readings of the meter, leaving the hours whose readings may
+	// have expired. It is called after readings are stored.
+	Refresh(ctx context.Context, serialNumber string, from, to time.Time) error
+	List(ctx context.Context, filter RollupFilter) ([]Rollup, error)
+}
+
+type mongoRollupStore struct {
+	collection *mongo.Collection
+	readings   *mongo.Collection
+}
+
+func (s *mongoRollupStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "granularity", Value: 1}, {Key: "serial_number", Value: 1}, {Key: "period_start", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// PeriodStart returns the start of the period of the given granularity
+// containing t
+func PeriodStart(granularity string, t time.Time) time.Time {
+	t = t.In(RollupLocation)
+	switch granularity {
+	case GranularityDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, RollupLocation)
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, RollupLocation)
+	case GranularityQuarterHour:
+		return t.Truncate(15 * time.Minute)
+	default:
+		return t.Truncate(time.Hour)
+	}
+}
+
+// NextPeriod returns the start of the period following the one starting at start
+func NextPeriod(granularity string, start time.Time) time.Time {
+	switch granularity {
+	case GranularityDay:
+		return start.AddDate(0, 0, 1)
+	case GranularityMonth:
+		return start.AddDate(0, 1, 0)
+	case GranularityQuarterHour:
+		return start.Add(15 * time.Minute)
+	default:
+		return start.Add(time.Hour)
+	}
+}
+
+// AddPeriods moves start by n periods of the granularity, backwards when n
+// is negative
+func AddPeriods(granularity string, start time.Time, n int) time.Time {
+	switch granularity {
+	case GranularityDay:
+		return start.AddDate(0, 0, n)
+	case GranularityMonth:
+		return start.AddDate(0, n, 0)
+	case GranularityQuarterHour:
+		return start.Add(time.Duration(n) * 15 * time.Minute)
+	default:
+		return start.Add(time.Duration(n) * time.Hour)
+	}
+}
+
+func (s *mongoRollupStore) Refresh(ctx context.Context, serialNumber string, from, to time.Time) error {
+	// A reading changes the consumption of its own hour and of the next hour
+	// holding readings, whose baseline it becomes
+	var next Reading
+	err := s.readings.FindOne(ctx,
+		bson.M{"serial_number": serialNumber, "timestamp": bson.M{"$gt": to}},
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: 1}}),
+	).Decode(&next)
+	switch {
+	case err == nil:
+		to = next.Timestamp
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return err
+	}
+
+	// Hours whose raw readings may have expired keep their rollups, which
+	// could not be computed again
+	hourFrom, hourTo := PeriodStart(GranularityHour, from), NextPeriod(GranularityHour, PeriodStart(GranularityHour, to))
+	rawFrom := hourFrom
+	if horizon := rawHoursFrom(time.Now()); rawFrom.Before(horizon) {
+		rawFrom = horizon
+	}
+	if rawFrom.Before(hourTo) {
+		if err := s.refreshHours(ctx, serialNumber, rawFrom, hourTo); err != nil {
+			return err
+		}
+	}
+
+	dayFrom, dayTo := PeriodStart(GranularityDay, hourFrom), NextPeriod(GranularityDay, PeriodStart(GranularityDay, to))
+	if err := s.refreshFromRollups(ctx, serialNumber, GranularityDay, GranularityHour, dayFrom, dayTo); err != nil {
+		return err
+	}
+
+	monthFrom, monthTo := PeriodStart(GranularityMonth, dayFrom), NextPeriod(GranularityMonth, PeriodStart(GranularityMonth, to))
+	return s.refreshFromRollups(ctx, serialNumber, GranularityMonth, GranularityDay, monthFrom, monthTo)
+}
+
+// rawHoursFrom returns the start of the first hour all of whose raw readings
+// are still kept at now
+func rawHoursFrom(now time.Time) time.Time {
+	return NextPeriod(GranularityHour, PeriodStart(GranularityHour, now.Add(-RawReadingRetention)))
+}
+
+// refreshHours recomputes the hourly rollups in [from, to) from raw readings.
+// The consumption of an hour is its last register value minus the last value
+// before the hour; the very first reading of a meter only sets the baseline.
+func (s *mongoRollupStore) refreshHours(ctx context.Context, serialNumber string, from, to time.Time) error {
+	var baseline *Reading
+	var previous Reading
+	err := s.readings.FindOne(ctx,
+		bson.M{"serial_number": serialNumber, "timestamp": bson.M{"$lt": from}},
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}}),
+	).Decode(&previous)
+	switch {
+	case err == nil:
+		baseline = &previous
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return err
+	}
+
+	cursor, err := s.readings.Find(ctx,
+		bson.M{"serial_number": serialNumber, "timestamp": bson.M{"$gte": from, "$lt": to}},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	readings := []Reading{}
+	if err := cursor.All(ctx, &readings); err != nil {
+		return err
+	}
+
+	rollups := []Rollup{}
+	for _, reading := range readings {
+		start := PeriodStart(GranularityHour, reading.Timestamp)
+		if len(rollups) == 0 || !rollups[len(rollups)-1].PeriodStart.Equal(start) {
+			rollups = append(rollups, Rollup{
+				SerialNumber: serialNumber,
+				Granularity:  GranularityHour,
+				PeriodStart:  start,
+				MinVoltage:   reading.Voltage,
+				MaxVoltage:   reading.Voltage,
+			})
+		}
+		rollup := &rollups[len(rollups)-1]
+
+		// A register that went backwards was replaced or reset, count
+		// nothing for that step rather than negative consumption
+		if baseline != nil && reading.EnergyKWh > baseline.EnergyKWh {
+			rollup.EnergyKWh += reading.EnergyKWh - baseline.EnergyKWh
+		}
+		rollup.PeakPowerKW = max(rollup.PeakPowerKW, reading.PowerKW)
+		rollup.MinVoltage = min(rollup.MinVoltage, reading.Voltage)
+		rollup.MaxVoltage = max(rollup.MaxVoltage, reading.Voltage)
+		rollup.Samples++
+
+		current := reading
+		baseline = &current
+	}
+
+	return s.replace(ctx, serialNumber, GranularityHour, from, to, rollups)
+}
+
+// refreshFromRollups recomputes the rollups of one granularity in [from, to)
+// by summing the finer rollups they contain
+func (s *mongoRollupStore) refreshFromRollups(ctx context.Context, serialNumber, granularity, finer string, from, to time.Time) error {
+	parts, err := s.List(ctx, RollupFilter{
+		SerialNumbers: []string{serialNumber},
+		Granularity:   finer,
+		From:          from,
+		To:            to,
+	})
+	if err != nil {
+		return err
+	}
+
+	rollups := []Rollup{}
+	for _, part := range parts {
+		start := PeriodStart(granularity, part.PeriodStart)
+		if len(rollups) == 0 || !rollups[len(rollups)-1].PeriodStart.Equal(start) {
+			rollups = append(rollups, Rollup{
+				SerialNumber: serialNumber,
+				Granularity:  granularity,
+				PeriodStart:  start,
+				MinVoltage:   part.MinVoltage,
+				MaxVoltage:   part.MaxVoltage,
+			})
+		}
+		rollup := &rollups[len(rollups)-1]
+		rollup.EnergyKWh += part.EnergyKWh
+		rollup.PeakPowerKW = max(rollup.PeakPowerKW, part.PeakPowerKW)
+		rollup.MinVoltage = min(rollup.MinVoltage, part.MinVoltage)
+		rollup.MaxVoltage = max(rollup.MaxVoltage, part.MaxVoltage)
+		rollup.Samples += part.Samples
+	}
+
+	return s.replace(ctx, serialNumber, granularity, from, to, rollups)
+}
+
+// replace swaps the stored rollups in [from, to) for the recomputed ones
+func (s *mongoRollupStore) replace(ctx context.Context, serialNumber, granularity string, from, to time.Time, rollups []Rollup) error {
+	now := time.Now().UTC()
+	models := []mongo.WriteModel{
+		mongo.NewDeleteManyModel().SetFilter(bson.M{
+			"granularity":   granularity,
+			"serial_number": serialNumber,
+			"period_start":  bson.M{"$gte": from, "$lt": to},
+		}),
+	}
+	for _, rollup := range rollups {
+		rollup.UpdatedAt = now
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"granularity": granularity, "serial_number": serialNumber, "period_start": rollup.PeriodStart}).
+			SetReplacement(rollup).
+			SetUpsert(true))
+	}
+	_, err := s.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(true))
+	return err
+}
+
+func (s *mongoRollupStore) List(ctx context.Context, filter RollupFilter) ([]Rollup, error) {
+	query := bson.M{"granularity": filter.Granularity}
+	if len(filter.SerialNumbers) > 0 {
+		query["serial_number"] = bson.M{"$in": filter.SerialNumbers}
+	}
+	period := bson.M{}
+	if !filter.From.IsZero() {
+		period["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		period["$lt"] = filter.To
+	}
+	if len(period) > 0 {
+		query["period_start"] = period
+	}
+
+	cursor, err := s.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "period_start", Value: 1}, {Key: "serial_number", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	rollups := []Rollup{}
+	if err := cursor.All(ctx, &rollups); err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
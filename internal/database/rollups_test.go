@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPeriodStart(t *testing.T) {
+	// 23:30 UTC is already the next day in the Philippines
+	at := time.Date(2025, 3, 31, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		granularity string
+		want        time.Time
+	}{
+		{GranularityHour, time.Date(2025, 3, 31, 23, 0, 0, 0, time.UTC)},
+		{GranularityDay, time.Date(2025, 4, 1, 0, 0, 0, 0, RollupLocation)},
+		{GranularityMonth, time.Date(2025, 4, 1, 0, 0, 0, 0, RollupLocation)},
+	}
+	for _, tt := range tests {
+		if got := PeriodStart(tt.granularity, at); !got.Equal(tt.want) {
+			t.Errorf("PeriodStart(%q) = %v, want %v", tt.granularity, got, tt.want)
+		}
+	}
+}
+
+func TestRawHoursFrom(t *testing.T) {
+	now := time.Date(2025, 6, 30, 10, 20, 0, 0, time.UTC)
+	expired := now.Add(-RawReadingRetention)
+	if got := rawHoursFrom(now); got.Before(expired) || got.Sub(expired) > time.Hour || got.Minute() != 0 {
+		t.Errorf("rawHoursFrom() = %v, want the first hour after %v", got, expired)
+	}
+}
+
+func TestRollupStoreRefresh(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	start := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+	batch := []Reading{}
+	for i := 0; i < 8; i++ {
+		// 0.25 kWh every 15 minutes, so 1 kWh per hour
+		batch = append(batch, Reading{SerialNumber: "SM-TEST-ROLLUP", Timestamp: start.Add(time.Duration(i) * 15 * time.Minute), EnergyKWh: 500 + 0.25*float64(i), Voltage: 230})
+	}
+	if _, err := db.Readings().Insert(ctx, batch); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if err := db.Rollups().Refresh(ctx, "SM-TEST-ROLLUP", batch[0].Timestamp, batch[len(batch)-1].Timestamp); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	hours, err := db.Rollups().List(ctx, RollupFilter{SerialNumbers: []string{"SM-TEST-ROLLUP"}, Granularity: GranularityHour, From: start, To: start.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	// The first reading only sets the baseline
+	if len(hours) != 2 || hours[0].EnergyKWh != 0.75 || hours[1].EnergyKWh != 1 {
+		t.Errorf("hourly rollups = %+v, want 0.75 and 1 kWh", hours)
+	}
+
+	months, err := db.Rollups().List(ctx, RollupFilter{SerialNumbers: []string{"SM-TEST-ROLLUP"}, Granularity: GranularityMonth})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	total := 0.0
+	for _, month := range months {
+		total += month.EnergyKWh
+	}
+	if total != 1.75 {
+		t.Errorf("monthly rollups total %v kWh, want 1.75", total)
+	}
+}
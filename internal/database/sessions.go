@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Session is a logged in user agent. The ID is a hash of the cookie token,
+// the token itself is never stored.
+type Session struct {
+	ID          string             `bson:"_id"`
+	UserID      primitive.ObjectID `bson:"user_id"`
+	ClientType  string             `bson:"client_type"`
+	Role        string             `bson:"role"`
+	Remember    bool               `bson:"remember"`
+	IdleTimeout time.Duration      `bson:"idle_timeout"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	LastSeenAt  time.Time          `bson:"last_seen_at"`
+	ExpiresAt   time.Time          `bson:"expires_at"` // absolute expiry
+}
+
+// Expired reports whether the session is past its absolute or idle expiry at now
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt) || !now.Before(s.LastSeenAt.Add(s.IdleTimeout))
+}
+
+// SessionStore persists sessions
+type SessionStore interface {
+	Create(ctx context.Context, session *Session) error
+	Get(ctx context.Context, id string) (*Session, error)
+	Touch(ctx context.Context, id string, lastSeen time.Time) error
+	Delete(ctx context.Context, id string) error
+}
+
+type mongoSessionStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoSessionStore) ensureIndexes(ctx context.Context) error {
+	// Let MongoDB purge sessions once their absolute expiry has passed
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *mongoSessionStore) Create(ctx context.Context, session *Session) error {
+	_, err := s.collection.InsertOne(ctx, session)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (s *mongoSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	var session Session
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *mongoSessionStore) Touch(ctx context.Context, id string, lastSeen time.Time) error {
+	result, err := s.collection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"last_seen_at": lastSeen}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoSessionStore) Delete(ctx context.Context, id string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
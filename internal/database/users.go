@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// User is a login account, either an employee or a consumer
+type User struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Email        string             `bson:"email"`
+	PasswordHash string             `bson:"password_hash"`
+	Name         string             `bson:"name"`
+	ClientType   string             `bson:"client_type"` // matches server.ClientType
+	Role         string             `bson:"role"`        // matches server.Role
+	Profile      *Profile           `bson:"profile,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at"`
+}
+
+// Profile holds the personal details entered when an employee account is created
+type Profile struct {
+	FirstName        string    `bson:"first_name"`
+	MiddleName       string    `bson:"middle_name"`
+	LastName         string    `bson:"last_name"`
+	Suffix           string    `bson:"suffix"`
+	BirthDate        time.Time `bson:"birth_date"`
+	Province         string    `bson:"province"`
+	PostalCode       string    `bson:"postal_code"`
+	CityMunicipality string    `bson:"city_municipality"`
+	Barangay         string    `bson:"barangay"`
+	HouseStreet      string    `bson:"house_street"`
+	PhoneNumber      string    `bson:"phone_number"`
+}
+
+// FullName joins the name parts, skipping the empty ones
+func (p *Profile) FullName() string {
+	return strings.Join(strings.Fields(strings.Join([]string{p.FirstName, p.MiddleName, p.LastName, p.Suffix}, " ")), " ")
+}
+
+// UserStore persists login accounts
+type UserStore interface {
+	Create(ctx context.Context, user *User) error
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*User, error)
+}
+
+type mongoUserStore struct {
+	collection *mongo.Collection
+}
+
+// NormalizeEmail lower-cases and trims an email so lookups are case-insensitive
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (s *mongoUserStore) ensureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (s *mongoUserStore) Create(ctx context.Context, user *User) error {
+	user.Email = NormalizeEmail(user.Email)
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC()
+	}
+
+	result, err := s.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoUserStore) FindByEmail(ctx context.Context, email string) (*User, error) {
+	return s.findOne(ctx, bson.M{"email": NormalizeEmail(email)})
+}
+
+func (s *mongoUserStore) FindByID(ctx context.Context, id primitive.ObjectID) (*User, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+func (s *mongoUserStore) findOne(ctx context.Context, filter bson.M) (*User, error) {
+	var user User
+	err := s.collection.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUserStore(t *testing.T) {
+	users := New().Users()
+	ctx := context.Background()
+
+	user := &User{Email: "Cashier@Example.com", PasswordHash: "hash", ClientType: "employee", Role: "cashier"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	found, err := users.FindByEmail(ctx, "cashier@example.com")
+	if err != nil {
+		t.Fatalf("FindByEmail() error = %v", err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("FindByEmail() id = %v, want %v", found.ID, user.ID)
+	}
+
+	if err := users.Create(ctx, &User{Email: "cashier@example.com"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Create() duplicate error = %v, want %v", err, ErrDuplicate)
+	}
+
+	if _, err := users.FindByEmail(ctx, "missing@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByEmail() missing error = %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,28 @@
+/*
+ * @file internal/meterapi/commands.go
+ * @brief commands.go file holds the bodies smart meters poll and acknowledge their commands with
+ */
+package meterapi
+
+import "time"
+
+// CommandPoll is the response to a meter polling for its commands.
+// ServerTime is what a sync_clock command sets the meter clock to.
+type CommandPoll struct {
+	ServerTime time.Time       `json:"server_time"`
+	Commands   []PolledCommand `json:"commands"`
+}
+
+// PolledCommand is one command handed to a meter. A command is handed out
+// on every poll until acknowledged, so meters carry out an ID once.
+type PolledCommand struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// CommandAck is the body a meter acknowledges a command with
+type CommandAck struct {
+	Status string `json:"status"` // succeeded or failed
+	Result string `json:"result"`
+}
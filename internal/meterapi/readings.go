@@ -0,0 +1,32 @@
+/*
+ * @file internal/meterapi/readings.go
+ * @brief readings.go file holds the bodies smart meters upload their readings with
+ */
+package meterapi
+
+import "time"
+
+// Reading is one interval reading as sent by a smart meter
+type Reading struct {
+	Timestamp time.Time `json:"timestamp"`
+	EnergyKWh *float64  `json:"energy_kwh"` // cumulative register
+	PowerKW   *float64  `json:"power_kw"`   // instantaneous, negative on reverse flow
+	Voltage   *float64  `json:"voltage"`
+	Current   *float64  `json:"current"`
+	// TamperFlags lists the tamper events the meter detected during the
+	// interval, e.g. "cover_open" or "magnetic_field"
+	TamperFlags []string `json:"tamper_flags,omitempty"`
+}
+
+// ReadingBatch is the body of a reading upload. Meters send a batch of one
+// when online and their backlog after an outage.
+type ReadingBatch struct {
+	Readings []Reading `json:"readings"`
+}
+
+// ReadingResult is the response to a reading upload. Duplicates are readings
+// already stored for the same timestamp, so retries are safe.
+type ReadingResult struct {
+	Accepted   int `json:"accepted"`
+	Duplicates int `json:"duplicates"`
+}
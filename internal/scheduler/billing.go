@@ -0,0 +1,403 @@
+/*
+ * @file internal/scheduler/billing.go
+ * @brief billing.go file holds the scheduler closing the billing cycles of every book
+ */
+package scheduler
+
+import (
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/config"
+	"SmartMeterSystem/internal/database"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// billingLease names the lease the instance running the scheduler holds
+const billingLease = "billing-scheduler"
+
+// leaseReleaseTimeout bounds giving a lease up on Stop, whose own context
+// may already be expired
+const leaseReleaseTimeout = 5 * time.Second
+
+// errLeaseLost stops a run once another instance took the lease over
+var errLeaseLost = errors.New("lease lost")
+
+type BillingConfig struct {
+	Interval      time.Duration   // how often due cycles are looked for
+	LeaseTTL      time.Duration   // how long a dead instance keeps the lease
+	DueDays       int             // days from issue to due date
+	SurchargeRate decimal.Decimal // share of the balance charged once a bill falls overdue
+}
+
+// BillingConfigFromEnv reads the BILLING_* environment variables, falling
+// back to defaults for anything unset or malformed
+func BillingConfigFromEnv() BillingConfig {
+	return BillingConfig{
+		Interval:      config.Duration("BILLING_SCHEDULER_INTERVAL", 15*time.Minute),
+		LeaseTTL:      config.Duration("BILLING_LEASE_TTL", 45*time.Minute),
+		DueDays:       config.Int("BILLING_DUE_DAYS", 10, 1),
+		SurchargeRate: config.Decimal("BILLING_SURCHARGE_RATE", decimal.RequireFromString("0.02")),
+	}
+}
+
+// BillingScheduler closes the billing cycle of every book on its read date:
+// it bills the period's consumption of each active consumer of the book,
+// enters each bill in the ledger and issues it once all are drafted. It
+// also marks unpaid bills overdue and charges their late payment surcharge.
+// Only the instance holding the lease runs; every step can be repeated, so
+// a run cut short is completed by the next one.
+type BillingScheduler struct {
+	db     database.Service
+	logger *zap.Logger
+	config BillingConfig
+	books  []billing.Book
+	holder string
+	now    func() time.Time
+
+	renewedAt time.Time // when this instance last took or renewed the lease
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+func NewBillingScheduler(db database.Service, logger *zap.Logger, cfg BillingConfig) *BillingScheduler {
+	hostname, _ := os.Hostname()
+	return &BillingScheduler{
+		db:     db,
+		logger: logger,
+		config: cfg,
+		books:  billing.Books,
+		holder: fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), primitive.NewObjectID().Hex()),
+		now:    time.Now,
+		done:   make(chan struct{}),
+	}
+}
+
+// Start runs the scheduler in the background until Stop
+func (s *BillingScheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.loop(ctx)
+}
+
+// Stop cancels the current run and waits for it to return, or ctx to
+// expire. Either way it then gives the lease up so another instance can take
+// over at once.
+func (s *BillingScheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.once.Do(s.cancel)
+	var err error
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	releaseCtx, cancel := context.WithTimeout(context.Background(), leaseReleaseTimeout)
+	defer cancel()
+	return errors.Join(err, s.db.Leases().Release(releaseCtx, billingLease, s.holder))
+}
+
+func (s *BillingScheduler) loop(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Run(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Sugar().Errorf("Billing scheduler error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run closes the due cycles of every book if this instance holds the lease
+func (s *BillingScheduler) Run(ctx context.Context) error {
+	errs := []error{}
+	for _, book := range s.books {
+		// The lease is renewed before each book so a long run keeps it
+		held, err := s.db.Leases().Acquire(ctx, billingLease, s.holder, s.config.LeaseTTL)
+		if err != nil || !held {
+			return errors.Join(append(errs, err)...)
+		}
+		s.renewedAt = time.Now()
+		if err := s.closeBook(ctx, book); err != nil {
+			errs = append(errs, fmt.Errorf("book %s: %w", book.Code, err))
+		}
+	}
+
+	// A payment a failed request left out of the ledger is entered here when
+	// no other payment is posted to its account
+	if err := database.EnterPayments(ctx, s.db, primitive.NilObjectID); err != nil {
+		errs = append(errs, fmt.Errorf("payments: %w", err))
+	}
+	overdue, err := s.db.Bills().MarkOverdue(ctx, s.now())
+	if err != nil {
+		errs = append(errs, err)
+	} else if overdue > 0 {
+		s.logger.Sugar().Infof("Marked %d bills overdue", overdue)
+	}
+	if err := s.surcharge(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("surcharges: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// renewLease renews the lease once a third of its TTL went by since it was
+// last renewed, so that a book with many consumers does not outlast it
+func (s *BillingScheduler) renewLease(ctx context.Context) error {
+	if time.Since(s.renewedAt) < s.config.LeaseTTL/3 {
+		return nil
+	}
+	held, err := s.db.Leases().Acquire(ctx, billingLease, s.holder, s.config.LeaseTTL)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return errLeaseLost
+	}
+	s.renewedAt = time.Now()
+	return nil
+}
+
+// surcharge charges every overdue bill not surcharged yet its share of the
+// balance left unpaid. The ledger takes the surcharge of a bill only once, so
+// a run stopped between the two writes is completed by the next one.
+func (s *BillingScheduler) surcharge(ctx context.Context) error {
+	bills, err := s.db.Bills().ListUnsurcharged(ctx)
+	if err != nil {
+		return err
+	}
+	for _, bill := range bills {
+		if amount := bill.Balance().Mul(s.config.SurchargeRate).Round(2); amount.IsPositive() {
+			err := s.db.Ledger().Append(ctx, database.SurchargeLedgerEntry(&bill, amount))
+			if err != nil && !errors.Is(err, database.ErrDuplicate) {
+				return fmt.Errorf("bill %s: %w", bill.Number, err)
+			}
+		}
+		if err := s.db.Bills().MarkSurcharged(ctx, bill.ID); err != nil {
+			return fmt.Errorf("bill %s: %w", bill.Number, err)
+		}
+	}
+	return nil
+}
+
+// dueCycles returns the start of every period of the book to close by now:
+// from the last recorded cycle, resumed if it is still open, up to the
+// latest read date. A book never closed starts with its latest read date.
+func dueCycles(book billing.Book, latest *database.BillingCycle, now time.Time) []time.Time {
+	end := book.ReadDate(now, database.RollupLocation)
+	start := end.AddDate(0, -1, 0)
+	if latest == nil {
+		return []time.Time{start}
+	}
+
+	next := latest.PeriodStart.In(database.RollupLocation)
+	if latest.Status == database.CycleStatusIssued {
+		next = next.AddDate(0, 1, 0)
+	}
+	starts := []time.Time{}
+	for ; !next.After(start); next = next.AddDate(0, 1, 0) {
+		starts = append(starts, next)
+	}
+	return starts
+}
+
+// closeBook closes the due cycles of the book in order, stopping at the
+// first that fails so that it is retried before any later one
+func (s *BillingScheduler) closeBook(ctx context.Context, book billing.Book) error {
+	latest, err := s.db.BillingCycles().Latest(ctx, book.Code)
+	if errors.Is(err, database.ErrNotFound) {
+		latest = nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, start := range dueCycles(book, latest, s.now()) {
+		if err := s.closeCycle(ctx, book, start, start.AddDate(0, 1, 0)); err != nil {
+			return fmt.Errorf("cycle %s: %w", start.Format("2006-01-02"), err)
+		}
+	}
+	return nil
+}
+
+// closeCycle drafts the bill of every active consumer of the book that does
+// not have one for the period yet, then enters and issues them all
+func (s *BillingScheduler) closeCycle(ctx context.Context, book billing.Book, start, end time.Time) error {
+	if _, err := s.db.BillingCycles().Open(ctx, book.Code, start, end); err != nil {
+		return err
+	}
+
+	books := []string{book.Code}
+	if book.Code == s.books[0].Code {
+		books = append(books, "") // consumers without a book are read with the default one
+	}
+	consumers, err := s.db.Consumers().List(ctx, database.ConsumerFilter{Status: database.ConsumerStatusActive, Books: books})
+	if err != nil {
+		return err
+	}
+
+	var bills int64
+	for _, consumer := range consumers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.renewLease(ctx); err != nil {
+			return err
+		}
+		billed, err := s.billConsumer(ctx, &consumer, book, start, end)
+		if err != nil {
+			return fmt.Errorf("consumer %s: %w", consumer.AccountNumber, err)
+		}
+		if billed {
+			bills++
+		}
+	}
+
+	issued, err := s.issueBills(ctx, book, start)
+	if err != nil {
+		return err
+	}
+	if err := s.db.BillingCycles().Issue(ctx, book.Code, start, bills); err != nil {
+		return err
+	}
+	s.logger.Sugar().Infof("Closed book %s for %s to %s: %d bills, %d newly issued",
+		book.Code, start.Format("2006-01-02"), end.Format("2006-01-02"), bills, issued)
+	return nil
+}
+
+// issueBills charges each bill of the cycle to the ledger of its consumer,
+// then issues it if it is still a draft, returning how many were issued. A
+// bill is never issued before it is charged, so an unpaid bill cannot be
+// missing from the balance; a bill entered by an earlier run is not charged
+// again, so a run stopped between the two steps is completed by the next.
+func (s *BillingScheduler) issueBills(ctx context.Context, book billing.Book, start time.Time) (int64, error) {
+	bills, err := s.db.Bills().ListCycle(ctx, book.Code, start)
+	if err != nil {
+		return 0, err
+	}
+
+	issuedAt := s.now()
+	dueDate := database.PeriodStart(database.GranularityDay, issuedAt).AddDate(0, 0, s.config.DueDays)
+	var issued int64
+	for _, bill := range bills {
+		err := s.db.Ledger().Append(ctx, database.BillLedgerEntry(&bill))
+		if err != nil && !errors.Is(err, database.ErrDuplicate) {
+			return issued, fmt.Errorf("bill %s: %w", bill.Number, err)
+		}
+		if bill.Status != database.BillStatusDraft {
+			continue
+		}
+		if err := s.db.Bills().Issue(ctx, bill.ID, issuedAt, dueDate); err != nil {
+			return issued, fmt.Errorf("bill %s: %w", bill.Number, err)
+		}
+		issued++
+	}
+	return issued, nil
+}
+
+// billConsumer drafts the bill of one consumer for the period. It reports
+// whether the consumer has a bill for the period, false for a consumer
+// without meters.
+func (s *BillingScheduler) billConsumer(ctx context.Context, consumer *database.Consumer, book billing.Book, start, end time.Time) (bool, error) {
+	meters, err := s.db.Meters().List(ctx, database.MeterFilter{ConsumerID: consumer.ID})
+	if err != nil {
+		return false, err
+	}
+	if len(meters) == 0 {
+		return false, nil
+	}
+
+	bill := &database.Bill{
+		ConsumerID:    consumer.ID,
+		AccountNumber: consumer.AccountNumber,
+		Book:          book.Code,
+		Class:         consumer.AccountType,
+		PeriodStart:   start,
+		PeriodEnd:     end,
+	}
+	serials := make([]string, 0, len(meters))
+	for _, meter := range meters {
+		serials = append(serials, meter.SerialNumber)
+		registers := database.BillMeter{SerialNumber: meter.SerialNumber}
+		if previous, err := s.lastReading(ctx, meter.SerialNumber, start); err != nil {
+			return false, err
+		} else if previous != nil {
+			registers.PreviousKWh = previous.EnergyKWh
+		}
+		if present, err := s.lastReading(ctx, meter.SerialNumber, end); err != nil {
+			return false, err
+		} else if present != nil {
+			registers.PresentKWh = present.EnergyKWh
+		}
+		bill.Meters = append(bill.Meters, registers)
+	}
+
+	// The hourly rollups outlive the raw readings and already discount
+	// register resets
+	rollups, err := s.db.Rollups().List(ctx, database.RollupFilter{
+		SerialNumbers: serials,
+		Granularity:   database.GranularityHour,
+		From:          start,
+		To:            end,
+	})
+	if err != nil {
+		return false, err
+	}
+	var energy float64
+	var demand float64
+	for _, rollup := range rollups {
+		energy += rollup.EnergyKWh
+		demand = max(demand, rollup.PeakPowerKW)
+	}
+	usage := billing.Usage{
+		EnergyKWh: decimal.NewFromFloat(energy).Round(2),
+		DemandKW:  decimal.NewFromFloat(demand).Round(2),
+	}
+
+	schedule, err := s.db.RateSchedules().Effective(ctx, consumer.AccountType, database.RateKindBilled, end.Add(-time.Nanosecond))
+	if err != nil {
+		return false, fmt.Errorf("rates of %s: %w", consumer.AccountType, err)
+	}
+	computed, err := billing.Compute(schedule.Table(), usage)
+	if err != nil {
+		return false, err
+	}
+	bill.Usage = computed.Usage
+	bill.RateScheduleID = schedule.ID
+	bill.RateVersion = schedule.Version
+	bill.Items = computed.Items
+	bill.Subtotals = computed.Subtotals
+	bill.Total = computed.Total
+
+	err = s.db.Bills().Create(ctx, bill)
+	if errors.Is(err, database.ErrDuplicate) {
+		return true, nil // billed by an earlier run
+	}
+	return err == nil, err
+}
+
+// lastReading returns the latest reading of the meter before the time, nil
+// when there is none
+func (s *BillingScheduler) lastReading(ctx context.Context, serialNumber string, before time.Time) (*database.Reading, error) {
+	reading, err := s.db.Readings().Last(ctx, serialNumber, before)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	return reading, err
+}
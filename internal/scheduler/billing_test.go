@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/database/databasetest"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+func TestDueCycles(t *testing.T) {
+	book := billing.Book{Code: "B01", ReadDay: 5}
+	now := time.Date(2025, 4, 10, 12, 0, 0, 0, database.RollupLocation)
+	month := func(m time.Month) time.Time {
+		return time.Date(2025, m, 5, 0, 0, 0, 0, database.RollupLocation)
+	}
+
+	tests := []struct {
+		name   string
+		latest *database.BillingCycle
+		want   []time.Time
+	}{
+		{"never closed", nil, []time.Time{month(3)}},
+		{"issued two cycles back", &database.BillingCycle{PeriodStart: month(1), Status: database.CycleStatusIssued}, []time.Time{month(2), month(3)}},
+		{"open cycle resumed", &database.BillingCycle{PeriodStart: month(2), Status: database.CycleStatusOpen}, []time.Time{month(2), month(3)}},
+		{"up to date", &database.BillingCycle{PeriodStart: month(3), Status: database.CycleStatusIssued}, []time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dueCycles(book, tt.latest, now)
+			if !slices.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("dueCycles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCloseCycleEntersBeforeIssuing checks that a bill is never unpaid while
+// missing from the ledger, which would read as credit equal to its total
+func TestCloseCycleEntersBeforeIssuing(t *testing.T) {
+	ctx := context.Background()
+	book := billing.Book{Code: "B01", ReadDay: 5}
+	start := time.Date(2025, 3, 5, 0, 0, 0, 0, database.RollupLocation)
+	consumerID := primitive.NewObjectID()
+
+	ledger := &databasetest.LedgerStore{Err: errors.New("ledger unavailable")}
+	bills := &databasetest.BillStore{Bills: []database.Bill{{
+		ID: primitive.NewObjectID(), Number: "B-000001", ConsumerID: consumerID, Book: book.Code,
+		PeriodStart: start, Status: database.BillStatusDraft, Total: decimal.RequireFromString("1250.00"),
+	}}}
+	cycles := &databasetest.BillingCycleStore{}
+	scheduler := &BillingScheduler{
+		db: &databasetest.Service{
+			ConsumerStore:     &databasetest.ConsumerStore{},
+			BillStore:         bills,
+			BillingCycleStore: cycles,
+			LedgerStore:       ledger,
+		},
+		logger: zap.NewNop(),
+		config: BillingConfig{DueDays: 10},
+		books:  []billing.Book{book},
+		now:    func() time.Time { return start.AddDate(0, 1, 1) },
+	}
+	credit := func() decimal.Decimal {
+		unpaid, _ := bills.ListUnpaid(ctx, consumerID)
+		balance, _ := ledger.Balance(ctx, consumerID)
+		return database.AccountCredit(balance, unpaid)
+	}
+
+	// The ledger fails: the bill stays a draft, so the account shows no credit
+	if err := scheduler.closeCycle(ctx, book, start, start.AddDate(0, 1, 0)); err == nil {
+		t.Fatal("closeCycle() with a failing ledger error = nil")
+	}
+	if bills.Bills[0].Status != database.BillStatusDraft || cycles.Issued != nil {
+		t.Errorf("bill status = %s, cycle issued = %v, want a draft in an open cycle", bills.Bills[0].Status, cycles.Issued != nil)
+	}
+	if got := credit(); !got.IsZero() {
+		t.Errorf("AccountCredit() with the bill not entered = %s, want 0", got)
+	}
+
+	// The next run enters and issues the bill
+	ledger.Err = nil
+	if err := scheduler.closeCycle(ctx, book, start, start.AddDate(0, 1, 0)); err != nil {
+		t.Fatalf("closeCycle() error = %v", err)
+	}
+	if bills.Bills[0].Status != database.BillStatusIssued || cycles.Issued == nil || len(ledger.Entries) != 1 {
+		t.Errorf("bill status = %s, cycle issued = %v, entries = %d", bills.Bills[0].Status, cycles.Issued != nil, len(ledger.Entries))
+	}
+	if got := credit(); !got.IsZero() {
+		t.Errorf("AccountCredit() once issued = %s, want 0", got)
+	}
+
+	// Closing the issued cycle again charges nothing twice
+	if err := scheduler.closeCycle(ctx, book, start, start.AddDate(0, 1, 0)); err != nil || len(ledger.Entries) != 1 {
+		t.Errorf("closeCycle() again = %v with %d entries, want 1", err, len(ledger.Entries))
+	}
+}
+
+// TestCloseCycleStopsWithoutLease checks that a run stops billing once
+// another instance took the lease over
+func TestCloseCycleStopsWithoutLease(t *testing.T) {
+	book := billing.Book{Code: "B01", ReadDay: 5}
+	start := time.Date(2025, 3, 5, 0, 0, 0, 0, database.RollupLocation)
+	leases := &databasetest.LeaseStore{Holders: map[string]string{billingLease: "other"}}
+	scheduler := &BillingScheduler{
+		db: &databasetest.Service{
+			ConsumerStore:     &databasetest.ConsumerStore{Consumers: []database.Consumer{{ID: primitive.NewObjectID(), AccountNumber: "0000001"}}},
+			BillingCycleStore: &databasetest.BillingCycleStore{},
+			LeaseStore:        leases,
+		},
+		logger: zap.NewNop(),
+		config: BillingConfig{LeaseTTL: time.Minute},
+		books:  []billing.Book{book},
+		holder: "this",
+		now:    func() time.Time { return start.AddDate(0, 1, 1) },
+	}
+
+	err := scheduler.closeCycle(context.Background(), book, start, start.AddDate(0, 1, 0))
+	if !errors.Is(err, errLeaseLost) {
+		t.Errorf("closeCycle() without the lease error = %v, want %v", err, errLeaseLost)
+	}
+}
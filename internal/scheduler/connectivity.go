@@ -0,0 +1,191 @@
+/*
+ * @file internal/scheduler/connectivity.go
+ * @brief connectivity.go file holds the monitor marking meters online, stale or offline from when they were last heard from
+ */
+package scheduler
+
+import (
+	"SmartMeterSystem/internal/config"
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/telemetry"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// connectivityLease names the lease the instance running the monitor holds
+const connectivityLease = "connectivity-monitor"
+
+type ConnectivityConfig struct {
+	Interval     time.Duration // how often the meters are checked
+	LeaseTTL     time.Duration // how long a dead instance keeps the lease
+	StaleAfter   time.Duration // silence after which a meter is stale
+	OfflineAfter time.Duration // silence after which a meter is offline
+}
+
+// ConnectivityConfigFromEnv reads the METER_* environment variables, falling
+// back to defaults suiting meters reporting every 15 minutes
+func ConnectivityConfigFromEnv() ConnectivityConfig {
+	cfg := ConnectivityConfig{
+		Interval:     config.Duration("METER_CHECK_INTERVAL", time.Minute),
+		LeaseTTL:     config.Duration("METER_LEASE_TTL", 3*time.Minute),
+		StaleAfter:   config.Duration("METER_STALE_AFTER", 20*time.Minute),
+		OfflineAfter: config.Duration("METER_OFFLINE_AFTER", time.Hour),
+	}
+	if cfg.OfflineAfter < cfg.StaleAfter {
+		cfg.OfflineAfter = cfg.StaleAfter
+	}
+	return cfg
+}
+
+// ConnectivityMonitor marks every meter in service online, stale or offline
+// from when it last uploaded readings or sent a heartbeat. Each change is
+// recorded as a transition, so outages can be measured, and pushed to the
+// dashboards. Only the instance holding the lease runs.
+type ConnectivityMonitor struct {
+	db        database.Service
+	telemetry *telemetry.Hub
+	logger    *zap.Logger
+	config    ConnectivityConfig
+	holder    string
+	now       func() time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+func NewConnectivityMonitor(db database.Service, hub *telemetry.Hub, logger *zap.Logger, cfg ConnectivityConfig) *ConnectivityMonitor {
+	hostname, _ := os.Hostname()
+	return &ConnectivityMonitor{
+		db:        db,
+		telemetry: hub,
+		logger:    logger,
+		config:    cfg,
+		holder:    fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), primitive.NewObjectID().Hex()),
+		now:       time.Now,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs the monitor in the background until Stop
+func (m *ConnectivityMonitor) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	go m.loop(ctx)
+}
+
+// Stop cancels the current run and waits for it to return, or ctx to
+// expire. Either way it then gives the lease up so another instance can take
+// over at once.
+func (m *ConnectivityMonitor) Stop(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.once.Do(m.cancel)
+	var err error
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	releaseCtx, cancel := context.WithTimeout(context.Background(), leaseReleaseTimeout)
+	defer cancel()
+	return errors.Join(err, m.db.Leases().Release(releaseCtx, connectivityLease, m.holder))
+}
+
+func (m *ConnectivityMonitor) loop(ctx context.Context) {
+	defer close(m.done)
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Run(ctx); err != nil && ctx.Err() == nil {
+			m.logger.Sugar().Errorf("Connectivity monitor error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run checks every meter in service if this instance holds the lease
+func (m *ConnectivityMonitor) Run(ctx context.Context) error {
+	held, err := m.db.Leases().Acquire(ctx, connectivityLease, m.holder, m.config.LeaseTTL)
+	if err != nil || !held {
+		return err
+	}
+
+	meters, err := m.db.Meters().List(ctx, database.MeterFilter{
+		Statuses: []string{database.MeterStatusActive, database.MeterStatusInactive},
+	})
+	if err != nil {
+		return err
+	}
+
+	now := m.now().UTC()
+	errs := []error{}
+	for _, meter := range meters {
+		to := classifyConnectivity(meter.LastSeenAt, now, m.config)
+		if to == meter.Connectivity {
+			continue
+		}
+		if err := m.transition(ctx, &meter, to, now); err != nil {
+			errs = append(errs, fmt.Errorf("meter %s: %w", meter.SerialNumber, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// transition moves the meter to the connectivity, records the transition
+// and publishes it. A meter changed meanwhile is left to the next run.
+func (m *ConnectivityMonitor) transition(ctx context.Context, meter *database.Meter, to string, now time.Time) error {
+	err := m.db.Meters().SetConnectivity(ctx, meter.SerialNumber, meter.Connectivity, to, now)
+	if errors.Is(err, database.ErrConflict) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.telemetry.Publish(telemetry.Event{
+		Type:         telemetry.EventConnectivity,
+		Serial:       meter.SerialNumber,
+		Connectivity: to,
+		At:           now,
+	})
+	if meter.Connectivity != "" {
+		m.logger.Sugar().Infof("Meter %s went %s from %s, last seen %s",
+			meter.SerialNumber, to, meter.Connectivity, meter.LastSeenAt.Format(time.RFC3339))
+	}
+	return m.db.Connectivity().Record(ctx, &database.ConnectivityTransition{
+		SerialNumber: meter.SerialNumber,
+		From:         meter.Connectivity,
+		To:           to,
+		LastSeenAt:   meter.LastSeenAt,
+		At:           now,
+	})
+}
+
+// classifyConnectivity returns the connectivity of a meter last heard from
+// at lastSeen; a meter never heard from is offline
+func classifyConnectivity(lastSeen, now time.Time, cfg ConnectivityConfig) string {
+	silence := now.Sub(lastSeen)
+	switch {
+	case lastSeen.IsZero() || silence >= cfg.OfflineAfter:
+		return database.ConnectivityOffline
+	case silence >= cfg.StaleAfter:
+		return database.ConnectivityStale
+	default:
+		return database.ConnectivityOnline
+	}
+}
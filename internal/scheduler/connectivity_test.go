@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"SmartMeterSystem/internal/database"
+	"testing"
+	"time"
+)
+
+func TestClassifyConnectivity(t *testing.T) {
+	config := ConnectivityConfig{StaleAfter: 20 * time.Minute, OfflineAfter: time.Hour}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		lastSeen time.Time
+		want     string
+	}{
+		{"never seen", time.Time{}, database.ConnectivityOffline},
+		{"just reported", now.Add(-time.Minute), database.ConnectivityOnline},
+		{"missed a reading", now.Add(-20 * time.Minute), database.ConnectivityStale},
+		{"silent for an hour", now.Add(-time.Hour), database.ConnectivityOffline},
+		{"clock ahead", now.Add(time.Minute), database.ConnectivityOnline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyConnectivity(tt.lastSeen, now, config); got != tt.want {
+				t.Errorf("classifyConnectivity() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectivityConfigFromEnv(t *testing.T) {
+	t.Setenv("METER_STALE_AFTER", "2h")
+	t.Setenv("METER_OFFLINE_AFTER", "1h")
+	config := ConnectivityConfigFromEnv()
+	if config.StaleAfter != 2*time.Hour || config.OfflineAfter != 2*time.Hour {
+		t.Errorf("ConnectivityConfigFromEnv() = %+v, want offline no sooner than stale", config)
+	}
+}
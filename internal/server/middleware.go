@@ -5,7 +5,11 @@
 package server
 
 import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/auth"
+	"errors"
 	"net/http"
+	"strings"
 )
 
 func (s *Server) applyMiddleware(handler http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
@@ -25,6 +29,77 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// sessionMiddleware attaches the session of the request, if any, to its context
+func (s *Server) sessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := s.sessions.Load(r)
+		switch {
+		case err == nil:
+			r = r.WithContext(auth.WithSession(r.Context(), session))
+		case !errors.Is(err, auth.ErrNoSession):
+			s.GetLogger().Sugar().Errorf("Session lookup failed: %v", err)
+		}
+
+		// Proceed with the next handler
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizationMiddleware enforces routePermissions. It must run inside
+// sessionMiddleware so the session is already on the request context.
+func (s *Server) authorizationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		permission, protected := permissionFor(r)
+		if !protected {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		session := auth.SessionFromContext(r.Context())
+		if session == nil {
+			s.redirectToLogin(w, r)
+			return
+		}
+
+		if !permission.allows(Role(session.Role)) {
+			s.GetLogger().Sugar().Warnf("Denied %s %s to %s %s", r.Method, r.URL.Path, session.Role, session.UserID.Hex())
+			s.forbidden(w, r)
+			return
+		}
+
+		// Proceed with the next handler
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToLogin sends the user to the login page matching the route group
+func (s *Server) redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	clientType := EmployeeType
+	if strings.HasPrefix(r.URL.Path, "/consumer/") {
+		clientType = ConsumerType
+	}
+	loginURL := "/" + s.GetDefaultRouteVersion() + "/" + string(clientType) + "/login?user_type=" + string(clientType)
+
+	if r.Header.Get("HX-Request") == "true" {
+		// HTMX follows HX-Redirect whatever the status code
+		w.Header().Set("HX-Redirect", loginURL)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	http.Redirect(w, r, loginURL, http.StatusSeeOther)
+}
+
+// forbidden renders a 403 page, or a fragment for HTMX requests
+func (s *Server) forbidden(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusForbidden)
+	if r.Header.Get("HX-Request") == "true" {
+		web.AccessDeniedMessage().Render(r.Context(), w)
+		return
+	}
+	web.Forbidden().Render(r.Context(), w)
+}
+
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
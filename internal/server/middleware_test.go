@@ -0,0 +1,114 @@
+package server
+
+import (
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/database"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+func newTestServer() *Server {
+	return &Server{
+		logger:              zap.NewNop(),
+		defaultRouteVersion: "v1",
+		sessions:            auth.NewSessionManager(database.NewMemorySessionStore(), auth.SessionConfigFromEnv()),
+	}
+}
+
+// sessionCookie logs in a user with the given role and returns its cookie
+func sessionCookie(t *testing.T, s *Server, role Role) *http.Cookie {
+	t.Helper()
+	clientType := EmployeeType
+	if role == RoleConsumer {
+		clientType = ConsumerType
+	}
+	user := &database.User{ID: primitive.NewObjectID(), ClientType: string(clientType), Role: string(role)}
+
+	rec := httptest.NewRecorder()
+	if _, err := s.sessions.Start(rec, httptest.NewRequest("POST", "/login", nil), user, false); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return rec.Result().Cookies()[0]
+}
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	s := newTestServer()
+	handler := s.applyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), s.authorizationMiddleware, s.sessionMiddleware)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		role   Role // empty sends no session
+		htmx   bool
+		want   int
+	}{
+		{"public login page", "GET", "/employee/login", "", false, http.StatusOK},
+		{"anonymous page redirects to login", "GET", "/employee/sysadmin/dashboard", "", false, http.StatusSeeOther},
+		{"anonymous htmx request", "GET", "/employee/sysadmin/dashboard/meter-list", "", true, http.StatusUnauthorized},
+		{"system admin", "GET", "/employee/sysadmin/dashboard", RoleSystemAdmin, false, http.StatusOK},
+		{"sysadmin tree root", "GET", "/employee/sysadmin", RoleSystemAdmin, false, http.StatusOK},
+		{"cashier on sysadmin page", "GET", "/employee/sysadmin/accounting", RoleCashier, false, http.StatusForbidden},
+		{"financial admin on sysadmin rates", "POST", "/employee/sysadmin/accounting/submit-update-rates-form", RoleFinancialAdmin, true, http.StatusForbidden},
+		{"cashier updates rates", "POST", "/employee/sysadmin/accounting/submit-update-rates-form", RoleCashier, true, http.StatusForbidden},
+		{"cashier imports rates", "POST", "/employee/sysadmin/accounting/import-rates", RoleCashier, true, http.StatusForbidden},
+		{"any employee logs out", "GET", "/employee/sysadmin/logout", RoleFieldAdmin, true, http.StatusOK},
+		{"consumer dashboard", "GET", "/consumer/dashboard", RoleConsumer, false, http.StatusOK},
+		{"employee on consumer dashboard", "GET", "/consumer/dashboard", RoleSystemAdmin, false, http.StatusForbidden},
+		{"employee on consumer bill", "GET", "/consumer/billing/0123456789abcdef01234567.pdf", RoleCashier, false, http.StatusForbidden},
+		{"prefix is segment aware", "GET", "/employee/sysadminx", "", false, http.StatusOK},
+		{"cashier console", "GET", "/employee/cashier/dashboard", RoleCashier, false, http.StatusOK},
+		{"hr admin on finance console", "GET", "/employee/finance/accounting", RoleHRAdmin, false, http.StatusForbidden},
+		{"finance console updates rates", "POST", "/employee/finance/accounting/submit-update-rates-form", RoleFinancialAdmin, true, http.StatusOK},
+		{"finance console updates ERC rates", "POST", "/employee/finance/accounting/submit-update-erc-form", RoleFinancialAdmin, true, http.StatusOK},
+		{"finance console imports rates", "POST", "/employee/finance/accounting/import-rates", RoleFinancialAdmin, true, http.StatusOK},
+		{"finance console reviews rates", "POST", "/employee/finance/accounting/review-rates/0123456789abcdef01234567", RoleFinancialAdmin, true, http.StatusOK},
+		{"field admin reviews rates", "POST", "/employee/finance/accounting/review-rates/0123456789abcdef01234567", RoleFieldAdmin, true, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.role != "" {
+				r.AddCookie(sessionCookie(t, s, tt.role))
+			}
+			if tt.htmx {
+				r.Header.Set("HX-Request", "true")
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if rec.Code != tt.want {
+				t.Errorf("%s %s as %q = %d, want %d", tt.method, tt.path, tt.role, rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("HX-Redirect") == "" {
+				t.Error("unauthenticated htmx request has no HX-Redirect")
+			}
+		})
+	}
+}
+
+func TestGetConsoleURL(t *testing.T) {
+	s := newTestServer()
+
+	for role := range roleConsoles {
+		url, ok := s.GetConsoleURL(string(role))
+		if !ok || url == "" {
+			t.Errorf("GetConsoleURL(%q) = %q, %v", role, url, ok)
+		}
+	}
+
+	if url, _ := s.GetConsoleURL(string(RoleFieldAdmin)); url != "/v1/employee/field/dashboard" {
+		t.Errorf("GetConsoleURL(field_admin) = %q", url)
+	}
+	if _, ok := s.GetConsoleURL(string(RoleConsumer)); ok {
+		t.Error("GetConsoleURL(consumer) found an employee console")
+	}
+}
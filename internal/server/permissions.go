@@ -0,0 +1,87 @@
+/*
+ * @file internal/server/permissions.go
+ * @brief permissions.go file declares which roles may access each route
+ */
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// routePermission restricts a route, and everything below it, to a set of
+// roles. Paths are relative to the version prefix (e.g. "/employee/...").
+type routePermission struct {
+	Method string // empty matches every method
+	Path   string
+	Roles  []Role // empty allows any logged in user
+}
+
+// routePermissions lists the protected routes. When several entries match a
+// request the one with the longest path wins, so specific routes can widen
+// or narrow the rule of their parent. Routes not listed here are public.
+var routePermissions = []routePermission{
+	// Consumer
+	{Path: "/consumer/dashboard", Roles: []Role{RoleConsumer}},
+	{Path: "/consumer/billing", Roles: []Role{RoleConsumer}},
+
+	// System Admin
+	{Path: "/employee/sysadmin", Roles: []Role{RoleSystemAdmin}},
+	{Path: "/employee/sysadmin/logout"},
+
+	// Cashier
+	{Path: "/employee/cashier", Roles: []Role{RoleCashier}},
+	{Path: "/employee/cashier/logout"},
+
+	// Field Admin
+	{Path: "/employee/field", Roles: []Role{RoleFieldAdmin}},
+	{Path: "/employee/field/logout"},
+
+	// Finance Admin
+	{Path: "/employee/finance", Roles: []Role{RoleFinancialAdmin}},
+	{Path: "/employee/finance/logout"},
+
+	// HR Admin
+	{Path: "/employee/hr", Roles: []Role{RoleHRAdmin}},
+	{Path: "/employee/hr/logout"},
+
+	// Customer Admin
+	{Path: "/employee/customer", Roles: []Role{RoleCustomerServiceAdmin}},
+	{Path: "/employee/customer/logout"},
+}
+
+// roleConsoles maps each employee role to the path segment of its console
+var roleConsoles = map[Role]string{
+	RoleSystemAdmin:          "sysadmin",
+	RoleCashier:              "cashier",
+	RoleFieldAdmin:           "field",
+	RoleFinancialAdmin:       "finance",
+	RoleHRAdmin:              "hr",
+	RoleCustomerServiceAdmin: "customer",
+}
+
+// matches reports whether the permission applies to the request
+func (p routePermission) matches(r *http.Request) bool {
+	if p.Method != "" && p.Method != r.Method {
+		return false
+	}
+	return r.URL.Path == p.Path || strings.HasPrefix(r.URL.Path, p.Path+"/")
+}
+
+// allows reports whether the role satisfies the permission
+func (p routePermission) allows(role Role) bool {
+	return len(p.Roles) == 0 || slices.Contains(p.Roles, role)
+}
+
+// permissionFor returns the most specific permission matching the request
+func permissionFor(r *http.Request) (routePermission, bool) {
+	var best routePermission
+	found := false
+	for _, p := range routePermissions {
+		if p.matches(r) && (!found || len(p.Path) > len(best.Path)) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,376 @@
+/*
+ * @file internal/server/routes/accounts.go
+ * @brief accounts.go file holds the account creation handlers and their form validation
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/telemetry"
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayout is the value format of <input type="date">
+const dateLayout = "2006-01-02"
+
+var (
+	digitsPattern     = regexp.MustCompile(`^[0-9]+$`)
+	postalCodePattern = regexp.MustCompile(`^[0-9]{4}$`)
+	phonePattern      = regexp.MustCompile(`^0[0-9]{9,10}$`)
+)
+
+// formValidator reads the fields of a submitted form, collecting an error for
+// every field that is missing or malformed
+type formValidator struct {
+	form   url.Values
+	errors []web.FormFieldError
+	now    time.Time
+}
+
+func newFormValidator(form url.Values) *formValidator {
+	return &formValidator{form: form, now: time.Now()}
+}
+
+func (v *formValidator) fail(label, message string) {
+	v.errors = append(v.errors, web.FormFieldError{Field: label, Message: message})
+}
+
+func (v *formValidator) optional(name string) string {
+	return strings.TrimSpace(v.form.Get(name))
+}
+
+func (v *formValidator) required(name, label string) string {
+	value := v.optional(name)
+	if value == "" {
+		v.fail(label, "is required")
+	}
+	return value
+}
+
+// digits reads a numeric identifier, keeping it as a string so leading zeros survive
+func (v *formValidator) digits(name, label string, required bool) string {
+	value := v.optional(name)
+	switch {
+	case value == "" && required:
+		v.fail(label, "is required")
+	case value != "" && !digitsPattern.MatchString(value):
+		v.fail(label, "must contain digits only")
+	}
+	return value
+}
+
+// pastDate reads a yyyy-mm-dd date that may not lie in the future
+func (v *formValidator) pastDate(name, label string) time.Time {
+	value := v.required(name, label)
+	if value == "" {
+		return time.Time{}
+	}
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		v.fail(label, "must be a date in YYYY-MM-DD format")
+		return time.Time{}
+	}
+	if date.After(v.now) {
+		v.fail(label, "cannot be in the future")
+	}
+	return date
+}
+
+// coordinate reads a required decimal number within [min, max]
+func (v *formValidator) coordinate(name, label string, min, max float64) float64 {
+	value := v.required(name, label)
+	if value == "" {
+		return 0
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		v.fail(label, "must be a number")
+		return 0
+	}
+	if number < min || number > max {
+		v.fail(label, fmt.Sprintf("must be between %g and %g", min, max))
+	}
+	return number
+}
+
+func (v *formValidator) postalCode(name, label string) string {
+	value := v.required(name, label)
+	if value != "" && !postalCodePattern.MatchString(value) {
+		v.fail(label, "must be a 4 digit postal code")
+	}
+	return value
+}
+
+// phone reads a Philippine mobile or landline number, normalising the
+// separators away and "+63" to the leading "0"
+func (v *formValidator) phone(name, label string) string {
+	value := v.required(name, label)
+	if value == "" {
+		return ""
+	}
+	value = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(value)
+	if rest, ok := strings.CutPrefix(value, "+63"); ok {
+		value = "0" + rest
+	}
+	if !phonePattern.MatchString(value) {
+		v.fail(label, "must be a phone number such as 09171234567")
+	}
+	return value
+}
+
+func (v *formValidator) email(name, label string, required bool) string {
+	value := v.optional(name)
+	switch {
+	case value == "" && required:
+		v.fail(label, "is required")
+	case value != "":
+		if address, err := mail.ParseAddress(value); err != nil || address.Address != value {
+			v.fail(label, "must be a valid email address")
+		}
+	}
+	return value
+}
+
+func (v *formValidator) oneOf(name, label string, values []string) string {
+	value := v.required(name, label)
+	if value != "" && !slices.Contains(values, value) {
+		v.fail(label, "is not a valid option")
+	}
+	return value
+}
+
+// parseMeterForm validates the fields posted by web.NewMeterAccountForm
+func parseMeterForm(form url.Values) (*database.Meter, []web.FormFieldError) {
+	v := newFormValidator(form)
+	meter := &database.Meter{
+		SNID:             v.digits("snid", "SNID", true),
+		SerialNumber:     v.required("serial_number", "SN"),
+		InstallationDate: v.pastDate("installation_date", "Installation Date"),
+		TransformerID:    v.digits("transformer_id", "Transformer ID", true),
+		Location:         v.optional("location"),
+		Latitude:         v.coordinate("latitude", "Latitude", -90, 90),
+		Longitude:        v.coordinate("longitude", "Longitude", -180, 180),
+	}
+	return meter, v.errors
+}
+
+// parseProfile validates the name, address and contact fields shared by the
+// consumer and employee forms
+func parseProfile(v *formValidator) database.Profile {
+	return database.Profile{
+		FirstName:        v.required("first_name", "First Name"),
+		MiddleName:       v.optional("middle_name"),
+		LastName:         v.required("last_name", "Last Name"),
+		Suffix:           v.optional("suffix"),
+		BirthDate:        v.pastDate("birth_date", "Birth Date"),
+		Province:         v.required("province", "Province"),
+		PostalCode:       v.postalCode("postal_code", "Postal Code"),
+		CityMunicipality: v.required("city_municipality", "City/Municipality"),
+		Barangay:         v.required("barangay", "Barangay"),
+		HouseStreet:      v.required("house_street", "House or Building Number, Street Name"),
+		PhoneNumber:      v.phone("phone_number", "Phone Number"),
+	}
+}
+
+// parseConsumerForm validates the fields posted by web.NewConsumerAccountForm.
+// It also returns the serial number of the meter to link, if any.
+func parseConsumerForm(form url.Values) (*database.Consumer, string, []web.FormFieldError) {
+	v := newFormValidator(form)
+	profile := parseProfile(v)
+	consumer := &database.Consumer{
+		FirstName:        profile.FirstName,
+		MiddleName:       profile.MiddleName,
+		LastName:         profile.LastName,
+		Suffix:           profile.Suffix,
+		BirthDate:        profile.BirthDate,
+		Province:         profile.Province,
+		PostalCode:       profile.PostalCode,
+		CityMunicipality: profile.CityMunicipality,
+		Barangay:         profile.Barangay,
+		HouseStreet:      profile.HouseStreet,
+		PhoneNumber:      profile.PhoneNumber,
+		Email:            v.email("email", "Email", false),
+		AccountType: v.oneOf("account_type", "Account Type", []string{
+			database.ConsumerTypeResidential,
+			database.ConsumerTypeCommercial,
+			database.ConsumerTypeIndustrial,
+		}),
+		TransformerID: v.digits("transformer_id", "Transformer ID", true),
+		SNID:          v.digits("snid", "SNID", false),
+	}
+
+	// A consumer left without a book is read with the default one
+	consumer.Book = cmp.Or(v.optional("book"), billing.Books[0].Code)
+	if !slices.Contains(billing.BookCodes(), consumer.Book) {
+		v.fail("Route/Book", "is not a valid option")
+	}
+	return consumer, v.optional("meter_serial_number"), v.errors
+}
+
+// parseEmployeeForm validates the fields posted by web.NewEmployeeAccountForm.
+// It also returns the initial password of the account.
+func parseEmployeeForm(form url.Values) (*database.User, string, []web.FormFieldError) {
+	v := newFormValidator(form)
+	profile := parseProfile(v)
+
+	roles := make([]string, 0, len(web.EmployeeAccountTypes))
+	for _, accountType := range web.EmployeeAccountTypes {
+		roles = append(roles, accountType.Role)
+	}
+	user := &database.User{
+		Email:      v.email("email", "Email", true),
+		ClientType: "employee",
+		Role:       v.oneOf("role", "Account Type", roles),
+		Profile:    &profile,
+	}
+	user.Name = profile.FullName()
+
+	password := v.form.Get("password")
+	if password == "" {
+		v.fail("Initial Password", "is required")
+	} else if len(password) < auth.MinPasswordLength {
+		v.fail("Initial Password", fmt.Sprintf("must be at least %d characters", auth.MinPasswordLength))
+	}
+	return user, password, v.errors
+}
+
+func (c *V1EmployeeRoute) createMeterAccount(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	meter, errs := parseMeterForm(r.PostForm)
+	if len(errs) > 0 {
+		renderFormErrors(w, r, errs)
+		return
+	}
+
+	// The token is only shown once, the meter stores the hash
+	token, hash, err := auth.NewDeviceToken()
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Device token error: %v", err)
+		http.Error(w, "Error creating meter", http.StatusInternalServerError)
+		return
+	}
+	meter.DeviceTokenHash = hash
+
+	err = c.Deps.GetDB().Meters().Create(r.Context(), meter)
+	if errors.Is(err, database.ErrDuplicate) {
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "SN", Message: "is already registered"}})
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Meter create error: %v", err)
+		http.Error(w, "Error creating meter", http.StatusInternalServerError)
+		return
+	}
+
+	c.Deps.GetLogger().Sugar().Infof("Registered meter %s", meter.SerialNumber)
+	c.Deps.GetTelemetry().Publish(telemetry.Event{Type: telemetry.EventStatus, Serial: meter.SerialNumber, Status: meter.Status})
+	w.Header().Set("Content-Type", "text/html")
+	web.MeterRegisteredMessage(meter.SerialNumber, token).Render(r.Context(), w)
+}
+
+func (c *V1EmployeeRoute) createConsumerAccount(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	consumer, serialNumber, errs := parseConsumerForm(r.PostForm)
+	if len(errs) > 0 {
+		renderFormErrors(w, r, errs)
+		return
+	}
+
+	// Check the meter before creating the account so a bad serial number
+	// does not leave an account behind
+	if serialNumber != "" {
+		meter, err := c.Deps.GetDB().Meters().Get(r.Context(), serialNumber)
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			renderFormErrors(w, r, []web.FormFieldError{{Field: "Meter SN", Message: "is not a registered meter"}})
+			return
+		case err != nil:
+			c.Deps.GetLogger().Sugar().Errorf("Meter lookup error: %v", err)
+			http.Error(w, "Error creating consumer", http.StatusInternalServerError)
+			return
+		case meter.Status == database.MeterStatusDecommissioned:
+			renderFormErrors(w, r, []web.FormFieldError{{Field: "Meter SN", Message: "is decommissioned"}})
+			return
+		case !meter.ConsumerID.IsZero():
+			renderFormErrors(w, r, []web.FormFieldError{{Field: "Meter SN", Message: "is already linked to a consumer"}})
+			return
+		}
+	}
+
+	if err := c.Deps.GetDB().Consumers().Create(r.Context(), consumer); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Consumer create error: %v", err)
+		http.Error(w, "Error creating consumer", http.StatusInternalServerError)
+		return
+	}
+	if serialNumber != "" {
+		if err := c.Deps.GetDB().Meters().AssignConsumer(r.Context(), serialNumber, consumer.ID); err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Meter assign error: %v", err)
+			renderFormSuccess(w, r, "Consumer account "+consumer.AccountNumber+" created, but meter "+serialNumber+" could not be linked")
+			return
+		}
+	}
+
+	c.Deps.GetLogger().Sugar().Infof("Created consumer account %s", consumer.AccountNumber)
+	renderFormSuccess(w, r, "Consumer account "+consumer.AccountNumber+" created")
+}
+
+func (c *V1EmployeeRoute) createEmployeeAccount(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	user, password, errs := parseEmployeeForm(r.PostForm)
+	if len(errs) > 0 {
+		renderFormErrors(w, r, errs)
+		return
+	}
+
+	err := c.Deps.GetAuthenticator().CreateUser(r.Context(), user, password)
+	if errors.Is(err, database.ErrDuplicate) {
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "Email", Message: "is already used by another account"}})
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Employee create error: %v", err)
+		http.Error(w, "Error creating employee", http.StatusInternalServerError)
+		return
+	}
+
+	c.Deps.GetLogger().Sugar().Infof("Created %s account %s", user.Role, user.Email)
+	renderFormSuccess(w, r, "Employee account "+user.Email+" created")
+}
+
+// renderFormErrors writes the field errors into the #form-response target.
+// 422 responses are swapped, see the htmx-config of web.Base.
+func renderFormErrors(w http.ResponseWriter, r *http.Request, errs []web.FormFieldError) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	web.FormErrorsMessage(errs).Render(r.Context(), w)
+}
+
+func renderFormSuccess(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("Content-Type", "text/html")
+	web.FormSuccessMessage(message).Render(r.Context(), w)
+}
@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/billing"
+	"net/url"
+	"testing"
+)
+
+func validMeterForm() url.Values {
+	return url.Values{
+		"snid":              {"1001"},
+		"serial_number":     {"SM-0001"},
+		"installation_date": {"2024-05-01"},
+		"transformer_id":    {"42"},
+		"latitude":          {"13.838432"},
+		"longitude":         {"120.632360"},
+	}
+}
+
+func validProfileForm() url.Values {
+	return url.Values{
+		"first_name":        {"Juan"},
+		"last_name":         {"Dela Cruz"},
+		"birth_date":        {"1990-01-31"},
+		"province":          {"Batangas"},
+		"postal_code":       {"4215"},
+		"city_municipality": {"Calatagan"},
+		"barangay":          {"Poblacion"},
+		"house_street":      {"123 Rizal St."},
+		"phone_number":      {"+63 917 123 4567"},
+	}
+}
+
+func hasFieldError(errs []web.FormFieldError, field string) bool {
+	for _, err := range errs {
+		if err.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseMeterForm(t *testing.T) {
+	meter, errs := parseMeterForm(validMeterForm())
+	if len(errs) > 0 {
+		t.Fatalf("parseMeterForm() errors = %+v", errs)
+	}
+	if meter.SerialNumber != "SM-0001" || meter.Latitude != 13.838432 || meter.InstallationDate.Month() != 5 {
+		t.Errorf("parseMeterForm() = %+v", meter)
+	}
+
+	tests := []struct {
+		field, value, label string
+	}{
+		{"serial_number", "", "SN"},
+		{"snid", "12a", "SNID"},
+		{"installation_date", "05/01/2024", "Installation Date"},
+		{"installation_date", "2999-01-01", "Installation Date"},
+		{"latitude", "91", "Latitude"},
+		{"longitude", "-180.5", "Longitude"},
+		{"longitude", "east", "Longitude"},
+	}
+	for _, tt := range tests {
+		form := validMeterForm()
+		form.Set(tt.field, tt.value)
+		if _, errs := parseMeterForm(form); !hasFieldError(errs, tt.label) {
+			t.Errorf("parseMeterForm() with %s=%q errors = %+v, want a %q error", tt.field, tt.value, errs, tt.label)
+		}
+	}
+}
+
+func TestParseConsumerForm(t *testing.T) {
+	form := validProfileForm()
+	form.Set("account_type", "residential")
+	form.Set("transformer_id", "42")
+	form.Set("meter_serial_number", " SM-0001 ")
+
+	consumer, serial, errs := parseConsumerForm(form)
+	if len(errs) > 0 {
+		t.Fatalf("parseConsumerForm() errors = %+v", errs)
+	}
+	if consumer.PhoneNumber != "09171234567" || serial != "SM-0001" || consumer.Book != billing.Books[0].Code {
+		t.Errorf("parseConsumerForm() = %+v, %q", consumer, serial)
+	}
+
+	form.Set("phone_number", "12345")
+	form.Set("account_type", "government")
+	form.Set("email", "not-an-email")
+	form.Set("book", "Z99")
+	_, _, errs = parseConsumerForm(form)
+	for _, label := range []string{"Phone Number", "Account Type", "Email", "Route/Book"} {
+		if !hasFieldError(errs, label) {
+			t.Errorf("parseConsumerForm() errors = %+v, want a %q error", errs, label)
+		}
+	}
+}
+
+func TestParseEmployeeForm(t *testing.T) {
+	form := validProfileForm()
+	form.Set("email", "cashier@example.com")
+	form.Set("password", "correct-horse")
+	form.Set("role", "cashier")
+
+	user, password, errs := parseEmployeeForm(form)
+	if len(errs) > 0 {
+		t.Fatalf("parseEmployeeForm() errors = %+v", errs)
+	}
+	if user.Name != "Juan Dela Cruz" || user.ClientType != "employee" || password != "correct-horse" {
+		t.Errorf("parseEmployeeForm() = %+v", user)
+	}
+
+	form.Set("role", "system_admin")
+	form.Set("password", "short")
+	_, _, errs = parseEmployeeForm(form)
+	for _, label := range []string{"Account Type", "Initial Password"} {
+		if !hasFieldError(errs, label) {
+			t.Errorf("parseEmployeeForm() errors = %+v, want a %q error", errs, label)
+		}
+	}
+}
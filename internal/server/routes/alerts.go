@@ -0,0 +1,133 @@
+/*
+ * @file internal/server/routes/alerts.go
+ * @brief alerts.go file lists the meter alerts on the dashboard and lets employees acknowledge and resolve them
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/alerting"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/database"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// alertListLimit bounds the alerts listed on the dashboard
+	alertListLimit = 100
+	// maxResolutionLength bounds what an employee writes resolving an alert
+	maxResolutionLength = 500
+)
+
+// alertList renders the unresolved alerts
+func (c *V1EmployeeRoute) alertList(w http.ResponseWriter, r *http.Request) {
+	c.renderAlertList(w, r, "")
+}
+
+// renderAlertList renders the unresolved alerts with the notice
+func (c *V1EmployeeRoute) renderAlertList(w http.ResponseWriter, r *http.Request, notice string) {
+	alerts, err := c.Deps.GetDB().Alerts().List(r.Context(), database.AlertFilter{
+		Statuses: []string{database.AlertStatusOpen, database.AlertStatusAcknowledged},
+		Limit:    alertListLimit,
+	})
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Alert list error: %v", err)
+		http.Error(w, "Error loading alerts", http.StatusInternalServerError)
+		return
+	}
+	web.MeterAlertList(alertView(alerts), notice).Render(r.Context(), w)
+}
+
+// acknowledgeAlert acknowledges the alert of the path for the employee
+// signed in, rendering the refreshed list
+func (c *V1EmployeeRoute) acknowledgeAlert(w http.ResponseWriter, r *http.Request, alertID string) {
+	c.actOnAlert(w, r, alertID, func(id primitive.ObjectID, employee *database.User) error {
+		return c.Deps.GetDB().Alerts().Acknowledge(r.Context(), id, employee.ID, employee.Name)
+	})
+}
+
+// resolveAlert resolves the alert of the path with the resolution typed in
+// the HX-Prompt, rendering the refreshed list
+func (c *V1EmployeeRoute) resolveAlert(w http.ResponseWriter, r *http.Request, alertID string) {
+	resolution := strings.TrimSpace(r.Header.Get("HX-Prompt"))
+	switch {
+	case resolution == "":
+		c.renderAlertList(w, r, "Enter what was found or done to resolve the alert")
+		return
+	case len(resolution) > maxResolutionLength:
+		c.renderAlertList(w, r, "The resolution is too long")
+		return
+	}
+	c.actOnAlert(w, r, alertID, func(id primitive.ObjectID, employee *database.User) error {
+		return c.Deps.GetDB().Alerts().Resolve(r.Context(), id, employee.ID, employee.Name, resolution)
+	})
+}
+
+// actOnAlert runs the action on the alert as the employee signed in. An
+// alert another employee acted on first is reported on the list.
+func (c *V1EmployeeRoute) actOnAlert(w http.ResponseWriter, r *http.Request, alertID string,
+	action func(id primitive.ObjectID, employee *database.User) error) {
+	id, err := primitive.ObjectIDFromHex(alertID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	session := auth.SessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	employee, err := c.Deps.GetDB().Users().FindByID(r.Context(), session.UserID)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Employee lookup error: %v", err)
+		http.Error(w, "Error updating alert", http.StatusInternalServerError)
+		return
+	}
+
+	err = action(id, employee)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, database.ErrInvalidStatusTransition):
+		c.renderAlertList(w, r, "The alert was already updated by someone else")
+		return
+	case err != nil:
+		c.Deps.GetLogger().Sugar().Errorf("Alert update error: %v", err)
+		http.Error(w, "Error updating alert", http.StatusInternalServerError)
+		return
+	}
+	c.Deps.GetLogger().Sugar().Infof("Alert %s updated by %s", alertID, employee.Name)
+	c.renderAlertList(w, r, "")
+}
+
+// alertView formats the alerts for web.MeterAlertList
+func alertView(alerts []database.Alert) []web.MeterAlert {
+	view := make([]web.MeterAlert, 0, len(alerts))
+	for _, alert := range alerts {
+		rule := alerting.RuleLabels[alert.Rule]
+		if rule == "" {
+			rule = alert.Rule
+		}
+		row := web.MeterAlert{
+			ID:          alert.ID.Hex(),
+			Serial:      alert.SerialNumber,
+			Rule:        rule,
+			Severity:    alert.Severity,
+			Message:     alert.Message,
+			Status:      alert.Status,
+			Occurrences: alert.Occurrences,
+			RaisedAt:    formatSeenAt(alert.RaisedAt),
+			LastSeenAt:  formatSeenAt(alert.LastOccurredAt),
+		}
+		if alert.Status == database.AlertStatusAcknowledged {
+			row.AcknowledgedBy = alert.AcknowledgedByName + " on " + formatSeenAt(alert.AcknowledgedAt)
+		}
+		view = append(view, row)
+	}
+	return view
+}
@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"SmartMeterSystem/internal/alerting"
+	"SmartMeterSystem/internal/database"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAlertView(t *testing.T) {
+	raised := time.Date(2025, 3, 8, 4, 30, 0, 0, time.UTC)
+	alerts := []database.Alert{
+		{
+			ID:           primitive.NewObjectID(),
+			SerialNumber: "SM-0001",
+			Rule:         alerting.RuleTamper,
+			Severity:     alerting.SeverityCritical,
+			Message:      "Meter reported cover_open",
+			Status:       database.AlertStatusOpen,
+			Occurrences:  1,
+			RaisedAt:     raised,
+		},
+		{
+			ID:                 primitive.NewObjectID(),
+			SerialNumber:       "SM-0002",
+			Rule:               "legacy_rule",
+			Status:             database.AlertStatusAcknowledged,
+			Occurrences:        3,
+			RaisedAt:           raised,
+			LastOccurredAt:     raised.Add(time.Hour),
+			AcknowledgedByName: "Ana",
+			AcknowledgedAt:     raised.Add(2 * time.Hour),
+		},
+	}
+
+	view := alertView(alerts)
+	if len(view) != 2 || view[0].ID != alerts[0].ID.Hex() || view[0].Rule != "Tamper" {
+		t.Fatalf("alertView() = %+v", view)
+	}
+	if view[0].AcknowledgedBy != "" {
+		t.Errorf("alertView()[0].AcknowledgedBy = %q, want empty while open", view[0].AcknowledgedBy)
+	}
+	if view[1].Rule != "legacy_rule" {
+		t.Errorf("alertView()[1].Rule = %q, want the rule of an unknown label", view[1].Rule)
+	}
+	if want := "Ana on " + formatSeenAt(raised.Add(2*time.Hour)); view[1].AcknowledgedBy != want {
+		t.Errorf("alertView()[1].AcknowledgedBy = %q, want %q", view[1].AcknowledgedBy, want)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * @file internal/server/routes/billpdf.go
+ * @brief billpdf.go file prints a bill as a PDF in the layout of the BATELEC I statement of account
+ */
+package routes
+
+import (
+	"SmartMeterSystem/internal/database"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Column widths of the bill, in millimetres across a Letter page with 15mm
+// margins
+const (
+	billPageMargin  = 15.0
+	billLabelWidth  = 30.0
+	billValueWidth  = 62.95
+	billParticulars = 95.9
+	billNumberWidth = 30.0
+	billRowHeight   = 6.0
+)
+
+// writeBillPDF prints the statement of account of the consumer for the bill
+func writeBillPDF(w io.Writer, consumer *database.Consumer, bill *database.Bill) error {
+	pdf := gofpdf.New("P", "mm", "Letter", "")
+	pdf.SetMargins(billPageMargin, billPageMargin, billPageMargin)
+	pdf.SetAutoPageBreak(true, billPageMargin)
+	pdf.SetTitle("Statement of Account "+bill.Number, true)
+	pdf.SetCreator("BATELEC I", true)
+	pdf.AddPage()
+	// The core fonts are Latin-1; names such as Peñafiel must be converted
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, _ := pdf.GetPageSize()
+	width := pageWidth - 2*billPageMargin
+
+	// Letterhead
+	pdf.SetFillColor(234, 179, 8)
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(width, 9, "BATANGAS I ELECTRIC COOPERATIVE, INC. (BATELEC I)", "", 1, "C", true, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(width, 5, "Calaca, Batangas", "", 1, "C", true, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(3)
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(width, 7, "STATEMENT OF ACCOUNT", "", 1, "C", false, 0, "")
+	pdf.Ln(2)
+
+	// Account details, two label and value pairs per row
+	pair := func(label, value string, ln int) {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(billLabelWidth, billRowHeight, label, "1", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(billValueWidth, billRowHeight, tr(value), "1", ln, "L", false, 0, "")
+	}
+	wide := func(label, value string) {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(billLabelWidth, billRowHeight, label, "1", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(width-billLabelWidth, billRowHeight, tr(value), "1", 1, "L", false, 0, "")
+	}
+	pair("Account No.", bill.AccountNumber, 0)
+	pair("Bill No.", bill.Number, 1)
+	wide("Name", consumer.FullName())
+	wide("Address", consumer.Address())
+	pair("Rate Class", strings.ToUpper(bill.Class), 0)
+	pair("Route/Book", bill.Book, 1)
+	wide("Period Covered", billPeriod(bill))
+	pair("Bill Date", bill.IssuedAt.In(database.RollupLocation).Format(billDateLayout), 0)
+	pair("Due Date", bill.DueDate.In(database.RollupLocation).Format(billDateLayout), 1)
+	pdf.Ln(4)
+
+	// Meter readings
+	header := func(cells ...string) {
+		pdf.SetFillColor(229, 231, 235)
+		pdf.SetFont("Helvetica", "B", 9)
+		for i, cell := range cells {
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(width/float64(len(cells)), billRowHeight, cell, "1", 0, align, true, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	header("Meter No.", "Previous Reading", "Present Reading", "Difference (kWh)")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, meter := range bill.Meters {
+		cells := []string{
+			meter.SerialNumber,
+			strconv.FormatFloat(meter.PreviousKWh, 'f', 2, 64),
+			strconv.FormatFloat(meter.PresentKWh, 'f', 2, 64),
+			strconv.FormatFloat(meter.PresentKWh-meter.PreviousKWh, 'f', 2, 64),
+		}
+		for i, cell := range cells {
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(width/4, billRowHeight, cell, "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.CellFormat(width/2, billRowHeight, "Total kWh Used: "+bill.Usage.EnergyKWh.StringFixed(2), "1", 0, "L", false, 0, "")
+	pdf.CellFormat(width/2, billRowHeight, "Demand (kW): "+bill.Usage.DemandKW.StringFixed(2), "1", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	// Itemised charges under their rate groups
+	pdf.SetFillColor(229, 231, 235)
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.CellFormat(billParticulars, billRowHeight, "Particulars", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(billNumberWidth, billRowHeight, "Rate", "1", 0, "R", true, 0, "")
+	pdf.CellFormat(billNumberWidth, billRowHeight, "Quantity", "1", 0, "R", true, 0, "")
+	pdf.CellFormat(width-billParticulars-2*billNumberWidth, billRowHeight, "Amount", "1", 1, "R", true, 0, "")
+	for _, subtotal := range bill.Subtotals {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(billParticulars+2*billNumberWidth, billRowHeight, tr(subtotal.Particulars), "LR", 0, "L", false, 0, "")
+		pdf.CellFormat(width-billParticulars-2*billNumberWidth, billRowHeight, subtotal.Amount.StringFixed(2), "LR", 1, "R", false, 0, "")
+		pdf.SetFont("Helvetica", "", 8)
+		for _, item := range bill.Items {
+			if item.Group != subtotal.Particulars {
+				continue
+			}
+			pdf.CellFormat(billParticulars, 5, "    "+tr(item.Particulars), "LR", 0, "L", false, 0, "")
+			pdf.CellFormat(billNumberWidth, 5, formatRate(item.Rate)+" "+string(item.Unit), "LR", 0, "R", false, 0, "")
+			pdf.CellFormat(billNumberWidth, 5, item.Quantity.StringFixed(2), "LR", 0, "R", false, 0, "")
+			pdf.CellFormat(width-billParticulars-2*billNumberWidth, 5, item.Amount.StringFixed(2), "LR", 1, "R", false, 0, "")
+		}
+	}
+	pdf.SetFillColor(254, 249, 195)
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(billParticulars+2*billNumberWidth, 8, "TOTAL AMOUNT DUE", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(width-billParticulars-2*billNumberWidth, 8, "PhP "+bill.Total.StringFixed(2), "1", 1, "R", true, 0, "")
+	pdf.Ln(4)
+
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.MultiCell(width, 4, "Please pay on or before the due date. Accounts left unpaid after the due date are subject to "+
+		"disconnection after the notice period. This statement was generated from the readings of your smart meter; "+
+		"a copy can be downloaded any time from the Billing page of your consumer account.", "", "L", false)
+
+	return pdf.Output(w)
+}
@@ -0,0 +1,155 @@
+/*
+ * @file internal/server/routes/bills.go
+ * @brief bills.go file holds the consumer billing page and the bill downloads
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/database"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// billDateLayout formats the dates printed on a bill
+const billDateLayout = "Jan 02, 2006"
+
+// sessionConsumers returns the consumer accounts of the logged in consumer,
+// the accounts registered under the email of their login
+func (c *V1ConsumerRoute) sessionConsumers(r *http.Request) ([]database.Consumer, error) {
+	session := auth.SessionFromContext(r.Context())
+	if session == nil {
+		return nil, database.ErrNotFound
+	}
+	user, err := c.Deps.GetDB().Users().FindByID(r.Context(), session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return c.Deps.GetDB().Consumers().List(r.Context(), database.ConsumerFilter{Email: user.Email})
+}
+
+// billingPage lists the issued bills of every account of the consumer,
+// newest first
+func (c *V1ConsumerRoute) billingPage(w http.ResponseWriter, r *http.Request) {
+	consumers, err := c.sessionConsumers(r)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Consumer lookup error: %v", err)
+		http.Error(w, "Error loading bills", http.StatusInternalServerError)
+		return
+	}
+
+	bills := []web.ConsumerBill{}
+	for _, consumer := range consumers {
+		stored, err := c.Deps.GetDB().Bills().ListByConsumer(r.Context(), consumer.ID)
+		if err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Bill list error: %v", err)
+			http.Error(w, "Error loading bills", http.StatusInternalServerError)
+			return
+		}
+		for _, bill := range stored {
+			// Drafts wait for the rest of their cycle before going out
+			if bill.Status != database.BillStatusDraft {
+				bills = append(bills, billView(&bill))
+			}
+		}
+	}
+	web.ConsumerBillingWebPage(bills).Render(r.Context(), w)
+}
+
+// billPDF sends the bill named by the last path segment ("<id>.pdf") if it
+// belongs to one of the consumer's accounts
+func (c *V1ConsumerRoute) billPDF(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(path.Base(r.URL.Path), ".pdf")
+	id, err := primitive.ObjectIDFromHex(name)
+	if !ok || err != nil {
+		web.NotFound().Render(r.Context(), w)
+		return
+	}
+
+	consumers, err := c.sessionConsumers(r)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Consumer lookup error: %v", err)
+		http.Error(w, "Error loading bill", http.StatusInternalServerError)
+		return
+	}
+	bill, err := c.Deps.GetDB().Bills().Get(r.Context(), id)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		c.Deps.GetLogger().Sugar().Errorf("Bill lookup error: %v", err)
+		http.Error(w, "Error loading bill", http.StatusInternalServerError)
+		return
+	}
+
+	var owner *database.Consumer
+	for i := range consumers {
+		if bill != nil && consumers[i].ID == bill.ConsumerID {
+			owner = &consumers[i]
+		}
+	}
+	// Someone else's bill is reported missing rather than forbidden so bill
+	// ids cannot be probed
+	if owner == nil || bill.Status == database.BillStatusDraft {
+		w.WriteHeader(http.StatusNotFound)
+		web.NotFound().Render(r.Context(), w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "BATELEC-I-"+bill.Number+".pdf"))
+	if err := writeBillPDF(w, owner, bill); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Bill PDF error: %v", err)
+	}
+}
+
+// billView formats a bill for the billing page, its line items under the
+// rate group they add up to
+func billView(bill *database.Bill) web.ConsumerBill {
+	view := web.ConsumerBill{
+		ID:            bill.ID.Hex(),
+		Number:        bill.Number,
+		AccountNumber: bill.AccountNumber,
+		Period:        billPeriod(bill),
+		IssuedAt:      bill.IssuedAt.In(database.RollupLocation).Format(billDateLayout),
+		DueDate:       bill.DueDate.In(database.RollupLocation).Format(billDateLayout),
+		Status:        bill.Status,
+		EnergyKWh:     bill.Usage.EnergyKWh.StringFixed(2),
+		DemandKW:      bill.Usage.DemandKW.StringFixed(2),
+		Total:         bill.Total.StringFixed(2),
+	}
+	for _, meter := range bill.Meters {
+		view.Meters = append(view.Meters, web.ConsumerBillMeter{
+			SerialNumber: meter.SerialNumber,
+			Previous:     strconv.FormatFloat(meter.PreviousKWh, 'f', 2, 64),
+			Present:      strconv.FormatFloat(meter.PresentKWh, 'f', 2, 64),
+		})
+	}
+	for _, subtotal := range bill.Subtotals {
+		charges := web.ConsumerBillCharges{Particulars: subtotal.Particulars, Subtotal: subtotal.Amount.StringFixed(2)}
+		for _, item := range bill.Items {
+			if item.Group != subtotal.Particulars {
+				continue
+			}
+			charges.Items = append(charges.Items, web.ConsumerBillItem{
+				Particulars: item.Particulars,
+				Unit:        string(item.Unit),
+				Rate:        formatRate(item.Rate),
+				Quantity:    item.Quantity.StringFixed(2),
+				Amount:      item.Amount.StringFixed(2),
+			})
+		}
+		view.Charges = append(view.Charges, charges)
+	}
+	return view
+}
+
+// billPeriod writes the read dates bounding the bill
+func billPeriod(bill *database.Bill) string {
+	return bill.PeriodStart.In(database.RollupLocation).Format(billDateLayout) + " to " +
+		bill.PeriodEnd.In(database.RollupLocation).Format(billDateLayout)
+}
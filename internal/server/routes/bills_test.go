@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/database"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testBill(t *testing.T) *database.Bill {
+	t.Helper()
+	table := billing.RateTable{Groups: []billing.RateGroup{
+		{Particulars: "Generation Charges", Rates: []billing.Rate{
+			{Particulars: "Generation Energy Charge", Unit: billing.UnitPerKWh, Amount: decimal.RequireFromString("5.6092")},
+		}},
+		{Particulars: "Distribution Charges", Rates: []billing.Rate{
+			{Particulars: "Distribution System Charge", Unit: billing.UnitPerKWh, Amount: decimal.RequireFromString("0.9500")},
+			{Particulars: "Retail Customer Charge", Unit: billing.UnitPerCustomerMonth, Amount: decimal.RequireFromString("5.0000")},
+		}},
+	}}
+	computed, err := billing.Compute(table, billing.Usage{EnergyKWh: decimal.RequireFromString("120.5")})
+	if err != nil {
+		t.Fatalf("Compute() error = %v", err)
+	}
+
+	start := time.Date(2025, 1, 5, 0, 0, 0, 0, database.RollupLocation)
+	return &database.Bill{
+		ID:            primitive.NewObjectID(),
+		Number:        "B00000042",
+		AccountNumber: "C000007",
+		Book:          "B01",
+		Class:         database.ConsumerTypeResidential,
+		PeriodStart:   start,
+		PeriodEnd:     start.AddDate(0, 1, 0),
+		Meters:        []database.BillMeter{{SerialNumber: "SN-1", PreviousKWh: 1000, PresentKWh: 1120.5}},
+		Usage:         computed.Usage,
+		Items:         computed.Items,
+		Subtotals:     computed.Subtotals,
+		Total:         computed.Total,
+		Status:        database.BillStatusIssued,
+		IssuedAt:      start.AddDate(0, 1, 1),
+		DueDate:       start.AddDate(0, 1, 11),
+	}
+}
+
+func TestBillView(t *testing.T) {
+	bill := testBill(t)
+	view := billView(bill)
+
+	if view.Period != "Jan 05, 2025 to Feb 05, 2025" || view.DueDate != "Feb 16, 2025" {
+		t.Errorf("billView() dates = %q, due %q", view.Period, view.DueDate)
+	}
+	if len(view.Meters) != 1 || view.Meters[0].Present != "1120.50" {
+		t.Errorf("billView() meters = %+v", view.Meters)
+	}
+	if len(view.Charges) != 2 || len(view.Charges[1].Items) != 2 {
+		t.Fatalf("billView() charges = %+v, want the items under their two groups", view.Charges)
+	}
+	// 120.5 × 5.6092 = 675.91, 120.5 × 0.95 + 5 = 119.48
+	if view.Charges[0].Subtotal != "675.91" || view.Charges[1].Subtotal != "119.48" || view.Total != "795.39" {
+		t.Errorf("billView() amounts = %s, %s, total %s", view.Charges[0].Subtotal, view.Charges[1].Subtotal, view.Total)
+	}
+}
+
+func TestWriteBillPDF(t *testing.T) {
+	consumer := &database.Consumer{FirstName: "José", LastName: "Peñafiel", Barangay: "Poblacion", CityMunicipality: "Calatagan"}
+	var buf bytes.Buffer
+	if err := writeBillPDF(&buf, consumer, testBill(t)); err != nil {
+		t.Fatalf("writeBillPDF() error = %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Errorf("writeBillPDF() wrote %q, want a PDF", buf.Bytes()[:min(buf.Len(), 16)])
+	}
+}
@@ -0,0 +1,284 @@
+/*
+ * @file internal/server/routes/charts.go
+ * @brief charts.go file builds the consumption charts from the readings and their rollups
+ */
+package routes
+
+import (
+	"SmartMeterSystem/internal/database"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxChartPoints bounds the periods of one chart
+const maxChartPoints = 2000
+
+// chartLabelLayouts formats the period labels of each granularity
+var chartLabelLayouts = map[string]string{
+	database.GranularityQuarterHour: "2006-01-02 15:04",
+	database.GranularityHour:        "2006-01-02 15:04",
+	database.GranularityDay:         "2006-01-02",
+	database.GranularityMonth:       "2006-01",
+}
+
+// ConsumptionChart is the ECharts-ready consumption of a consumer: Labels
+// feed xAxis.data and Series feed series. The previous period has as many
+// periods as the requested one and ends where it starts.
+type ConsumptionChart struct {
+	Granularity   string        `json:"granularity"`
+	From          time.Time     `json:"from"`
+	To            time.Time     `json:"to"` // exclusive
+	Unit          string        `json:"unit"`
+	Labels        []string      `json:"labels"`
+	Series        []ChartSeries `json:"series"`
+	Total         float64       `json:"total"`
+	PreviousTotal float64       `json:"previous_total"`
+	ChangePercent *float64      `json:"change_percent"` // nil when the previous period used nothing
+}
+
+// ChartSeries is one ECharts series; a nil value is a period without readings
+type ChartSeries struct {
+	Name string     `json:"name"`
+	Type string     `json:"type"`
+	Data []*float64 `json:"data"`
+}
+
+// chartRange is the period a chart covers, [From, To)
+type chartRange struct {
+	Granularity string
+	From        time.Time
+	To          time.Time
+}
+
+// parseChartRange reads the "granularity", "from" and "to" query parameters.
+// The dates are whole days in database.RollupLocation, "to" is inclusive.
+// Missing dates default to a range suiting the granularity, ending today.
+func parseChartRange(query url.Values, now time.Time) (chartRange, error) {
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = database.GranularityDay
+	}
+	if _, ok := chartLabelLayouts[granularity]; !ok {
+		return chartRange{}, errors.New("granularity must be one of 15min, hour, day or month")
+	}
+
+	to := database.PeriodStart(database.GranularityDay, now)
+	if value := query.Get("to"); value != "" {
+		date, err := time.ParseInLocation(dateLayout, value, database.RollupLocation)
+		if err != nil {
+			return chartRange{}, errors.New("to must be a date in YYYY-MM-DD format")
+		}
+		to = date
+	}
+
+	var from time.Time
+	switch granularity {
+	case database.GranularityQuarterHour, database.GranularityHour:
+		from = to
+	case database.GranularityDay:
+		from = to.AddDate(0, 0, -29)
+	case database.GranularityMonth:
+		from = to.AddDate(0, -11, 0)
+	}
+	if value := query.Get("from"); value != "" {
+		date, err := time.ParseInLocation(dateLayout, value, database.RollupLocation)
+		if err != nil {
+			return chartRange{}, errors.New("from must be a date in YYYY-MM-DD format")
+		}
+		from = date
+	}
+	if from.After(to) {
+		return chartRange{}, errors.New("from must not be after to")
+	}
+
+	// Round the end of the last day up to a whole period
+	end := database.NextPeriod(database.GranularityDay, to)
+	r := chartRange{
+		Granularity: granularity,
+		From:        database.PeriodStart(granularity, from),
+		To:          database.NextPeriod(granularity, database.PeriodStart(granularity, end.Add(-time.Nanosecond))),
+	}
+	if r.periods() > maxChartPoints {
+		return chartRange{}, fmt.Errorf("the range is too long for the %s granularity", granularity)
+	}
+	return r, nil
+}
+
+// periods returns the number of periods in the range
+func (r chartRange) periods() int {
+	n := 0
+	for start := r.From; start.Before(r.To) && n <= maxChartPoints; start = database.NextPeriod(r.Granularity, start) {
+		n++
+	}
+	return n
+}
+
+// previous returns the range of equal length ending where r starts
+func (r chartRange) previous() chartRange {
+	return chartRange{
+		Granularity: r.Granularity,
+		From:        database.AddPeriods(r.Granularity, r.From, -r.periods()),
+		To:          r.From,
+	}
+}
+
+// consumptionTotals sums the consumption of the meters per period start
+func consumptionTotals(ctx context.Context, readings database.ReadingStore, rollups database.RollupStore, serials []string, r chartRange) (map[time.Time]float64, error) {
+	if len(serials) == 0 {
+		return map[time.Time]float64{}, nil
+	}
+	if r.Granularity == database.GranularityQuarterHour {
+		return quarterHourTotals(ctx, readings, serials, r)
+	}
+
+	stored, err := rollups.List(ctx, database.RollupFilter{
+		SerialNumbers: serials,
+		Granularity:   r.Granularity,
+		From:          r.From,
+		To:            r.To,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	totals := map[time.Time]float64{}
+	for _, rollup := range stored {
+		totals[rollup.PeriodStart.UTC()] += rollup.EnergyKWh
+	}
+	return totals, nil
+}
+
+// quarterHourTotals computes quarter hour consumption from the raw readings,
+// the same way the hourly rollups are computed
+func quarterHourTotals(ctx context.Context, readings database.ReadingStore, serials []string, r chartRange) (map[time.Time]float64, error) {
+	totals := map[time.Time]float64{}
+	for _, serial := range serials {
+		baseline, err := readings.Last(ctx, serial, r.From)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			return nil, err
+		}
+
+		stored, err := readings.List(ctx, database.ReadingFilter{SerialNumber: serial, From: r.From, To: r.To})
+		if err != nil {
+			return nil, err
+		}
+		for _, reading := range stored {
+			start := database.PeriodStart(database.GranularityQuarterHour, reading.Timestamp).UTC()
+			if _, ok := totals[start]; !ok {
+				totals[start] = 0
+			}
+			if baseline != nil && reading.EnergyKWh > baseline.EnergyKWh {
+				totals[start] += reading.EnergyKWh - baseline.EnergyKWh
+			}
+			current := reading
+			baseline = &current
+		}
+	}
+	return totals, nil
+}
+
+// series lays the totals out over every period of the range
+func (r chartRange) series(totals map[time.Time]float64) ([]*float64, float64) {
+	data := []*float64{}
+	sum := 0.0
+	for start := r.From; start.Before(r.To); start = database.NextPeriod(r.Granularity, start) {
+		if total, ok := totals[start.UTC()]; ok {
+			data = append(data, &total)
+			sum += total
+		} else {
+			data = append(data, nil)
+		}
+	}
+	return data, sum
+}
+
+// labels formats the start of every period of the range
+func (r chartRange) labels() []string {
+	labels := []string{}
+	for start := r.From; start.Before(r.To); start = database.NextPeriod(r.Granularity, start) {
+		labels = append(labels, start.In(database.RollupLocation).Format(chartLabelLayouts[r.Granularity]))
+	}
+	return labels
+}
+
+// consumptionChart builds the chart of the meters over the range and the
+// period before it
+func consumptionChart(ctx context.Context, readings database.ReadingStore, rollups database.RollupStore, serials []string, r chartRange) (ConsumptionChart, error) {
+	current, err := consumptionTotals(ctx, readings, rollups, serials, r)
+	if err != nil {
+		return ConsumptionChart{}, err
+	}
+	previousRange := r.previous()
+	previous, err := consumptionTotals(ctx, readings, rollups, serials, previousRange)
+	if err != nil {
+		return ConsumptionChart{}, err
+	}
+
+	currentData, total := r.series(current)
+	previousData, previousTotal := previousRange.series(previous)
+	chart := ConsumptionChart{
+		Granularity: r.Granularity,
+		From:        r.From,
+		To:          r.To,
+		Unit:        "kWh",
+		Labels:      r.labels(),
+		Series: []ChartSeries{
+			{Name: "Current period", Type: "line", Data: currentData},
+			{Name: "Previous period", Type: "line", Data: previousData},
+		},
+		Total:         total,
+		PreviousTotal: previousTotal,
+	}
+	if previousTotal > 0 {
+		change := (total - previousTotal) / previousTotal * 100
+		chart.ChangePercent = &change
+	}
+	return chart, nil
+}
+
+// consumerChart writes the consumption chart of a consumer's meters as JSON
+func (c *V1EmployeeRoute) consumerChart(w http.ResponseWriter, r *http.Request, accountNumber string) {
+	chartRange, err := parseChartRange(r.URL.Query(), time.Now())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	consumer, err := c.Deps.GetDB().Consumers().Get(r.Context(), accountNumber)
+	if errors.Is(err, database.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "consumer not found")
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Consumer lookup error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not load consumer")
+		return
+	}
+
+	meters, err := c.Deps.GetDB().Meters().List(r.Context(), database.MeterFilter{ConsumerID: consumer.ID})
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Meter list error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not load meters")
+		return
+	}
+	serials := make([]string, 0, len(meters))
+	for _, meter := range meters {
+		serials = append(serials, meter.SerialNumber)
+	}
+
+	db := c.Deps.GetDB()
+	chart, err := consumptionChart(r.Context(), db.Readings(), db.Rollups(), serials, chartRange)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Consumption chart error for %s: %v", accountNumber, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not load consumption")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chart)
+}
@@ -0,0 +1,146 @@
+package routes
+
+import (
+	"SmartMeterSystem/internal/database"
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeReadingStore returns its readings filtered like the MongoDB store
+type fakeReadingStore struct {
+	readings []database.Reading
+}
+
+func (f *fakeReadingStore) Insert(_ context.Context, readings []database.Reading) ([]database.Reading, error) {
+	f.readings = append(f.readings, readings...)
+	return readings, nil
+}
+
+func (f *fakeReadingStore) List(_ context.Context, filter database.ReadingFilter) ([]database.Reading, error) {
+	var readings []database.Reading
+	for _, reading := range f.readings {
+		if reading.SerialNumber == filter.SerialNumber && !reading.Timestamp.Before(filter.From) && reading.Timestamp.Before(filter.To) {
+			readings = append(readings, reading)
+		}
+	}
+	return readings, nil
+}
+
+func (f *fakeReadingStore) Last(_ context.Context, serialNumber string, before time.Time) (*database.Reading, error) {
+	var last *database.Reading
+	for i, reading := range f.readings {
+		if reading.SerialNumber == serialNumber && reading.Timestamp.Before(before) {
+			last = &f.readings[i]
+		}
+	}
+	if last == nil {
+		return nil, database.ErrNotFound
+	}
+	return last, nil
+}
+
+// fakeRollupStore returns its rollups filtered like the MongoDB store
+type fakeRollupStore struct {
+	rollups []database.Rollup
+}
+
+func (f *fakeRollupStore) Refresh(context.Context, string, time.Time, time.Time) error {
+	return nil
+}
+
+func (f *fakeRollupStore) List(_ context.Context, filter database.RollupFilter) ([]database.Rollup, error) {
+	var rollups []database.Rollup
+	for _, rollup := range f.rollups {
+		if rollup.Granularity == filter.Granularity && !rollup.PeriodStart.Before(filter.From) && rollup.PeriodStart.Before(filter.To) {
+			rollups = append(rollups, rollup)
+		}
+	}
+	return rollups, nil
+}
+
+func TestParseChartRange(t *testing.T) {
+	now := time.Date(2025, 3, 10, 14, 20, 0, 0, database.RollupLocation)
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2025, month, d, 0, 0, 0, 0, database.RollupLocation)
+	}
+
+	tests := []struct {
+		query    string
+		from, to time.Time
+		periods  int
+	}{
+		{"", day(2, 9), day(3, 11), 30},
+		{"granularity=hour", day(3, 10), day(3, 11), 24},
+		{"granularity=15min&from=2025-03-09&to=2025-03-10", day(3, 9), day(3, 11), 192},
+		{"granularity=month&from=2025-01-15&to=2025-03-02", day(1, 1), day(4, 1), 3},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		r, err := parseChartRange(query, now)
+		if err != nil {
+			t.Errorf("parseChartRange(%q) error = %v", tt.query, err)
+			continue
+		}
+		if !r.From.Equal(tt.from) || !r.To.Equal(tt.to) || r.periods() != tt.periods {
+			t.Errorf("parseChartRange(%q) = %v - %v (%d periods), want %v - %v (%d)", tt.query, r.From, r.To, r.periods(), tt.from, tt.to, tt.periods)
+		}
+	}
+
+	for _, bad := range []string{"granularity=week", "from=03/01/2025", "from=2025-03-10&to=2025-03-01", "granularity=15min&from=2024-01-01"} {
+		query, _ := url.ParseQuery(bad)
+		if _, err := parseChartRange(query, now); err == nil {
+			t.Errorf("parseChartRange(%q) error = nil, want an error", bad)
+		}
+	}
+}
+
+func TestConsumptionChart(t *testing.T) {
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, database.RollupLocation)
+	rollups := &fakeRollupStore{rollups: []database.Rollup{
+		{SerialNumber: "SM-1", Granularity: database.GranularityDay, PeriodStart: march, EnergyKWh: 4},
+		{SerialNumber: "SM-2", Granularity: database.GranularityDay, PeriodStart: march, EnergyKWh: 1},
+		{SerialNumber: "SM-1", Granularity: database.GranularityDay, PeriodStart: march.AddDate(0, 0, -2), EnergyKWh: 2.5},
+	}}
+
+	// Two days, compared with the two days before
+	r := chartRange{Granularity: database.GranularityDay, From: march, To: march.AddDate(0, 0, 2)}
+	chart, err := consumptionChart(context.Background(), &fakeReadingStore{}, rollups, []string{"SM-1", "SM-2"}, r)
+	if err != nil {
+		t.Fatalf("consumptionChart() error = %v", err)
+	}
+
+	if len(chart.Labels) != 2 || chart.Labels[0] != "2025-03-01" {
+		t.Errorf("Labels = %v", chart.Labels)
+	}
+	current, previous := chart.Series[0].Data, chart.Series[1].Data
+	if current[0] == nil || *current[0] != 5 || current[1] != nil {
+		t.Errorf("current series = %v, want [5 gap]", current)
+	}
+	if previous[0] == nil || *previous[0] != 2.5 || previous[1] != nil {
+		t.Errorf("previous series = %v, want [2.5 gap]", previous)
+	}
+	if chart.Total != 5 || chart.PreviousTotal != 2.5 || chart.ChangePercent == nil || *chart.ChangePercent != 100 {
+		t.Errorf("totals = %v, %v, %v", chart.Total, chart.PreviousTotal, chart.ChangePercent)
+	}
+}
+
+func TestQuarterHourTotals(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, database.RollupLocation)
+	readings := &fakeReadingStore{readings: []database.Reading{
+		{SerialNumber: "SM-1", Timestamp: start.Add(-15 * time.Minute), EnergyKWh: 100},
+		{SerialNumber: "SM-1", Timestamp: start, EnergyKWh: 100.5},
+		{SerialNumber: "SM-1", Timestamp: start.Add(30 * time.Minute), EnergyKWh: 101},
+	}}
+
+	r := chartRange{Granularity: database.GranularityQuarterHour, From: start, To: start.Add(time.Hour)}
+	totals, err := quarterHourTotals(context.Background(), readings, []string{"SM-1"}, r)
+	if err != nil {
+		t.Fatalf("quarterHourTotals() error = %v", err)
+	}
+	data, sum := r.series(totals)
+	if sum != 1 || data[0] == nil || *data[0] != 0.5 || data[1] != nil || *data[2] != 0.5 {
+		t.Errorf("series = %v (sum %v), want [0.5 gap 0.5 gap]", data, sum)
+	}
+}
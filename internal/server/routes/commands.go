@@ -0,0 +1,508 @@
+/*
+ * @file internal/server/routes/commands.go
+ * @brief commands.go file holds the command channel employees queue meter commands on and meters poll and acknowledge them through
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/config"
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/meterapi"
+	"SmartMeterSystem/internal/telemetry"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxCommandWait bounds how long a poll for commands is held open, under
+	// the server write timeout
+	maxCommandWait = 25 * time.Second
+	// commandPollInterval is how often a held poll checks the queue, which
+	// other instances of the server may add to
+	commandPollInterval = time.Second
+	// commandListLimit bounds the commands listed on the dashboard
+	commandListLimit = 50
+	// maxCommandResultLength bounds the result a meter reports
+	maxCommandResultLength = 500
+	// settledCancellerName is who a non-payment disconnect withdrawn after
+	// the account settled shows as cancelled by
+	settledCancellerName = "System (account no longer overdue)"
+)
+
+var (
+	// commandTTL is how long a queued command waits for its meter to poll
+	// before it expires, read from METER_COMMAND_TTL
+	commandTTL = config.Duration("METER_COMMAND_TTL", 24*time.Hour)
+	// disconnectGraceDays is how many days past its due date a bill must be
+	// unpaid before the meter may be disconnected for non-payment, read
+	// from DISCONNECT_GRACE_DAYS
+	disconnectGraceDays = config.Int("DISCONNECT_GRACE_DAYS", 7, 0)
+)
+
+var commandLabels = map[string]string{
+	database.CommandDisconnect: "Disconnect",
+	database.CommandReconnect:  "Reconnect",
+	database.CommandSyncClock:  "Sync Clock",
+	database.CommandReadNow:    "Read Now",
+}
+
+var disconnectReasonLabels = map[string]string{
+	database.DisconnectNonPayment:      "Non-payment",
+	database.DisconnectCustomerRequest: "Customer request",
+	database.DisconnectMaintenance:     "Maintenance",
+	database.DisconnectSafety:          "Safety",
+}
+
+// pollCommands hands the meter of the path its due commands. With a wait
+// query in seconds, the request is held until a command is due or the wait,
+// capped at maxCommandWait, runs out.
+func (c *V1MeterRoute) pollCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	wait, err := commandWait(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	meter, ok := c.authenticateMeter(w, r)
+	if !ok {
+		return
+	}
+	c.touch(r, meter)
+
+	deadline := time.Now().Add(wait)
+	ticker := time.NewTicker(commandPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.withdrawSettledDisconnects(r.Context(), meter, time.Now()); err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Command delivery error for %s: %v", meter.SerialNumber, err)
+			writeJSONError(w, http.StatusInternalServerError, "could not load commands")
+			return
+		}
+		commands, err := c.Deps.GetDB().Commands().Deliver(r.Context(), meter.SerialNumber, time.Now())
+		if err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Command delivery error for %s: %v", meter.SerialNumber, err)
+			writeJSONError(w, http.StatusInternalServerError, "could not load commands")
+			return
+		}
+		if len(commands) > 0 || !time.Now().Before(deadline) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(commandPoll(commands, time.Now()))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// withdrawSettledDisconnects cancels the non-payment disconnects still
+// pending for the meter once its account no longer owes past the grace
+// period, so a consumer paying after the disconnect was queued keeps the
+// supply. A disconnect the meter has already received is left to a
+// reconnect.
+func (c *V1MeterRoute) withdrawSettledDisconnects(ctx context.Context, meter *database.Meter, now time.Time) error {
+	withdrawn, err := cancelSettledDisconnects(ctx, c.Deps.GetDB(), meter, now)
+	for _, command := range withdrawn {
+		c.Deps.GetTelemetry().Publish(telemetry.Event{
+			Type:    telemetry.EventCommand,
+			Serial:  meter.SerialNumber,
+			Command: command.Type,
+			Status:  database.CommandStatusCancelled,
+			At:      now,
+		})
+		c.Deps.GetLogger().Sugar().Infof("Non-payment disconnect %s of %s withdrawn, the account is no longer overdue",
+			command.ID.Hex(), meter.SerialNumber)
+	}
+	return err
+}
+
+// cancelSettledDisconnects cancels the pending non-payment disconnects of
+// the meter its account no longer qualifies for, returning them
+func cancelSettledDisconnects(ctx context.Context, db database.Service, meter *database.Meter, now time.Time) ([]database.MeterCommand, error) {
+	open, err := db.Commands().List(ctx, database.CommandFilter{SerialNumber: meter.SerialNumber, Open: true})
+	if err != nil {
+		return nil, err
+	}
+	pending := slices.DeleteFunc(open, func(command database.MeterCommand) bool {
+		return command.Type != database.CommandDisconnect || command.Reason != database.DisconnectNonPayment ||
+			command.Status != database.CommandStatusPending
+	})
+	// Most polls find none, and need not read the account
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	refusal, err := nonPaymentRefusal(ctx, db, meter, now)
+	if err != nil || refusal == "" {
+		return nil, err
+	}
+
+	var withdrawn []database.MeterCommand
+	for _, command := range pending {
+		// Delivered since it was listed, the meter is carrying it out
+		err = db.Commands().Cancel(ctx, command.ID, settledCancellerName)
+		if errors.Is(err, database.ErrInvalidStatusTransition) {
+			continue
+		}
+		if err != nil {
+			return withdrawn, err
+		}
+		withdrawn = append(withdrawn, command)
+	}
+	return withdrawn, nil
+}
+
+// commandWait parses the wait query of a poll
+func commandWait(query url.Values) (time.Duration, error) {
+	if query.Get("wait") == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(query.Get("wait"))
+	if err != nil || seconds < 0 {
+		return 0, errors.New("wait must be a number of seconds")
+	}
+	return min(time.Duration(seconds)*time.Second, maxCommandWait), nil
+}
+
+// commandPoll is the poll response handing out the commands
+func commandPoll(commands []database.MeterCommand, now time.Time) meterapi.CommandPoll {
+	poll := meterapi.CommandPoll{ServerTime: now.UTC(), Commands: make([]meterapi.PolledCommand, 0, len(commands))}
+	for _, command := range commands {
+		poll.Commands = append(poll.Commands, meterapi.PolledCommand{
+			ID:          command.ID.Hex(),
+			Type:        command.Type,
+			RequestedAt: command.RequestedAt,
+		})
+	}
+	return poll
+}
+
+// acknowledgeCommand records the outcome of a command the meter of the path
+// carried out. A disconnect or reconnect that succeeded switches the supply
+// state of the meter.
+func (c *V1MeterRoute) acknowledgeCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	meter, ok := c.authenticateMeter(w, r)
+	if !ok {
+		return
+	}
+	c.touch(r, meter)
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "command not found")
+		return
+	}
+	var ack meterapi.CommandAck
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReadingBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&ack); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if err := validateCommandAck(ack); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	db := c.Deps.GetDB()
+	command, err := db.Commands().Get(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && command.SerialNumber != meter.SerialNumber) {
+		writeJSONError(w, http.StatusNotFound, "command not found")
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Command lookup error for %s: %v", meter.SerialNumber, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not record acknowledgement")
+		return
+	}
+
+	// The supply state is recorded before the command is completed, so a
+	// meter retrying after a failure here records it then
+	now := time.Now()
+	succeeded := ack.Status == database.CommandStatusSucceeded
+	if succeeded && commandOpen(command) &&
+		(command.Type == database.CommandDisconnect || command.Type == database.CommandReconnect) {
+		disconnected := command.Type == database.CommandDisconnect
+		if err := db.Meters().SetDisconnected(r.Context(), meter.SerialNumber, disconnected, now); err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Supply state error for %s: %v", meter.SerialNumber, err)
+			writeJSONError(w, http.StatusInternalServerError, "could not record supply state")
+			return
+		}
+	}
+
+	command, err = db.Commands().Complete(r.Context(), id, meter.SerialNumber, succeeded, ack.Result, now)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, "command not found")
+		return
+	case errors.Is(err, database.ErrInvalidStatusTransition):
+		writeJSONError(w, http.StatusConflict, "command is already completed")
+		return
+	case err != nil:
+		c.Deps.GetLogger().Sugar().Errorf("Command acknowledgement error for %s: %v", meter.SerialNumber, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not record acknowledgement")
+		return
+	}
+
+	c.Deps.GetTelemetry().Publish(telemetry.Event{
+		Type:    telemetry.EventCommand,
+		Serial:  meter.SerialNumber,
+		Command: command.Type,
+		Status:  command.Status,
+		At:      now,
+	})
+	c.Deps.GetLogger().Sugar().Infof("Meter %s reported %s %s: %s", meter.SerialNumber, command.Type, command.Status, command.Result)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commandOpen reports whether the command still awaits its acknowledgement
+func commandOpen(command *database.MeterCommand) bool {
+	return command.Status == database.CommandStatusPending || command.Status == database.CommandStatusDelivered
+}
+
+// validateCommandAck checks the acknowledgement of a command
+func validateCommandAck(ack meterapi.CommandAck) error {
+	switch {
+	case ack.Status != database.CommandStatusSucceeded && ack.Status != database.CommandStatusFailed:
+		return errors.New("status must be succeeded or failed")
+	case len(ack.Result) > maxCommandResultLength:
+		return fmt.Errorf("result: at most %d characters", maxCommandResultLength)
+	}
+	return nil
+}
+
+// commandForm is a command queued through web.MeterCommandSection
+type commandForm struct {
+	SerialNumber string
+	Type         string
+	Reason       string
+}
+
+// parseCommandForm validates a queued command; disconnections need a reason
+func parseCommandForm(form url.Values) (commandForm, []web.FormFieldError) {
+	v := newFormValidator(form)
+	command := commandForm{
+		SerialNumber: v.required("serial", "Meter"),
+		Type: v.oneOf("type", "Command", []string{
+			database.CommandDisconnect, database.CommandReconnect, database.CommandSyncClock, database.CommandReadNow,
+		}),
+	}
+	if command.Type == database.CommandDisconnect {
+		command.Reason = v.oneOf("reason", "Reason", []string{
+			database.DisconnectNonPayment, database.DisconnectCustomerRequest, database.DisconnectMaintenance, database.DisconnectSafety,
+		})
+	}
+	return command, v.errors
+}
+
+// commandList renders the latest commands
+func (c *V1EmployeeRoute) commandList(w http.ResponseWriter, r *http.Request) {
+	c.renderCommandList(w, r, "")
+}
+
+// renderCommandList renders the latest commands with the notice
+func (c *V1EmployeeRoute) renderCommandList(w http.ResponseWriter, r *http.Request, notice string) {
+	commands, err := c.Deps.GetDB().Commands().List(r.Context(), database.CommandFilter{Limit: commandListLimit})
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Command list error: %v", err)
+		http.Error(w, "Error loading commands", http.StatusInternalServerError)
+		return
+	}
+	web.MeterCommandList(commandView(commands, time.Now()), notice).Render(r.Context(), w)
+}
+
+// queueCommand queues the posted command for its meter. A disconnection for
+// non-payment is refused unless the account owes on a bill past the grace
+// period, and is checked again before it is delivered.
+func (c *V1EmployeeRoute) queueCommand(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	form, errs := parseCommandForm(r.PostForm)
+	if len(errs) > 0 {
+		renderFormErrors(w, r, errs)
+		return
+	}
+
+	session := auth.SessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	db := c.Deps.GetDB()
+	employee, err := db.Users().FindByID(r.Context(), session.UserID)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Employee lookup error: %v", err)
+		http.Error(w, "Error queueing command", http.StatusInternalServerError)
+		return
+	}
+	meter, err := db.Meters().Get(r.Context(), form.SerialNumber)
+	if errors.Is(err, database.ErrNotFound) {
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "Meter", Message: "does not exist"}})
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Meter lookup error: %v", err)
+		http.Error(w, "Error queueing command", http.StatusInternalServerError)
+		return
+	}
+	if meter.Status == database.MeterStatusDecommissioned {
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "Meter", Message: "is decommissioned"}})
+		return
+	}
+
+	if form.Reason == database.DisconnectNonPayment {
+		message, err := nonPaymentRefusal(r.Context(), db, meter, time.Now())
+		if err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Account standing error: %v", err)
+			http.Error(w, "Error queueing command", http.StatusInternalServerError)
+			return
+		}
+		if message != "" {
+			renderFormErrors(w, r, []web.FormFieldError{{Field: "Reason", Message: message}})
+			return
+		}
+	}
+
+	command := &database.MeterCommand{
+		SerialNumber:    meter.SerialNumber,
+		Type:            form.Type,
+		Reason:          form.Reason,
+		RequestedBy:     employee.ID,
+		RequestedByName: employee.Name,
+		ExpiresAt:       time.Now().Add(commandTTL).UTC(),
+	}
+	err = db.Commands().Queue(r.Context(), command)
+	if errors.Is(err, database.ErrDuplicate) {
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "Command", Message: "is already queued for the meter"}})
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Command queue error: %v", err)
+		http.Error(w, "Error queueing command", http.StatusInternalServerError)
+		return
+	}
+
+	c.Deps.GetLogger().Sugar().Infof("Command %s queued for %s by %s %s",
+		command.Type, command.SerialNumber, employee.Email, command.Reason)
+	w.Header().Set("HX-Trigger", "commands-changed")
+	renderFormSuccess(w, r, commandLabels[command.Type]+" queued for "+command.SerialNumber)
+}
+
+// nonPaymentRefusal explains why the meter may not be disconnected for
+// non-payment at now, empty when it may
+func nonPaymentRefusal(ctx context.Context, db database.Service, meter *database.Meter, now time.Time) (string, error) {
+	if meter.ConsumerID.IsZero() {
+		return "cannot be non-payment, the meter has no consumer account", nil
+	}
+	bills, balance, err := accountStanding(ctx, db, meter.ConsumerID)
+	if err != nil {
+		return "", err
+	}
+	if disconnectableForNonPayment(balance, bills, now) {
+		return "", nil
+	}
+	return fmt.Sprintf("cannot be non-payment, nothing is owed on a bill more than %d days past due", disconnectGraceDays), nil
+}
+
+// cancelCommand withdraws the command of the path before its meter polls,
+// rendering the refreshed list
+func (c *V1EmployeeRoute) cancelCommand(w http.ResponseWriter, r *http.Request, commandID string) {
+	id, err := primitive.ObjectIDFromHex(commandID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	session := auth.SessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	employee, err := c.Deps.GetDB().Users().FindByID(r.Context(), session.UserID)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Employee lookup error: %v", err)
+		http.Error(w, "Error cancelling command", http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Deps.GetDB().Commands().Cancel(r.Context(), id, employee.Name)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, database.ErrInvalidStatusTransition):
+		c.renderCommandList(w, r, "The command was already sent to the meter")
+		return
+	case err != nil:
+		c.Deps.GetLogger().Sugar().Errorf("Command cancel error: %v", err)
+		http.Error(w, "Error cancelling command", http.StatusInternalServerError)
+		return
+	}
+	c.Deps.GetLogger().Sugar().Infof("Command %s cancelled by %s", commandID, employee.Email)
+	c.renderCommandList(w, r, "")
+}
+
+// disconnectableForNonPayment reports whether the account owes on a bill
+// more than disconnectGraceDays past due at now
+func disconnectableForNonPayment(balance decimal.Decimal, bills []database.Bill, now time.Time) bool {
+	today := database.PeriodStart(database.GranularityDay, now)
+	return database.OverdueBalance(balance, bills, today.AddDate(0, 0, -disconnectGraceDays)).IsPositive()
+}
+
+// commandView formats the commands for web.MeterCommandList. A pending
+// command past its expiry shows as expired, which it is once queued again.
+func commandView(commands []database.MeterCommand, now time.Time) []web.MeterCommand {
+	view := make([]web.MeterCommand, 0, len(commands))
+	for _, command := range commands {
+		row := web.MeterCommand{
+			ID:          command.ID.Hex(),
+			Serial:      command.SerialNumber,
+			Command:     commandLabels[command.Type],
+			Reason:      disconnectReasonLabels[command.Reason],
+			Status:      command.Status,
+			RequestedBy: command.RequestedByName,
+			RequestedAt: formatSeenAt(command.RequestedAt),
+			Result:      command.Result,
+		}
+		switch {
+		case command.Status == database.CommandStatusPending && !now.Before(command.ExpiresAt):
+			row.Status = database.CommandStatusExpired
+		case command.Status == database.CommandStatusPending:
+			row.CanCancel = true
+		case command.Status == database.CommandStatusDelivered:
+			row.UpdatedAt = formatSeenAt(command.DeliveredAt)
+		case command.Status == database.CommandStatusCancelled:
+			row.UpdatedAt = formatSeenAt(command.CompletedAt)
+			row.Result = "Cancelled by " + command.CancelledByName
+		case !command.CompletedAt.IsZero():
+			row.UpdatedAt = formatSeenAt(command.CompletedAt)
+		}
+		view = append(view, row)
+	}
+	return view
+}
@@ -0,0 +1,193 @@
+package routes
+
+import (
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/database/databasetest"
+	"SmartMeterSystem/internal/meterapi"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseCommandForm(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    url.Values
+		wantErr bool
+	}{
+		{"read now", url.Values{"serial": {"SM-0001"}, "type": {"read_now"}}, false},
+		{"disconnect", url.Values{"serial": {"SM-0001"}, "type": {"disconnect"}, "reason": {"non_payment"}}, false},
+		{"disconnect without reason", url.Values{"serial": {"SM-0001"}, "type": {"disconnect"}}, true},
+		{"unknown command", url.Values{"serial": {"SM-0001"}, "type": {"reboot"}}, true},
+		{"missing meter", url.Values{"type": {"sync_clock"}}, true},
+	}
+	for _, tt := range tests {
+		command, errs := parseCommandForm(tt.form)
+		if (len(errs) > 0) != tt.wantErr {
+			t.Errorf("%s: parseCommandForm() errors = %v, wantErr %v", tt.name, errs, tt.wantErr)
+		}
+		if tt.form.Get("type") != "disconnect" && command.Reason != "" {
+			t.Errorf("%s: parseCommandForm() reason = %q, want none", tt.name, command.Reason)
+		}
+	}
+}
+
+func TestCommandWait(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"wait=10", 10 * time.Second, false},
+		{"wait=600", maxCommandWait, false},
+		{"wait=-1", 0, true},
+		{"wait=soon", 0, true},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := commandWait(query)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("commandWait(%q) = %v, %v, want %v", tt.query, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateCommandAck(t *testing.T) {
+	if err := validateCommandAck(meterapi.CommandAck{Status: "succeeded"}); err != nil {
+		t.Errorf("validateCommandAck(succeeded) error = %v", err)
+	}
+	if err := validateCommandAck(meterapi.CommandAck{Status: "done"}); err == nil {
+		t.Error("validateCommandAck(done) error = nil")
+	}
+	if err := validateCommandAck(meterapi.CommandAck{Status: "failed", Result: string(make([]byte, maxCommandResultLength+1))}); err == nil {
+		t.Error("validateCommandAck() of a long result error = nil")
+	}
+}
+
+func TestDisconnectableForNonPayment(t *testing.T) {
+	now := time.Date(2025, 3, 20, 9, 0, 0, 0, database.RollupLocation)
+	bill := func(daysPastDue int) []database.Bill {
+		return []database.Bill{{Total: decimal.RequireFromString("500.00"), DueDate: now.AddDate(0, 0, -daysPastDue)}}
+	}
+	tests := []struct {
+		name    string
+		balance string
+		bills   []database.Bill
+		want    bool
+	}{
+		{"past the grace period", "500.00", bill(disconnectGraceDays + 1), true},
+		{"within the grace period", "500.00", bill(disconnectGraceDays - 1), false},
+		{"paid through credit", "0.00", bill(disconnectGraceDays + 1), false},
+		{"no bills", "120.00", nil, false},
+	}
+	for _, tt := range tests {
+		if got := disconnectableForNonPayment(decimal.RequireFromString(tt.balance), tt.bills, now); got != tt.want {
+			t.Errorf("%s: disconnectableForNonPayment() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCommandView(t *testing.T) {
+	now := time.Date(2025, 3, 20, 9, 0, 0, 0, time.UTC)
+	commands := []database.MeterCommand{
+		{ID: primitive.NewObjectID(), Type: database.CommandReadNow, Status: database.CommandStatusPending, ExpiresAt: now.Add(time.Hour)},
+		{ID: primitive.NewObjectID(), Type: database.CommandSyncClock, Status: database.CommandStatusPending, ExpiresAt: now},
+		{
+			ID: primitive.NewObjectID(), Type: database.CommandDisconnect, Reason: database.DisconnectNonPayment,
+			Status: database.CommandStatusSucceeded, CompletedAt: now, Result: "relay open",
+		},
+	}
+
+	view := commandView(commands, now)
+	if !view[0].CanCancel || view[0].Command != "Read Now" {
+		t.Errorf("commandView()[0] = %+v, want a pending read now that can be cancelled", view[0])
+	}
+	if view[1].Status != database.CommandStatusExpired || view[1].CanCancel {
+		t.Errorf("commandView()[1] = %+v, want expired", view[1])
+	}
+	if view[2].Reason != "Non-payment" || view[2].UpdatedAt == "" || view[2].CanCancel {
+		t.Errorf("commandView()[2] = %+v", view[2])
+	}
+}
+
+func TestMeterCommandsRequireDeviceToken(t *testing.T) {
+	handler := (&V1MeterRoute{}).HandleV1()
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/SM-0001/commands?wait=5", nil),
+		httptest.NewRequest(http.MethodPost, "/SM-0001/commands/0123456789abcdef01234567/ack", nil),
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without token status = %d, want %d", req.Method, req.URL, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestCancelSettledDisconnects(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 20, 9, 0, 0, 0, database.RollupLocation)
+	meter := &database.Meter{SerialNumber: "SM-0001", ConsumerID: primitive.NewObjectID()}
+	disconnect := database.MeterCommand{
+		ID: primitive.NewObjectID(), SerialNumber: "SM-0001", Type: database.CommandDisconnect,
+		Reason: database.DisconnectNonPayment, Status: database.CommandStatusPending,
+	}
+	readNow := database.MeterCommand{
+		ID: primitive.NewObjectID(), SerialNumber: "SM-0001", Type: database.CommandReadNow, Status: database.CommandStatusPending,
+	}
+	overdue := database.Bill{
+		ID: primitive.NewObjectID(), ConsumerID: meter.ConsumerID, Status: database.BillStatusOverdue,
+		Total: decimal.RequireFromString("500.00"), DueDate: now.AddDate(0, 0, -disconnectGraceDays-3),
+	}
+	commands := &databasetest.CommandStore{Commands: []database.MeterCommand{disconnect, readNow}}
+	bills := &databasetest.BillStore{Bills: []database.Bill{overdue}}
+	ledger := &databasetest.LedgerStore{Entries: []database.LedgerEntry{*database.BillLedgerEntry(&overdue)}}
+	db := &databasetest.Service{CommandStore: commands, BillStore: bills, LedgerStore: ledger}
+
+	// Still overdue: the disconnect stays queued
+	withdrawn, err := cancelSettledDisconnects(ctx, db, meter, now)
+	if err != nil || len(withdrawn) != 0 {
+		t.Fatalf("cancelSettledDisconnects() of an overdue account = %v, %v, want nothing withdrawn", withdrawn, err)
+	}
+
+	// The consumer pays after the disconnect was queued, before the meter polls
+	ledger.Entries = append(ledger.Entries, database.LedgerEntry{
+		ConsumerID: meter.ConsumerID, Type: database.LedgerTypePayment, Amount: overdue.Total.Neg(), SourceID: primitive.NewObjectID(),
+	})
+	bills.Bills[0].Status = database.BillStatusPaid
+	withdrawn, err = cancelSettledDisconnects(ctx, db, meter, now)
+	if err != nil || len(withdrawn) != 1 || withdrawn[0].ID != disconnect.ID {
+		t.Fatalf("cancelSettledDisconnects() after payment = %v, %v, want the disconnect withdrawn", withdrawn, err)
+	}
+	delivered, _ := commands.Deliver(ctx, "SM-0001", now)
+	if len(delivered) != 1 || delivered[0].ID != readNow.ID {
+		t.Errorf("Deliver() after payment = %+v, want only the read_now and no disconnect", delivered)
+	}
+	if cancelled := commands.Commands[0]; cancelled.Status != database.CommandStatusCancelled || cancelled.CancelledByName != settledCancellerName {
+		t.Errorf("disconnect = %+v, want cancelled by %q", cancelled, settledCancellerName)
+	}
+}
+
+func TestCancelSettledDisconnectsLeavesDelivered(t *testing.T) {
+	// A disconnect the meter already received is left to a reconnect. No
+	// bill or ledger store is set, as the account is not read without a
+	// pending disconnect to withdraw.
+	delivered := database.MeterCommand{
+		ID: primitive.NewObjectID(), SerialNumber: "SM-0001", Type: database.CommandDisconnect,
+		Reason: database.DisconnectNonPayment, Status: database.CommandStatusDelivered,
+	}
+	commands := &databasetest.CommandStore{Commands: []database.MeterCommand{delivered}}
+	meter := &database.Meter{SerialNumber: "SM-0001", ConsumerID: primitive.NewObjectID()}
+	withdrawn, err := cancelSettledDisconnects(context.Background(), &databasetest.Service{CommandStore: commands}, meter, time.Now())
+	if err != nil || len(withdrawn) != 0 || commands.Commands[0].Status != database.CommandStatusDelivered {
+		t.Errorf("cancelSettledDisconnects() = %v, %v, want the delivered disconnect kept", withdrawn, err)
+	}
+}
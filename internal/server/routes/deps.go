@@ -1,9 +1,22 @@
 // internal/server/routes/deps.go
 package routes
 
-import "go.uber.org/zap"
+import (
+	"SmartMeterSystem/internal/alerting"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/telemetry"
+
+	"go.uber.org/zap"
+)
 
 type ServerDeps interface {
 	GetLogger() *zap.Logger
 	GetDefaultRouteVersion() string
+	GetDB() database.Service
+	GetAuthenticator() *auth.Authenticator
+	GetSessions() *auth.SessionManager
+	GetConsoleURL(role string) (string, bool)
+	GetTelemetry() *telemetry.Hub
+	GetAlerting() *alerting.Engine
 }
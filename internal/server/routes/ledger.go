@@ -0,0 +1,211 @@
+/*
+ * @file internal/server/routes/ledger.go
+ * @brief ledger.go file shows the ledger of a consumer and posts adjustments and refunds to it
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/database"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// accountLeaseTTL bounds how long posting to one account may keep it locked
+// against other employees
+const accountLeaseTTL = 30 * time.Second
+
+// accountReleaseTimeout bounds giving the lease of an account up
+const accountReleaseTimeout = 5 * time.Second
+
+// ledgerForm is an adjustment or refund posted by web.ConsumerLedgerSection
+type ledgerForm struct {
+	Type   string
+	Amount decimal.Decimal
+	Reason string
+}
+
+// parseLedgerForm validates a posted adjustment or refund. An adjustment
+// raises what the consumer owes when positive and lowers it when negative; a
+// refund pays back credit and must be positive.
+func parseLedgerForm(form url.Values) (ledgerForm, []web.FormFieldError) {
+	v := newFormValidator(form)
+	entry := ledgerForm{
+		Type:   v.oneOf("type", "Entry Type", []string{database.LedgerTypeAdjustment, database.LedgerTypeRefund}),
+		Reason: v.required("reason", "Reason"),
+	}
+
+	amount, err := decimal.NewFromString(v.optional("amount"))
+	switch {
+	case err != nil:
+		v.fail("Amount", "must be an amount in pesos")
+	case amount.IsZero():
+		v.fail("Amount", "cannot be zero")
+	case entry.Type == database.LedgerTypeRefund && amount.IsNegative():
+		v.fail("Amount", "of a refund must be more than zero")
+	case !amount.Equal(amount.Round(2)):
+		v.fail("Amount", "cannot have fractions of a centavo")
+	}
+	entry.Amount = amount
+	return entry, v.errors
+}
+
+// lockAccount leases the account of the consumer so payments, adjustments
+// and refunds are posted to it one at a time. When the account is already
+// locked or the lease fails, the response is written and ok is false.
+func (c *V1EmployeeRoute) lockAccount(w http.ResponseWriter, r *http.Request, consumer *database.Consumer) (unlock func(), ok bool) {
+	db := c.Deps.GetDB()
+	lease, holder := "account-"+consumer.ID.Hex(), primitive.NewObjectID().Hex()
+	held, err := db.Leases().Acquire(r.Context(), lease, holder, accountLeaseTTL)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Account lease error: %v", err)
+		http.Error(w, "Error locking account", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !held {
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "Account Number", Message: "is being updated by someone else, try again shortly"}})
+		return nil, false
+	}
+	return func() {
+		// The request may be cancelled by now, which must not keep the
+		// account locked until the lease expires
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), accountReleaseTimeout)
+		defer cancel()
+		if err := db.Leases().Release(ctx, lease, holder); err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Account lease release error: %v", err)
+		}
+	}, true
+}
+
+// consumerLedger renders the ledger of the consumer with the account number
+func (c *V1EmployeeRoute) consumerLedger(w http.ResponseWriter, r *http.Request, accountNumber string) {
+	consumer, err := c.Deps.GetDB().Consumers().Get(r.Context(), accountNumber)
+	if errors.Is(err, database.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Consumer lookup error: %v", err)
+		http.Error(w, "Error loading ledger", http.StatusInternalServerError)
+		return
+	}
+	entries, err := c.Deps.GetDB().Ledger().List(r.Context(), consumer.ID)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Ledger list error: %v", err)
+		http.Error(w, "Error loading ledger", http.StatusInternalServerError)
+		return
+	}
+	rows, balance := ledgerView(entries)
+	web.ConsumerLedgerTable(rows, balance).Render(r.Context(), w)
+}
+
+// postLedgerEntry posts an adjustment or refund to the account of the
+// consumer, attributed to the employee making it. A refund cannot pay back
+// more than the credit of the account.
+func (c *V1EmployeeRoute) postLedgerEntry(w http.ResponseWriter, r *http.Request, accountNumber string) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	form, errs := parseLedgerForm(r.PostForm)
+	if len(errs) > 0 {
+		renderFormErrors(w, r, errs)
+		return
+	}
+
+	session := auth.SessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	db := c.Deps.GetDB()
+	employee, err := db.Users().FindByID(r.Context(), session.UserID)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Employee lookup error: %v", err)
+		http.Error(w, "Error posting to ledger", http.StatusInternalServerError)
+		return
+	}
+	consumer, err := db.Consumers().Get(r.Context(), accountNumber)
+	if errors.Is(err, database.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Consumer lookup error: %v", err)
+		http.Error(w, "Error posting to ledger", http.StatusInternalServerError)
+		return
+	}
+
+	unlock, locked := c.lockAccount(w, r, consumer)
+	if !locked {
+		return
+	}
+	defer unlock()
+
+	entry := &database.LedgerEntry{
+		ConsumerID:    consumer.ID,
+		AccountNumber: consumer.AccountNumber,
+		Type:          form.Type,
+		Amount:        form.Amount,
+		Description:   "Adjustment",
+		Reason:        form.Reason,
+		CreatedBy:     employee.ID,
+		CreatedByName: employee.Name,
+	}
+	if form.Type == database.LedgerTypeRefund {
+		bills, balance, err := accountStanding(r.Context(), c.Deps.GetDB(), consumer.ID)
+		if err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Account standing error: %v", err)
+			http.Error(w, "Error posting to ledger", http.StatusInternalServerError)
+			return
+		}
+		if credit := database.AccountCredit(balance, bills); form.Amount.GreaterThan(credit) {
+			renderFormErrors(w, r, []web.FormFieldError{{Field: "Amount", Message: "is more than the credit of PhP " + decimal.Max(credit, decimal.Zero).StringFixed(2)}})
+			return
+		}
+		entry.Description = "Refund of credit"
+	}
+
+	if err := db.Ledger().Append(r.Context(), entry); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Ledger append error: %v", err)
+		http.Error(w, "Error posting to ledger", http.StatusInternalServerError)
+		return
+	}
+
+	c.Deps.GetLogger().Sugar().Infof("Ledger %s of %s on %s by %s: %s",
+		entry.Type, entry.Amount.StringFixed(2), consumer.AccountNumber, employee.Email, entry.Reason)
+	w.Header().Set("HX-Trigger", "ledger-changed")
+	renderFormSuccess(w, r, entry.Description+" of PhP "+entry.Amount.StringFixed(2)+" posted to "+consumer.AccountNumber)
+}
+
+// ledgerView formats the ledger entries, oldest first, with the balance after
+// each one, and returns the final balance
+func ledgerView(entries []database.LedgerEntry) ([]web.LedgerRow, string) {
+	rows := make([]web.LedgerRow, 0, len(entries))
+	balance := decimal.Zero
+	for _, entry := range entries {
+		balance = balance.Add(entry.Amount)
+		by := entry.CreatedByName
+		if by == "" {
+			by = "System"
+		}
+		rows = append(rows, web.LedgerRow{
+			Date:        entry.CreatedAt.In(database.RollupLocation).Format(billDateLayout),
+			Type:        entry.Type,
+			Description: entry.Description,
+			Reference:   entry.Reference,
+			Reason:      entry.Reason,
+			By:          by,
+			Amount:      entry.Amount.StringFixed(2),
+			Balance:     balance.StringFixed(2),
+		})
+	}
+	return rows, balance.StringFixed(2)
+}
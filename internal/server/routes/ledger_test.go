@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"SmartMeterSystem/internal/database"
+	"net/url"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseLedgerForm(t *testing.T) {
+	tests := []struct {
+		name   string
+		form   url.Values
+		errors int
+	}{
+		{"credit adjustment", url.Values{"type": {"adjustment"}, "amount": {"-150.25"}, "reason": {"Meter misread in March"}}, 0},
+		{"refund", url.Values{"type": {"refund"}, "amount": {"300"}, "reason": {"Account closed"}}, 0},
+		{"negative refund", url.Values{"type": {"refund"}, "amount": {"-300"}, "reason": {"Account closed"}}, 1},
+		{"without reason", url.Values{"type": {"adjustment"}, "amount": {"10"}}, 1},
+		{"zero amount", url.Values{"type": {"adjustment"}, "amount": {"0"}, "reason": {"None"}}, 1},
+		{"payment type", url.Values{"type": {"payment"}, "amount": {"10"}, "reason": {"None"}}, 1},
+		{"empty", url.Values{}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := parseLedgerForm(tt.form)
+			if len(errs) != tt.errors {
+				t.Errorf("parseLedgerForm() errors = %+v, want %d", errs, tt.errors)
+			}
+		})
+	}
+}
+
+func TestLedgerView(t *testing.T) {
+	entries := []database.LedgerEntry{
+		{Type: database.LedgerTypeBill, Amount: decimal.RequireFromString("1200.00"), Description: "Bill for Jan 2025", Reference: "B00000001"},
+		{Type: database.LedgerTypeSurcharge, Amount: decimal.RequireFromString("24.00"), Reference: "B00000001"},
+		{Type: database.LedgerTypePayment, Amount: decimal.RequireFromString("-1300.00"), Reference: "OR00000001", CreatedByName: "Maria Santos"},
+	}
+	rows, balance := ledgerView(entries)
+	if len(rows) != 3 || balance != "-76.00" {
+		t.Fatalf("ledgerView() = %+v, %s", rows, balance)
+	}
+	if rows[0].Balance != "1200.00" || rows[1].Balance != "1224.00" || rows[2].Balance != "-76.00" {
+		t.Errorf("ledgerView() running balance = %s, %s, %s", rows[0].Balance, rows[1].Balance, rows[2].Balance)
+	}
+	if rows[0].By != "System" || rows[2].By != "Maria Santos" {
+		t.Errorf("ledgerView() by = %q, %q", rows[0].By, rows[2].By)
+	}
+}
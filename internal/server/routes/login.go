@@ -0,0 +1,53 @@
+/*
+ * @file internal/server/routes/login.go
+ * @brief login.go file holds the login helpers shared by the route groups
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/database"
+	"errors"
+	"net/http"
+)
+
+// loginUser checks the email and password posted by LoginWebPage and starts
+// a session for the account. On failure it renders the error into the
+// #error-message target and returns false; the caller only has to handle the
+// success case.
+func loginUser(deps ServerDeps, clientType string, w http.ResponseWriter, r *http.Request) (*database.User, bool) {
+	if err := r.ParseForm(); err != nil {
+		renderLoginError(w, r, http.StatusBadRequest, "Invalid login request")
+		return nil, false
+	}
+
+	user, err := deps.GetAuthenticator().Authenticate(r.Context(), clientType, r.PostFormValue("email"), r.PostFormValue("password"))
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		deps.GetLogger().Sugar().Infof("Failed %s login for %q", clientType, r.PostFormValue("email"))
+		renderLoginError(w, r, http.StatusOK, "Invalid email or password")
+		return nil, false
+	case err != nil:
+		deps.GetLogger().Sugar().Errorf("Login error: %v", err)
+		renderLoginError(w, r, http.StatusOK, "Login is unavailable, please try again later")
+		return nil, false
+	}
+
+	remember := r.PostFormValue("remember-me") != ""
+	if _, err := deps.GetSessions().Start(w, r, user, remember); err != nil {
+		deps.GetLogger().Sugar().Errorf("Session start error: %v", err)
+		renderLoginError(w, r, http.StatusOK, "Login is unavailable, please try again later")
+		return nil, false
+	}
+
+	return user, true
+}
+
+// renderLoginError writes the error fragment. HTMX does not swap 4xx/5xx
+// responses by default, so credential errors are sent with 200 OK.
+func renderLoginError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	web.LoginErrorMessage(message).Render(r.Context(), w)
+}
@@ -0,0 +1,271 @@
+/*
+ * @file internal/server/routes/meter.go
+ * @brief meter.go file holds the API smart meters report their readings to
+ */
+package routes
+
+import (
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/meterapi"
+	"SmartMeterSystem/internal/telemetry"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxReadingBatch bounds one upload; a meter that was offline for a
+	// day at 15 minute intervals sends 96 readings
+	maxReadingBatch = 1000
+	// maxReadingBodySize bounds the request body of one upload
+	maxReadingBodySize = 1 << 20
+	// maxClockSkew is how far in the future a reading timestamp may lie
+	maxClockSkew = 5 * time.Minute
+	// maxTamperFlags and maxTamperFlagLength bound the tamper flags of one
+	// reading
+	maxTamperFlags      = 8
+	maxTamperFlagLength = 32
+)
+
+// apiError is the JSON body of a failed JSON API request
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func (c *V1MeterRoute) HandleV1() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusNotFound, "not found")
+	})
+
+	mux.HandleFunc("/{serial}/readings", c.readings)
+	mux.HandleFunc("/{serial}/heartbeat", c.heartbeat)
+	mux.HandleFunc("/{serial}/commands", c.pollCommands)
+	mux.HandleFunc("/{serial}/commands/{id}/ack", c.acknowledgeCommand)
+
+	return mux
+}
+
+// readings ingests the readings of the meter named by the path. The meter
+// authenticates with "Authorization: Bearer <device token>".
+func (c *V1MeterRoute) readings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	meter, ok := c.authenticateMeter(w, r)
+	if !ok {
+		return
+	}
+
+	var batch meterapi.ReadingBatch
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReadingBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&batch); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	readings, err := validateReadings(meter.SerialNumber, batch.Readings, time.Now())
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	c.touch(r, meter)
+
+	inserted, err := c.Deps.GetDB().Readings().Insert(r.Context(), readings)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Reading insert error for %s: %v", meter.SerialNumber, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not store readings")
+		return
+	}
+
+	// Refresh over the whole batch, not just the inserted readings, so a
+	// retry after a failed refresh repairs the rollups
+	from, to := readingRange(readings)
+	if err := c.Deps.GetDB().Rollups().Refresh(r.Context(), meter.SerialNumber, from, to); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Rollup refresh error for %s: %v", meter.SerialNumber, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not update rollups")
+		return
+	}
+	if len(inserted) > 0 {
+		c.Deps.GetTelemetry().Publish(readingEvent(meter.SerialNumber, inserted))
+
+		// Alerting runs on the new readings only so a retried upload does
+		// not count its anomalies twice. A failure leaves them unflagged,
+		// which is no reason to reject readings already stored.
+		if err := c.Deps.GetAlerting().Check(r.Context(), meter, inserted); err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Alerting error for %s: %v", meter.SerialNumber, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meterapi.ReadingResult{
+		Accepted:   len(inserted),
+		Duplicates: len(batch.Readings) - len(inserted),
+	})
+}
+
+// heartbeat records that the meter named by the path is alive. Meters with no
+// reading due send one so they are not marked stale between uploads.
+func (c *V1MeterRoute) heartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	meter, ok := c.authenticateMeter(w, r)
+	if !ok {
+		return
+	}
+	if err := c.Deps.GetDB().Meters().Touch(r.Context(), meter.SerialNumber, time.Now()); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Heartbeat error for %s: %v", meter.SerialNumber, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not record heartbeat")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// touch records that the meter was heard from. A failure only delays the
+// meter being seen online, so the upload goes on.
+func (c *V1MeterRoute) touch(r *http.Request, meter *database.Meter) {
+	if err := c.Deps.GetDB().Meters().Touch(r.Context(), meter.SerialNumber, time.Now()); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Last seen update error for %s: %v", meter.SerialNumber, err)
+	}
+}
+
+// authenticateMeter checks the device token against the meter of the path.
+// Unknown meters and wrong tokens get the same response so serial numbers
+// cannot be probed.
+func (c *V1MeterRoute) authenticateMeter(w http.ResponseWriter, r *http.Request) (*database.Meter, bool) {
+	serial := r.PathValue("serial")
+	token := auth.BearerToken(r)
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="meter"`)
+		writeJSONError(w, http.StatusUnauthorized, "missing device token")
+		return nil, false
+	}
+
+	meter, err := c.Deps.GetDB().Meters().Get(r.Context(), serial)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		c.Deps.GetLogger().Sugar().Errorf("Meter lookup error for %s: %v", serial, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not authenticate meter")
+		return nil, false
+	}
+	if meter == nil || !auth.CheckDeviceToken(meter.DeviceTokenHash, token) {
+		c.Deps.GetLogger().Sugar().Warnf("Rejected device token for meter %q", serial)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="meter", error="invalid_token"`)
+		writeJSONError(w, http.StatusUnauthorized, "invalid device token")
+		return nil, false
+	}
+
+	if meter.Status == database.MeterStatusDecommissioned {
+		writeJSONError(w, http.StatusForbidden, "meter is decommissioned")
+		return nil, false
+	}
+	return meter, true
+}
+
+// validateReadings checks an uploaded batch and converts it for storage
+func validateReadings(serial string, batch []meterapi.Reading, now time.Time) ([]database.Reading, error) {
+	if len(batch) == 0 {
+		return nil, errors.New("readings: at least one reading is required")
+	}
+	if len(batch) > maxReadingBatch {
+		return nil, fmt.Errorf("readings: at most %d readings per upload", maxReadingBatch)
+	}
+
+	readings := make([]database.Reading, 0, len(batch))
+	seen := make(map[time.Time]bool, len(batch))
+	for i, reading := range batch {
+		switch {
+		case reading.Timestamp.IsZero():
+			return nil, fmt.Errorf("readings[%d]: timestamp is required", i)
+		case reading.Timestamp.After(now.Add(maxClockSkew)):
+			return nil, fmt.Errorf("readings[%d]: timestamp is in the future", i)
+		case reading.Timestamp.Before(now.Add(-database.RawReadingRetention)):
+			// Raw readings this old are already expired, they cannot be rolled up
+			return nil, fmt.Errorf("readings[%d]: timestamp is older than the raw reading retention", i)
+		case reading.EnergyKWh == nil || reading.PowerKW == nil || reading.Voltage == nil || reading.Current == nil:
+			return nil, fmt.Errorf("readings[%d]: energy_kwh, power_kw, voltage and current are required", i)
+		case *reading.EnergyKWh < 0:
+			return nil, fmt.Errorf("readings[%d]: energy_kwh cannot be negative", i)
+		case *reading.Voltage < 0 || *reading.Current < 0:
+			return nil, fmt.Errorf("readings[%d]: voltage and current cannot be negative", i)
+		case len(reading.TamperFlags) > maxTamperFlags:
+			return nil, fmt.Errorf("readings[%d]: at most %d tamper flags", i, maxTamperFlags)
+		}
+		for _, flag := range reading.TamperFlags {
+			if flag == "" || len(flag) > maxTamperFlagLength {
+				return nil, fmt.Errorf("readings[%d]: tamper flags must be 1 to %d characters", i, maxTamperFlagLength)
+			}
+		}
+
+		// Duplicates within one batch are dropped like retried uploads
+		timestamp := reading.Timestamp.UTC().Truncate(time.Millisecond)
+		if seen[timestamp] {
+			continue
+		}
+		seen[timestamp] = true
+
+		readings = append(readings, database.Reading{
+			SerialNumber: serial,
+			Timestamp:    timestamp,
+			EnergyKWh:    *reading.EnergyKWh,
+			PowerKW:      *reading.PowerKW,
+			Voltage:      *reading.Voltage,
+			Current:      *reading.Current,
+			TamperFlags:  reading.TamperFlags,
+		})
+	}
+	return readings, nil
+}
+
+// readingRange returns the earliest and latest timestamp of the readings
+func readingRange(readings []database.Reading) (from, to time.Time) {
+	from, to = readings[0].Timestamp, readings[0].Timestamp
+	for _, reading := range readings[1:] {
+		if reading.Timestamp.Before(from) {
+			from = reading.Timestamp
+		}
+		if reading.Timestamp.After(to) {
+			to = reading.Timestamp
+		}
+	}
+	return from, to
+}
+
+// readingEvent is the telemetry event carrying the newest of the readings
+func readingEvent(serial string, readings []database.Reading) telemetry.Event {
+	latest := readings[0]
+	for _, reading := range readings[1:] {
+		if reading.Timestamp.After(latest.Timestamp) {
+			latest = reading
+		}
+	}
+	return telemetry.Event{
+		Type:   telemetry.EventReading,
+		Serial: serial,
+		Reading: &telemetry.Reading{
+			Timestamp: latest.Timestamp,
+			EnergyKWh: latest.EnergyKWh,
+			PowerKW:   latest.PowerKW,
+			Voltage:   latest.Voltage,
+			Current:   latest.Current,
+		},
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Error: message})
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/meterapi"
+	"SmartMeterSystem/internal/telemetry"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func float(v float64) *float64 { return &v }
+
+func TestValidateReadings(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	reading := func(at time.Time) meterapi.Reading {
+		return meterapi.Reading{Timestamp: at, EnergyKWh: float(1520.5), PowerKW: float(1.2), Voltage: float(230.1), Current: float(5.2)}
+	}
+
+	readings, err := validateReadings("SM-0001", []meterapi.Reading{
+		reading(now.Add(-30 * time.Minute)),
+		reading(now.Add(-15 * time.Minute)),
+		reading(now.Add(-15 * time.Minute)),
+	}, now)
+	if err != nil {
+		t.Fatalf("validateReadings() error = %v", err)
+	}
+	if len(readings) != 2 || readings[0].SerialNumber != "SM-0001" {
+		t.Errorf("validateReadings() = %+v, want 2 readings without the in-batch duplicate", readings)
+	}
+
+	missing := reading(now)
+	missing.Voltage = nil
+	negative := reading(now)
+	negative.EnergyKWh = float(-1)
+	reverse := reading(now)
+	reverse.PowerKW = float(-0.4)
+	tampered := reading(now)
+	tampered.TamperFlags = []string{"cover_open"}
+	blankFlag := reading(now)
+	blankFlag.TamperFlags = []string{""}
+	manyFlags := reading(now)
+	manyFlags.TamperFlags = make([]string, maxTamperFlags+1)
+
+	tests := []struct {
+		name    string
+		batch   []meterapi.Reading
+		wantErr bool
+	}{
+		{"empty batch", nil, true},
+		{"missing timestamp", []meterapi.Reading{reading(time.Time{})}, true},
+		{"future timestamp", []meterapi.Reading{reading(now.Add(time.Hour))}, true},
+		{"expired timestamp", []meterapi.Reading{reading(now.Add(-database.RawReadingRetention - time.Hour))}, true},
+		{"small clock skew", []meterapi.Reading{reading(now.Add(time.Minute))}, false},
+		{"missing field", []meterapi.Reading{missing}, true},
+		{"negative energy", []meterapi.Reading{negative}, true},
+		{"reverse flow", []meterapi.Reading{reverse}, false},
+		{"tamper flag", []meterapi.Reading{tampered}, false},
+		{"blank tamper flag", []meterapi.Reading{blankFlag}, true},
+		{"too many tamper flags", []meterapi.Reading{manyFlags}, true},
+		{"oversized batch", make([]meterapi.Reading, maxReadingBatch+1), true},
+	}
+	for _, tt := range tests {
+		if _, err := validateReadings("SM-0001", tt.batch, now); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateReadings() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMeterReadingsRequiresDeviceToken(t *testing.T) {
+	handler := (&V1MeterRoute{}).HandleV1()
+
+	req := httptest.NewRequest(http.MethodPost, "/SM-0001/readings", strings.NewReader(`{"readings":[]}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST without token status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/SM-0001/readings", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/SM-0001/heartbeat", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST heartbeat without token status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestReadingEvent(t *testing.T) {
+	now := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	event := readingEvent("SM-0001", []database.Reading{
+		{Timestamp: now.Add(15 * time.Minute), PowerKW: 2.5},
+		{Timestamp: now, PowerKW: 1},
+	})
+	if event.Type != telemetry.EventReading || event.Serial != "SM-0001" || event.Reading == nil {
+		t.Fatalf("readingEvent() = %+v", event)
+	}
+	if !event.Reading.Timestamp.Equal(now.Add(15*time.Minute)) || event.Reading.PowerKW != 2.5 {
+		t.Errorf("readingEvent() reading = %+v, want the latest", event.Reading)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * @file internal/server/routes/outages.go
+ * @brief outages.go file lists the meter outages on the dashboard
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/database"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// outageWindow is how far back the dashboard lists outages
+const outageWindow = 7 * 24 * time.Hour
+
+// outageList renders the outages of the meters in service over the
+// outageWindow, ongoing ones included whenever they started
+func (c *V1EmployeeRoute) outageList(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	meters, err := c.Deps.GetDB().Meters().List(r.Context(), database.MeterFilter{
+		Statuses: []string{database.MeterStatusActive, database.MeterStatusInactive},
+	})
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Meter list error: %v", err)
+		http.Error(w, "Error loading outages", http.StatusInternalServerError)
+		return
+	}
+	transitions, err := c.Deps.GetDB().Connectivity().List(r.Context(), database.ConnectivityFilter{From: now.Add(-outageWindow)})
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Connectivity list error: %v", err)
+		http.Error(w, "Error loading outages", http.StatusInternalServerError)
+		return
+	}
+	web.MeterOutageList(outageView(meters, meterOutages(meters, transitions), now)).Render(r.Context(), w)
+}
+
+// meterOutages lists the outages of the transitions, adding those of the
+// meters offline since before the first transition listed, most recent
+// first
+func meterOutages(meters []database.Meter, transitions []database.ConnectivityTransition) []database.Outage {
+	outages := database.Outages(transitions)
+	ongoing := map[string]bool{}
+	for _, outage := range outages {
+		if outage.End.IsZero() {
+			ongoing[outage.SerialNumber] = true
+		}
+	}
+	for _, meter := range meters {
+		if meter.Connectivity != database.ConnectivityOffline || ongoing[meter.SerialNumber] {
+			continue
+		}
+		start := meter.LastSeenAt
+		if start.IsZero() {
+			start = meter.CreatedAt
+		}
+		outages = append(outages, database.Outage{SerialNumber: meter.SerialNumber, Start: start})
+	}
+	sort.SliceStable(outages, func(i, j int) bool { return outages[i].Start.After(outages[j].Start) })
+	return outages
+}
+
+// outageView formats the outages for web.MeterOutageList, ongoing first
+func outageView(meters []database.Meter, outages []database.Outage, now time.Time) []web.MeterOutage {
+	bySerial := make(map[string]database.Meter, len(meters))
+	for _, meter := range meters {
+		bySerial[meter.SerialNumber] = meter
+	}
+
+	view := make([]web.MeterOutage, 0, len(outages))
+	for _, outage := range outages {
+		meter := bySerial[outage.SerialNumber]
+		row := web.MeterOutage{
+			Serial:   outage.SerialNumber,
+			Name:     meter.Name,
+			Location: meter.Location,
+			Start:    formatSeenAt(outage.Start),
+			Duration: formatDuration(outage.Duration(now)),
+			Ongoing:  outage.End.IsZero(),
+		}
+		if !row.Ongoing {
+			row.End = formatSeenAt(outage.End)
+		}
+		view = append(view, row)
+	}
+	sort.SliceStable(view, func(i, j int) bool { return view[i].Ongoing && !view[j].Ongoing })
+	return view
+}
+
+// formatSeenAt formats when a meter was heard from
+func formatSeenAt(t time.Time) string {
+	if t.IsZero() {
+		return "Never"
+	}
+	t = t.In(database.RollupLocation)
+	return t.Format(billDateLayout) + " " + t.Format(receiptTimeLayout)
+}
+
+// formatDuration formats a duration to the minute, e.g. "2d 3h" or "45m"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := d / (24 * time.Hour)
+	hours := d % (24 * time.Hour) / time.Hour
+	minutes := d % time.Hour / time.Minute
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
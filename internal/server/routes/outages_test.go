@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"SmartMeterSystem/internal/database"
+	"testing"
+	"time"
+)
+
+func TestMeterOutages(t *testing.T) {
+	now := time.Date(2025, 3, 8, 12, 0, 0, 0, time.UTC)
+	transitions := []database.ConnectivityTransition{
+		{SerialNumber: "SM-0001", To: database.ConnectivityOffline, LastSeenAt: now.Add(-5 * time.Hour), At: now.Add(-4 * time.Hour)},
+		{SerialNumber: "SM-0001", From: database.ConnectivityOffline, To: database.ConnectivityOnline, LastSeenAt: now.Add(-2 * time.Hour), At: now.Add(-2 * time.Hour)},
+		{SerialNumber: "SM-0002", To: database.ConnectivityOffline, LastSeenAt: now.Add(-90 * time.Minute), At: now.Add(-time.Hour)},
+	}
+	meters := []database.Meter{
+		{SerialNumber: "SM-0001", Connectivity: database.ConnectivityOnline},
+		{SerialNumber: "SM-0002", Connectivity: database.ConnectivityOffline},
+		// Offline since before the transitions listed
+		{SerialNumber: "SM-0003", Name: "Pump", Connectivity: database.ConnectivityOffline, LastSeenAt: now.Add(-10 * 24 * time.Hour)},
+	}
+
+	outages := meterOutages(meters, transitions)
+	if len(outages) != 3 {
+		t.Fatalf("meterOutages() = %+v", outages)
+	}
+	if outages[0].SerialNumber != "SM-0002" || !outages[0].End.IsZero() {
+		t.Errorf("meterOutages()[0] = %+v, want the ongoing SM-0002", outages[0])
+	}
+	if outages[1].SerialNumber != "SM-0001" || outages[1].Duration(now) != 3*time.Hour {
+		t.Errorf("meterOutages()[1] = %+v, want SM-0001 down 3h", outages[1])
+	}
+
+	view := outageView(meters, outages, now)
+	if !view[0].Ongoing || !view[1].Ongoing || view[2].Ongoing || view[2].End == "" {
+		t.Errorf("outageView() = %+v, want the ongoing outages first", view)
+	}
+	if view[1].Name != "Pump" || view[1].Duration != "10d 0h" {
+		t.Errorf("outageView()[1] = %+v", view[1])
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		45 * time.Minute:              "45m",
+		3*time.Hour + 25*time.Minute:  "3h 25m",
+		50*time.Hour + 59*time.Second: "2d 2h",
+		29 * time.Second:              "0m",
+	}
+	for d, want := range tests {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
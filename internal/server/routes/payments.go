@@ -0,0 +1,459 @@
+/*
+ * @file internal/server/routes/payments.go
+ * @brief payments.go file holds the cashier console posting payments and reporting collections
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/database"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// receiptTimeLayout formats the time of day a payment was received
+const receiptTimeLayout = "03:04 PM"
+
+// paymentForm is a payment posted by web.PaymentAccountContainer
+type paymentForm struct {
+	AccountNumber string
+	Method        string
+	Reference     string
+	Amount        decimal.Decimal
+}
+
+// parsePaymentForm validates the fields of a payment. Checks and e-wallet
+// payments need their reference to be traced.
+func parsePaymentForm(form url.Values) (paymentForm, []web.FormFieldError) {
+	v := newFormValidator(form)
+	payment := paymentForm{
+		AccountNumber: v.required("account", "Account Number"),
+		Method: v.oneOf("method", "Method", []string{
+			database.PaymentMethodCash,
+			database.PaymentMethodCheck,
+			database.PaymentMethodEWallet,
+		}),
+		Reference: v.optional("reference"),
+	}
+	if (payment.Method == database.PaymentMethodCheck || payment.Method == database.PaymentMethodEWallet) && payment.Reference == "" {
+		v.fail("Check No. / E-Wallet Reference", "is required for "+web.PaymentMethodLabel(payment.Method)+" payments")
+	}
+	if payment.Method == database.PaymentMethodCash {
+		payment.Reference = ""
+	}
+
+	amount, err := decimal.NewFromString(v.optional("amount"))
+	switch {
+	case err != nil:
+		v.fail("Amount Received", "must be an amount in pesos")
+	case !amount.IsPositive():
+		v.fail("Amount Received", "must be more than zero")
+	case !amount.Equal(amount.Round(2)):
+		v.fail("Amount Received", "cannot have fractions of a centavo")
+	}
+	payment.Amount = amount
+	return payment, v.errors
+}
+
+// preparePayment spreads the amount received over what the account owes:
+// first the charges outside the bills, such as surcharges, when the credit is
+// negative, then the unpaid bills oldest first, spending the credit the
+// account has along with it. What is left is kept as credit.
+func preparePayment(consumer *database.Consumer, bills []database.Bill, credit decimal.Decimal, form paymentForm) *database.Payment {
+	payment := &database.Payment{
+		ConsumerID:    consumer.ID,
+		AccountNumber: consumer.AccountNumber,
+		PayorName:     consumer.FullName(),
+		Method:        form.Method,
+		Reference:     form.Reference,
+		Amount:        form.Amount,
+	}
+
+	funds := form.Amount
+	if credit.IsNegative() {
+		payment.Charges = decimal.Min(funds, credit.Neg())
+		funds = funds.Sub(payment.Charges)
+	} else {
+		funds = funds.Add(credit)
+	}
+
+	balances := make([]decimal.Decimal, 0, len(bills))
+	for _, bill := range bills {
+		balances = append(balances, bill.Balance())
+	}
+	applied, left := billing.Allocate(funds, balances)
+	for i, amount := range applied {
+		if amount.IsPositive() {
+			payment.Allocations = append(payment.Allocations, database.PaymentAllocation{
+				BillID:     bills[i].ID,
+				BillNumber: bills[i].Number,
+				Amount:     amount,
+			})
+		}
+	}
+
+	if !credit.IsPositive() {
+		payment.Credited = left
+	} else if change := left.Sub(credit); change.IsNegative() {
+		payment.CreditApplied = change.Neg()
+	} else {
+		payment.Credited = change
+	}
+	return payment
+}
+
+// paymentsPage renders the posting form with the receipts the signed in
+// cashier issued today
+func (c *V1EmployeeRoute) paymentsPage(w http.ResponseWriter, r *http.Request) {
+	session := auth.SessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	from := database.PeriodStart(database.GranularityDay, time.Now())
+	payments, err := c.Deps.GetDB().Payments().List(r.Context(), database.PaymentFilter{
+		CashierID: session.UserID,
+		From:      from,
+		To:        from.AddDate(0, 0, 1),
+	})
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Payment list error: %v", err)
+		http.Error(w, "Error loading payments", http.StatusInternalServerError)
+		return
+	}
+
+	receipts := make([]web.PaymentReceipt, 0, len(payments))
+	for i := len(payments) - 1; i >= 0; i-- {
+		receipts = append(receipts, receiptView(&payments[i]))
+	}
+	web.CashierPaymentsWebPage(consoleOf(r), receipts).Render(r.Context(), w)
+}
+
+// paymentAccount renders the unpaid bills and balance of the account in the
+// "account" query parameter
+func (c *V1EmployeeRoute) paymentAccount(w http.ResponseWriter, r *http.Request) {
+	accountNumber := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("account")))
+	consumer, err := c.Deps.GetDB().Consumers().Get(r.Context(), accountNumber)
+	if errors.Is(err, database.ErrNotFound) {
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "Account Number", Message: "is not registered"}})
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Consumer lookup error: %v", err)
+		http.Error(w, "Error loading account", http.StatusInternalServerError)
+		return
+	}
+	bills, balance, err := accountStanding(r.Context(), c.Deps.GetDB(), consumer.ID)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Account standing error: %v", err)
+		http.Error(w, "Error loading account", http.StatusInternalServerError)
+		return
+	}
+	web.PaymentAccountContainer(paymentAccountView(consumer, bills, balance)).Render(r.Context(), w)
+}
+
+// accountStanding returns the unpaid bills of the consumer, oldest first,
+// and their ledger balance
+func accountStanding(ctx context.Context, db database.Service, consumerID primitive.ObjectID) ([]database.Bill, decimal.Decimal, error) {
+	bills, err := db.Bills().ListUnpaid(ctx, consumerID)
+	if err != nil {
+		return nil, decimal.Decimal{}, err
+	}
+	balance, err := db.Ledger().Balance(ctx, consumerID)
+	if err != nil {
+		return nil, decimal.Decimal{}, err
+	}
+	return bills, balance, nil
+}
+
+// paymentAccountView formats an account and its unpaid bills for posting
+func paymentAccountView(consumer *database.Consumer, bills []database.Bill, balance decimal.Decimal) web.PaymentAccount {
+	credit := database.AccountCredit(balance, bills)
+	view := web.PaymentAccount{
+		AccountNumber: consumer.AccountNumber,
+		Name:          consumer.FullName(),
+		Address:       consumer.Address(),
+		Status:        consumer.Status,
+		Credit:        decimal.Max(credit, decimal.Zero).StringFixed(2),
+		OtherCharges:  decimal.Max(credit.Neg(), decimal.Zero).StringFixed(2),
+		Outstanding:   decimal.Max(balance, decimal.Zero).StringFixed(2),
+	}
+	for _, bill := range bills {
+		view.Bills = append(view.Bills, web.PaymentBill{
+			Number:  bill.Number,
+			Period:  billPeriod(&bill),
+			DueDate: bill.DueDate.In(database.RollupLocation).Format(billDateLayout),
+			Status:  bill.Status,
+			Total:   bill.Total.StringFixed(2),
+			Paid:    bill.AmountPaid.StringFixed(2),
+			Balance: bill.Balance().StringFixed(2),
+		})
+	}
+	return view
+}
+
+// postPayment records a payment, enters it in the ledger and applies it to
+// the unpaid bills of the account, which is locked meanwhile so two cashiers
+// cannot spend the same balance. The credit of the account is derived from
+// the ledger, so a payment entered but not applied to a bill remains credit
+// and is spent by the next payment. A payment recorded but not entered is
+// entered before the next one is applied, or by the billing scheduler.
+func (c *V1EmployeeRoute) postPayment(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	form, errs := parsePaymentForm(r.PostForm)
+	if len(errs) > 0 {
+		renderFormErrors(w, r, errs)
+		return
+	}
+
+	session := auth.SessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	db := c.Deps.GetDB()
+	cashier, err := db.Users().FindByID(r.Context(), session.UserID)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Cashier lookup error: %v", err)
+		http.Error(w, "Error posting payment", http.StatusInternalServerError)
+		return
+	}
+
+	consumer, err := db.Consumers().Get(r.Context(), form.AccountNumber)
+	if errors.Is(err, database.ErrNotFound) {
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "Account Number", Message: "is not registered"}})
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Consumer lookup error: %v", err)
+		http.Error(w, "Error posting payment", http.StatusInternalServerError)
+		return
+	}
+
+	unlock, locked := c.lockAccount(w, r, consumer)
+	if !locked {
+		return
+	}
+	defer unlock()
+
+	if err := database.EnterPayments(r.Context(), db, consumer.ID); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Earlier payments not entered in the ledger: %v", err)
+		http.Error(w, "Error posting payment", http.StatusInternalServerError)
+		return
+	}
+	bills, balance, err := accountStanding(r.Context(), c.Deps.GetDB(), consumer.ID)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Account standing error: %v", err)
+		http.Error(w, "Error posting payment", http.StatusInternalServerError)
+		return
+	}
+	payment := preparePayment(consumer, bills, database.AccountCredit(balance, bills), form)
+	payment.CashierID = cashier.ID
+	payment.CashierName = cashier.Name
+
+	if err := db.Payments().Create(r.Context(), payment); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Payment create error: %v", err)
+		http.Error(w, "Error posting payment", http.StatusInternalServerError)
+		return
+	}
+
+	entered := true
+	if err := database.EnterPayment(r.Context(), db, payment); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Receipt %s not entered in the ledger yet: %v", payment.ReceiptNumber, err)
+		entered = false
+	}
+	unapplied := []string{}
+	for _, allocation := range payment.Allocations {
+		for i := range bills {
+			if bills[i].ID != allocation.BillID {
+				continue
+			}
+			if err := db.Bills().ApplyPayment(r.Context(), &bills[i], allocation.Amount); err != nil {
+				c.Deps.GetLogger().Sugar().Errorf("Receipt %s not applied to bill %s: %v", payment.ReceiptNumber, bills[i].Number, err)
+				unapplied = append(unapplied, "bill "+bills[i].Number)
+			}
+		}
+	}
+
+	c.Deps.GetLogger().Sugar().Infof("Receipt %s: %s %s from %s by %s",
+		payment.ReceiptNumber, payment.Method, payment.Amount.StringFixed(2), consumer.AccountNumber, cashier.Email)
+	summary := paymentSummary(payment)
+	if len(unapplied) > 0 {
+		summary += " Could not update " + strings.Join(unapplied, ", ") + "; report the receipt to the finance office."
+	}
+	if !entered {
+		summary += " The account balance shows the payment once the ledger is reachable again."
+	}
+	w.Header().Set("Content-Type", "text/html")
+	web.PaymentPostedMessage(receiptView(payment), summary).Render(r.Context(), w)
+}
+
+// paymentSummary describes where a payment went
+func paymentSummary(payment *database.Payment) string {
+	parts := []string{}
+	for _, allocation := range payment.Allocations {
+		parts = append(parts, fmt.Sprintf("%s to bill %s", allocation.Amount.StringFixed(2), allocation.BillNumber))
+	}
+	if payment.Charges.IsPositive() {
+		parts = append(parts, fmt.Sprintf("%s to surcharges and other charges", payment.Charges.StringFixed(2)))
+	}
+	if payment.CreditApplied.IsPositive() {
+		parts = append(parts, fmt.Sprintf("%s of earlier credit used", payment.CreditApplied.StringFixed(2)))
+	}
+	if payment.Credited.IsPositive() {
+		parts = append(parts, fmt.Sprintf("%s kept as credit", payment.Credited.StringFixed(2)))
+	}
+	return "Applied " + strings.Join(parts, ", ") + "."
+}
+
+// receiptView formats a payment for the cashier pages
+func receiptView(payment *database.Payment) web.PaymentReceipt {
+	return web.PaymentReceipt{
+		ID:            payment.ID.Hex(),
+		ReceiptNumber: payment.ReceiptNumber,
+		AccountNumber: payment.AccountNumber,
+		PayorName:     payment.PayorName,
+		Method:        web.PaymentMethodLabel(payment.Method),
+		Reference:     payment.Reference,
+		Amount:        payment.Amount.StringFixed(2),
+		Credited:      payment.Credited.StringFixed(2),
+		ReceivedAt:    payment.ReceivedAt.In(database.RollupLocation).Format(receiptTimeLayout),
+	}
+}
+
+// receiptPDF sends the official receipt named by the last path segment
+// ("<id>.pdf") for printing
+func (c *V1EmployeeRoute) receiptPDF(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(path.Base(r.URL.Path), ".pdf")
+	id, err := primitive.ObjectIDFromHex(name)
+	if !ok || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	payment, err := c.Deps.GetDB().Payments().Get(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Payment lookup error: %v", err)
+		http.Error(w, "Error loading receipt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", payment.ReceiptNumber+".pdf"))
+	if err := writeReceiptPDF(w, payment); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Receipt PDF error: %v", err)
+	}
+}
+
+// shiftReport renders the collections of the day in the "date" query
+// parameter, today by default, per cashier
+func (c *V1EmployeeRoute) shiftReport(w http.ResponseWriter, r *http.Request) {
+	day := database.PeriodStart(database.GranularityDay, time.Now())
+	if value := r.URL.Query().Get("date"); value != "" {
+		parsed, err := time.ParseInLocation(dateLayout, value, database.RollupLocation)
+		if err != nil {
+			http.Error(w, "Invalid date", http.StatusBadRequest)
+			return
+		}
+		day = parsed
+	}
+
+	payments, err := c.Deps.GetDB().Payments().List(r.Context(), database.PaymentFilter{From: day, To: day.AddDate(0, 0, 1)})
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Payment list error: %v", err)
+		http.Error(w, "Error loading payments", http.StatusInternalServerError)
+		return
+	}
+	report := collectionReport(payments)
+	report.Date = day.Format(dateLayout)
+	web.CashierShiftReportWebPage(consoleOf(r), report).Render(r.Context(), w)
+}
+
+// collectionTotals accumulates the payments of one cashier
+type collectionTotals struct {
+	cashier    string
+	receipts   []string
+	byMethod   map[string]decimal.Decimal
+	total      decimal.Decimal
+	applied    decimal.Decimal
+	credited   decimal.Decimal
+	creditUsed decimal.Decimal
+}
+
+func (t *collectionTotals) add(payment *database.Payment) {
+	t.receipts = append(t.receipts, payment.ReceiptNumber)
+	t.byMethod[payment.Method] = t.byMethod[payment.Method].Add(payment.Amount)
+	t.total = t.total.Add(payment.Amount)
+	t.applied = t.applied.Add(payment.Charges)
+	for _, allocation := range payment.Allocations {
+		t.applied = t.applied.Add(allocation.Amount)
+	}
+	t.credited = t.credited.Add(payment.Credited)
+	t.creditUsed = t.creditUsed.Add(payment.CreditApplied)
+}
+
+func (t *collectionTotals) row() web.ShiftReportRow {
+	row := web.ShiftReportRow{
+		Cashier:    t.cashier,
+		Receipts:   len(t.receipts),
+		Cash:       t.byMethod[database.PaymentMethodCash].StringFixed(2),
+		Check:      t.byMethod[database.PaymentMethodCheck].StringFixed(2),
+		EWallet:    t.byMethod[database.PaymentMethodEWallet].StringFixed(2),
+		Total:      t.total.StringFixed(2),
+		Applied:    t.applied.StringFixed(2),
+		Credited:   t.credited.StringFixed(2),
+		CreditUsed: t.creditUsed.StringFixed(2),
+	}
+	if len(t.receipts) > 0 {
+		// Receipt numbers are zero padded, so they sort as strings
+		sort.Strings(t.receipts)
+		row.FirstReceipt, row.LastReceipt = t.receipts[0], t.receipts[len(t.receipts)-1]
+	}
+	return row
+}
+
+// collectionReport totals the payments per cashier and overall. For every
+// row, Total is what the cashier must turn over and equals Applied plus
+// Credited less CreditUsed.
+func collectionReport(payments []database.Payment) web.ShiftReport {
+	totals := &collectionTotals{cashier: "Total", byMethod: map[string]decimal.Decimal{}}
+	cashiers := map[primitive.ObjectID]*collectionTotals{}
+	order := []primitive.ObjectID{}
+	for i := range payments {
+		payment := &payments[i]
+		cashier, ok := cashiers[payment.CashierID]
+		if !ok {
+			cashier = &collectionTotals{cashier: payment.CashierName, byMethod: map[string]decimal.Decimal{}}
+			cashiers[payment.CashierID] = cashier
+			order = append(order, payment.CashierID)
+		}
+		cashier.add(payment)
+		totals.add(payment)
+	}
+
+	report := web.ShiftReport{Rows: make([]web.ShiftReportRow, 0, len(order)), Totals: totals.row()}
+	for _, id := range order {
+		report.Rows = append(report.Rows, cashiers[id].row())
+	}
+	sort.SliceStable(report.Rows, func(i, j int) bool { return report.Rows[i].Cashier < report.Rows[j].Cashier })
+	return report
+}
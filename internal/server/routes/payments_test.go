@@ -0,0 +1,201 @@
+package routes
+
+import (
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/database/databasetest"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParsePaymentForm(t *testing.T) {
+	tests := []struct {
+		name   string
+		form   url.Values
+		errors int
+	}{
+		{"cash", url.Values{"account": {"C000001"}, "method": {"cash"}, "amount": {"1500.50"}}, 0},
+		{"check without number", url.Values{"account": {"C000001"}, "method": {"check"}, "amount": {"100"}}, 1},
+		{"e-wallet", url.Values{"account": {"C000001"}, "method": {"ewallet"}, "reference": {"GC-123"}, "amount": {"100"}}, 0},
+		{"zero amount", url.Values{"account": {"C000001"}, "method": {"cash"}, "amount": {"0"}}, 1},
+		{"fraction of a centavo", url.Values{"account": {"C000001"}, "method": {"cash"}, "amount": {"10.005"}}, 1},
+		{"unknown method", url.Values{"account": {"C000001"}, "method": {"barter"}, "amount": {"10"}}, 1},
+		{"empty", url.Values{}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := parsePaymentForm(tt.form)
+			if len(errs) != tt.errors {
+				t.Errorf("parsePaymentForm() errors = %v, want %d", errs, tt.errors)
+			}
+		})
+	}
+}
+
+func TestPreparePayment(t *testing.T) {
+	bill := func(number, total, paid string) database.Bill {
+		return database.Bill{
+			ID:         primitive.NewObjectID(),
+			Number:     number,
+			Total:      decimal.RequireFromString(total),
+			AmountPaid: decimal.RequireFromString(paid),
+		}
+	}
+	bills := []database.Bill{bill("B1", "1000.00", "400.00"), bill("B2", "800.00", "0")}
+	amount := func(value string) decimal.Decimal { return decimal.RequireFromString(value) }
+
+	tests := []struct {
+		name          string
+		credit        string
+		amount        string
+		allocations   []string
+		charges       string
+		creditApplied string
+		credited      string
+	}{
+		{"partial", "0", "500", []string{"500"}, "0", "0", "0"},
+		{"credit spent first on arrears", "100", "1300", []string{"600", "800"}, "0", "100", "0"},
+		{"overpayment", "0", "1500", []string{"600", "800"}, "0", "0", "100"},
+		{"credit grows", "50", "1450", []string{"600", "800"}, "0", "0", "50"},
+		{"surcharge paid first", "-30", "530", []string{"500"}, "30", "0", "0"},
+		{"surcharge not covered", "-30", "20", nil, "20", "0", "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consumer := &database.Consumer{ID: primitive.NewObjectID(), AccountNumber: "C000001"}
+			payment := preparePayment(consumer, bills, amount(tt.credit), paymentForm{Method: database.PaymentMethodCash, Amount: amount(tt.amount)})
+			if len(payment.Allocations) != len(tt.allocations) {
+				t.Fatalf("preparePayment() allocations = %+v, want %v", payment.Allocations, tt.allocations)
+			}
+			for i, want := range tt.allocations {
+				if !payment.Allocations[i].Amount.Equal(amount(want)) || payment.Allocations[i].BillNumber != bills[i].Number {
+					t.Errorf("preparePayment() allocation %d = %+v, want %s", i, payment.Allocations[i], want)
+				}
+			}
+			if !payment.Charges.Equal(amount(tt.charges)) {
+				t.Errorf("preparePayment() charges = %s, want %s", payment.Charges, tt.charges)
+			}
+			if !payment.CreditApplied.Equal(amount(tt.creditApplied)) || !payment.Credited.Equal(amount(tt.credited)) {
+				t.Errorf("preparePayment() credit applied %s, credited %s", payment.CreditApplied, payment.Credited)
+			}
+		})
+	}
+}
+
+func TestCollectionReport(t *testing.T) {
+	ana, ben := primitive.NewObjectID(), primitive.NewObjectID()
+	payment := func(receipt string, cashier primitive.ObjectID, name, method, amount, applied, credited, creditApplied string) database.Payment {
+		return database.Payment{
+			ReceiptNumber: receipt,
+			CashierID:     cashier,
+			CashierName:   name,
+			Method:        method,
+			Amount:        decimal.RequireFromString(amount),
+			Allocations:   []database.PaymentAllocation{{Amount: decimal.RequireFromString(applied)}},
+			Credited:      decimal.RequireFromString(credited),
+			CreditApplied: decimal.RequireFromString(creditApplied),
+		}
+	}
+	report := collectionReport([]database.Payment{
+		payment("OR00000003", ben, "Ben", database.PaymentMethodCheck, "2000.00", "2000.00", "0", "0"),
+		payment("OR00000002", ana, "Ana", database.PaymentMethodCash, "500.00", "400.00", "100.00", "0"),
+		payment("OR00000004", ana, "Ana", database.PaymentMethodEWallet, "300.00", "350.00", "0", "50.00"),
+	})
+
+	if len(report.Rows) != 2 || report.Rows[0].Cashier != "Ana" {
+		t.Fatalf("collectionReport() rows = %+v", report.Rows)
+	}
+	ana1 := report.Rows[0]
+	if ana1.Receipts != 2 || ana1.FirstReceipt != "OR00000002" || ana1.LastReceipt != "OR00000004" {
+		t.Errorf("collectionReport() Ana receipts = %+v", ana1)
+	}
+	if ana1.Cash != "500.00" || ana1.EWallet != "300.00" || ana1.Total != "800.00" || ana1.Applied != "750.00" || ana1.Credited != "100.00" || ana1.CreditUsed != "50.00" {
+		t.Errorf("collectionReport() Ana = %+v", ana1)
+	}
+	if report.Totals.Receipts != 3 || report.Totals.Total != "2800.00" || report.Totals.Check != "2000.00" {
+		t.Errorf("collectionReport() totals = %+v", report.Totals)
+	}
+}
+
+func TestWriteReceiptPDF(t *testing.T) {
+	payment := &database.Payment{
+		ID:            primitive.NewObjectID(),
+		ReceiptNumber: "OR00000001",
+		AccountNumber: "C000001",
+		PayorName:     "Juan Dela Cruz",
+		Method:        database.PaymentMethodCheck,
+		Reference:     "BPI 000123",
+		Amount:        decimal.RequireFromString("1500.00"),
+		Allocations:   []database.PaymentAllocation{{BillNumber: "B00000001", Amount: decimal.RequireFromString("1200.00")}},
+		Credited:      decimal.RequireFromString("300.00"),
+		CashierName:   "Maria Santos",
+		ReceivedAt:    time.Date(2025, 2, 10, 9, 30, 0, 0, database.RollupLocation),
+	}
+	var buf bytes.Buffer
+	if err := writeReceiptPDF(&buf, payment); err != nil {
+		t.Fatalf("writeReceiptPDF() error = %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Errorf("writeReceiptPDF() did not write a PDF")
+	}
+}
+
+// TestPostPaymentEntersLeftOutPayments checks that a payment the ledger
+// could not take is entered before the next payment to the account is
+// applied, and only once
+func TestPostPaymentEntersLeftOutPayments(t *testing.T) {
+	cashier := database.User{ID: primitive.NewObjectID(), Name: "Liza Cruz"}
+	consumer := database.Consumer{ID: primitive.NewObjectID(), AccountNumber: "0000042"}
+	ledger := &databasetest.LedgerStore{Err: errors.New("ledger unavailable")}
+	payments := &databasetest.PaymentStore{}
+	route := &V1EmployeeRoute{Deps: dbDeps{db: &databasetest.Service{
+		UserStore:     &databasetest.UserStore{Users: []database.User{cashier}},
+		ConsumerStore: &databasetest.ConsumerStore{Consumers: []database.Consumer{consumer}},
+		BillStore:     &databasetest.BillStore{},
+		LedgerStore:   ledger,
+		LeaseStore:    &databasetest.LeaseStore{},
+		PaymentStore:  payments,
+	}}}
+	post := func() *httptest.ResponseRecorder {
+		form := url.Values{"account": {consumer.AccountNumber}, "method": {database.PaymentMethodCash}, "amount": {"500.00"}}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(auth.WithSession(req.Context(), &database.Session{UserID: cashier.ID}))
+		rec := httptest.NewRecorder()
+		route.postPayment(rec, req)
+		return rec
+	}
+
+	// The receipt stands while the ledger is down
+	if rec := post(); rec.Code != http.StatusOK || len(payments.Payments) != 1 || payments.Payments[0].Entered {
+		t.Fatalf("posting with the ledger down: status = %d, payments = %+v, want one not entered", rec.Code, payments.Payments)
+	}
+
+	// The next payment enters the first before being applied
+	ledger.Err = nil
+	rec := post()
+	if rec.Code != http.StatusOK || len(ledger.Entries) != 2 {
+		t.Fatalf("posting again: status = %d, entries = %d, want both payments entered", rec.Code, len(ledger.Entries))
+	}
+	if first := payments.Payments[0].ReceiptNumber; ledger.Entries[0].Reference != first {
+		t.Errorf("first ledger entry = %s, want receipt %s entered first", ledger.Entries[0].Reference, first)
+	}
+	for _, payment := range payments.Payments {
+		if !payment.Entered {
+			t.Errorf("payment %s not marked entered", payment.ReceiptNumber)
+		}
+	}
+	if err := database.EnterPayments(context.Background(), route.Deps.GetDB(), primitive.NilObjectID); err != nil || len(ledger.Entries) != 2 {
+		t.Errorf("EnterPayments() again = %v with %d entries, want 2", err, len(ledger.Entries))
+	}
+}
@@ -0,0 +1,249 @@
+/*
+ * @file internal/server/routes/ratefiles.go
+ * @brief ratefiles.go file holds the CSV and JSON import and export of rate schedules
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/database"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxRateFileSize bounds an uploaded rate schedule
+const maxRateFileSize = 1 << 20
+
+// rateCSVHeader names the columns of a rate table CSV, one rate per line
+var rateCSVHeader = []string{"Group", "Particulars", "Unit", "Rates", "ERC"}
+
+// writeRateTableCSV writes the rates of a table under rateCSVHeader. A group
+// without components is written as a rate of its own name.
+func writeRateTableCSV(w io.Writer, table web.AccountingRatesTable) error {
+	writer := csv.NewWriter(w)
+	writer.Write(rateCSVHeader)
+	for _, row := range table.AccountingRatesTableRowGroup {
+		subRows := row.SubRowGroup
+		if len(subRows) == 0 {
+			subRows = []web.SubRowGroup{{Particulars: row.Particulars, Unit: row.Unit, Rates: row.Rates, ERC: row.ERC}}
+		}
+		for _, subRow := range subRows {
+			writer.Write([]string{row.Particulars, subRow.Particulars, subRow.Unit, subRow.Rates.String(), subRow.ERC.String()})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// readRateTableCSV reads a rate table CSV. The header names the columns, in
+// any order and case; the Rates or ERC column is only required for its kind.
+// Consecutive lines of the same group are its components.
+func readRateTableCSV(r io.Reader, kind string) (web.AccountingRatesTable, []web.FormFieldError) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return web.AccountingRatesTable{}, []web.FormFieldError{{Field: "File", Message: "must be a CSV with a header line"}}
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	amountColumn := "rates"
+	if kind == database.RateKindERC {
+		amountColumn = "erc"
+	}
+	errs := []web.FormFieldError{}
+	for _, name := range []string{"group", "particulars", "unit", amountColumn} {
+		if _, ok := columns[name]; !ok {
+			errs = append(errs, web.FormFieldError{Field: "File", Message: fmt.Sprintf("the header has no %q column", name)})
+		}
+	}
+	if len(errs) > 0 {
+		return web.AccountingRatesTable{}, errs
+	}
+
+	table := web.AccountingRatesTable{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			errs = append(errs, web.FormFieldError{Field: fmt.Sprintf("Line %d", line), Message: err.Error()})
+			break
+		}
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if slices.IndexFunc(record, func(value string) bool { return strings.TrimSpace(value) != "" }) < 0 {
+			continue // blank line
+		}
+
+		subRow := web.SubRowGroup{Particulars: cell("particulars"), Unit: cell("unit")}
+		for _, column := range []struct {
+			name   string
+			amount *web.RateAmount
+		}{{"rates", &subRow.Rates}, {"erc", &subRow.ERC}} {
+			value := cell(column.name)
+			if value == "" {
+				continue
+			}
+			rate, err := billing.ParseRate(value)
+			if err != nil {
+				errs = append(errs, web.FormFieldError{Field: fmt.Sprintf("Line %d", line), Message: err.Error()})
+				continue
+			}
+			*column.amount = web.NewRateAmount(rate)
+		}
+
+		group := cell("group")
+		rows := table.AccountingRatesTableRowGroup
+		if len(rows) == 0 || rows[len(rows)-1].Particulars != group {
+			rows = append(rows, web.AccountingRatesTableRowGroup{Particulars: group})
+		}
+		rows[len(rows)-1].SubRowGroup = append(rows[len(rows)-1].SubRowGroup, subRow)
+		table.AccountingRatesTableRowGroup = rows
+	}
+	return table, errs
+}
+
+// readRateTableJSON reads a table in the shape it is exported in
+func readRateTableJSON(r io.Reader) (web.AccountingRatesTable, []web.FormFieldError) {
+	var table web.AccountingRatesTable
+	err := json.NewDecoder(r).Decode(&table)
+	var cells web.RateTableError
+	switch {
+	case errors.As(err, &cells):
+		return web.AccountingRatesTable{}, cells
+	case err != nil:
+		return web.AccountingRatesTable{}, []web.FormFieldError{{Field: "File", Message: "must be a JSON rate table"}}
+	}
+	return table, nil
+}
+
+// importRateSchedule drafts a schedule of the class of the page from an
+// uploaded CSV or JSON file. The file only provides the rates; the kind and
+// effective date are those chosen on the form.
+func (c *V1EmployeeRoute) importRateSchedule(w http.ResponseWriter, r *http.Request) {
+	class, ok := rateClassOf(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRateFileSize)
+	if err := r.ParseMultipartForm(maxRateFileSize); err != nil {
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "File", Message: "must be at most 1 MB"}})
+		return
+	}
+
+	v := newFormValidator(r.PostForm)
+	kind := v.oneOf("kind", "Schedule", []string{database.RateKindBilled, database.RateKindERC})
+	date := v.required("date", "Effective Date")
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		v.errors = append(v.errors, web.FormFieldError{Field: "File", Message: "is required"})
+	}
+	if len(v.errors) > 0 {
+		renderFormErrors(w, r, v.errors)
+		return
+	}
+	defer file.Close()
+
+	var table web.AccountingRatesTable
+	var errs []web.FormFieldError
+	switch strings.ToLower(path.Ext(header.Filename)) {
+	case ".csv":
+		table, errs = readRateTableCSV(file, kind)
+	case ".json":
+		table, errs = readRateTableJSON(file)
+	default:
+		errs = []web.FormFieldError{{Field: "File", Message: "must be a .csv or .json file"}}
+	}
+	if len(errs) > 0 {
+		renderFormErrors(w, r, errs)
+		return
+	}
+
+	table.Particulars = strings.ToUpper(class)
+	table.Date = date
+	schedule, errs := parseRateSchedule(table, kind)
+	if len(errs) > 0 {
+		renderFormErrors(w, r, errs)
+		return
+	}
+	c.draftRateSchedule(w, r, schedule)
+}
+
+// exportRateTable downloads a rate table in the format of its extension:
+// the version named by the "id" query parameter, or else both schedules of
+// the class in force now
+func (c *V1EmployeeRoute) exportRateTable(w http.ResponseWriter, r *http.Request, format string) {
+	var table web.AccountingRatesTable
+	var name string
+	if id := r.URL.Query().Get("id"); id != "" {
+		scheduleID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		schedule, err := c.Deps.GetDB().RateSchedules().Get(r.Context(), scheduleID)
+		if errors.Is(err, database.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Rate schedule lookup error: %v", err)
+			http.Error(w, "Error loading rates", http.StatusInternalServerError)
+			return
+		}
+		if schedule.Kind == database.RateKindERC {
+			table = accountingTable(schedule.Class, nil, schedule)
+		} else {
+			table = accountingTable(schedule.Class, schedule, nil)
+		}
+		table.Date = schedule.EffectiveDate.In(database.RollupLocation).Format(dateLayout)
+		name = fmt.Sprintf("%s-%s-v%d", schedule.Class, schedule.Kind, schedule.Version)
+	} else {
+		class, ok := rateClassOf(r)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		billed, erc, err := c.effectiveSchedules(r, class)
+		if err != nil {
+			c.Deps.GetLogger().Sugar().Errorf("Rate schedule lookup error: %v", err)
+			http.Error(w, "Error loading rates", http.StatusInternalServerError)
+			return
+		}
+		table = accountingTable(class, billed, erc)
+		name = fmt.Sprintf("%s-%s", class, time.Now().In(database.RollupLocation).Format(dateLayout))
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="rates-%s.%s"`, name, format))
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(table)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	writeRateTableCSV(w, table)
+}
@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/database"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRateTableCSV(t *testing.T) {
+	table := web.AccountingRatesTable{
+		AccountingRatesTableRowGroup: []web.AccountingRatesTableRowGroup{
+			{Particulars: "Supply Charges", SubRowGroup: []web.SubRowGroup{
+				{Particulars: "Supply Retail Customer Charge", Unit: "PhP/Cust/Mo", Rates: amountOf("0.0000"), ERC: amountOf("1.0000")},
+				{Particulars: "Supply System Charge", Unit: "PhP/kWh", Rates: amountOf("0.5376")},
+			}},
+			{Particulars: "Lifeline Rate Subsidy", Unit: "PhP/kWh", Rates: amountOf("0.0012"), ERC: amountOf("0.0010")},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeRateTableCSV(&buf, table); err != nil {
+		t.Fatalf("writeRateTableCSV() error = %v", err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 4 {
+		t.Errorf("writeRateTableCSV() wrote %d lines:\n%s", lines, buf.String())
+	}
+
+	read, errs := readRateTableCSV(&buf, database.RateKindBilled)
+	if len(errs) > 0 {
+		t.Fatalf("readRateTableCSV() errors = %+v", errs)
+	}
+	rows := read.AccountingRatesTableRowGroup
+	if len(rows) != 2 || len(rows[0].SubRowGroup) != 2 || rows[0].SubRowGroup[1].ERC.Valid || rows[1].SubRowGroup[0].ERC.String() != "0.0010" {
+		t.Errorf("readRateTableCSV() = %+v", read)
+	}
+}
+
+func TestReadRateTableCSVErrors(t *testing.T) {
+	// An ERC circular only needs the ERC column, in any order and case
+	circular := "particulars,UNIT,group,erc\nGeneration Energy Charge,PhP/kWh,Generation Charges,5.6092\n"
+	if _, errs := readRateTableCSV(strings.NewReader(circular), database.RateKindERC); len(errs) > 0 {
+		t.Errorf("readRateTableCSV() of an ERC circular errors = %+v", errs)
+	}
+	if _, errs := readRateTableCSV(strings.NewReader(circular), database.RateKindBilled); !hasFieldError(errs, "File") {
+		t.Errorf("readRateTableCSV() without a rates column errors = %+v", errs)
+	}
+
+	malformed := "Group,Particulars,Unit,Rates\nGeneration Charges,Generation Energy Charge,PhP/kWh,5.60.92\n"
+	if _, errs := readRateTableCSV(strings.NewReader(malformed), database.RateKindBilled); !hasFieldError(errs, "Line 2") {
+		t.Errorf("readRateTableCSV() of a malformed rate errors = %+v", errs)
+	}
+}
@@ -0,0 +1,565 @@
+/*
+ * @file internal/server/routes/rates.go
+ * @brief rates.go file holds the accounting pages managing the rate schedules
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/database"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// rateClasses are the consumer classes with rate schedules, in display order
+var rateClasses = []string{
+	database.ConsumerTypeResidential,
+	database.ConsumerTypeCommercial,
+	database.ConsumerTypeIndustrial,
+}
+
+// dateTimeLayout formats the times shown with the rate versions
+const dateTimeLayout = "2006-01-02 15:04"
+
+// rateKey names one rate of a schedule
+type rateKey struct {
+	group, rate string
+}
+
+// rateClassOf returns the class of the "class" query parameter, residential
+// when missing
+func rateClassOf(r *http.Request) (string, bool) {
+	class := r.URL.Query().Get("class")
+	if class == "" {
+		return database.ConsumerTypeResidential, true
+	}
+	return class, slices.Contains(rateClasses, class)
+}
+
+// effectiveSchedule returns the schedule of the class and kind in force now,
+// nil when the class has none yet
+func (c *V1EmployeeRoute) effectiveSchedule(r *http.Request, class, kind string) (*database.RateSchedule, error) {
+	schedule, err := c.Deps.GetDB().RateSchedules().Effective(r.Context(), class, kind, time.Now())
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	return schedule, err
+}
+
+// accountingTable lays the billed and ERC schedules of a class out as one
+// table. The components of both are listed, those of the billed schedule
+// first; a class without any schedule gets the default components unpriced.
+func accountingTable(class string, billed, erc *database.RateSchedule) web.AccountingRatesTable {
+	layout := []billing.RateGroup{}
+	for _, schedule := range []*database.RateSchedule{billed, erc} {
+		if schedule != nil {
+			layout = mergeRateLayout(layout, schedule.Groups)
+		}
+	}
+	if len(layout) == 0 {
+		layout = billing.DefaultGroups()
+	}
+
+	billedAmounts, ercAmounts := scheduleAmounts(billed), scheduleAmounts(erc)
+	table := web.AccountingRatesTable{
+		Particulars: strings.ToUpper(class),
+	}
+	if billed != nil {
+		table.Date = billed.EffectiveDate.In(database.RollupLocation).Format(dateLayout)
+	}
+
+	var billedTotal, ercTotal decimal.Decimal
+	for _, group := range layout {
+		row := web.AccountingRatesTableRowGroup{Particulars: group.Particulars}
+		var billedGroup, ercGroup decimal.Decimal
+		for _, rate := range group.Rates {
+			key := rateKey{group.Particulars, rate.Particulars}
+			subRow := web.SubRowGroup{Particulars: rate.Particulars, Unit: string(rate.Unit)}
+			if amount, ok := billedAmounts[key]; ok {
+				subRow.Rates = web.NewRateAmount(amount)
+				billedGroup = billedGroup.Add(amount)
+			}
+			if amount, ok := ercAmounts[key]; ok {
+				subRow.ERC = web.NewRateAmount(amount)
+				ercGroup = ercGroup.Add(amount)
+			}
+			row.SubRowGroup = append(row.SubRowGroup, subRow)
+		}
+		if billed != nil {
+			row.Rates = web.NewRateAmount(billedGroup)
+			billedTotal = billedTotal.Add(billedGroup)
+		}
+		if erc != nil {
+			row.ERC = web.NewRateAmount(ercGroup)
+			ercTotal = ercTotal.Add(ercGroup)
+		}
+		table.AccountingRatesTableRowGroup = append(table.AccountingRatesTableRowGroup, row)
+	}
+	if billed != nil {
+		table.Rates = web.NewRateAmount(billedTotal)
+	}
+	if erc != nil {
+		table.ERC = web.NewRateAmount(ercTotal)
+	}
+	return table
+}
+
+// mergeRateLayout appends the groups and rates of next missing from layout
+func mergeRateLayout(layout, next []billing.RateGroup) []billing.RateGroup {
+	for _, group := range next {
+		index := slices.IndexFunc(layout, func(g billing.RateGroup) bool { return g.Particulars == group.Particulars })
+		if index < 0 {
+			layout = append(layout, billing.RateGroup{Particulars: group.Particulars})
+			index = len(layout) - 1
+		}
+		for _, rate := range group.Rates {
+			if !slices.ContainsFunc(layout[index].Rates, func(r billing.Rate) bool { return r.Particulars == rate.Particulars }) {
+				layout[index].Rates = append(layout[index].Rates, rate)
+			}
+		}
+	}
+	return layout
+}
+
+// scheduleAmounts indexes the amounts of a schedule, nil for no schedule
+func scheduleAmounts(schedule *database.RateSchedule) map[rateKey]decimal.Decimal {
+	if schedule == nil {
+		return nil
+	}
+	amounts := map[rateKey]decimal.Decimal{}
+	for _, group := range schedule.Groups {
+		for _, rate := range group.Rates {
+			amounts[rateKey{group.Particulars, rate.Particulars}] = rate.Amount
+		}
+	}
+	return amounts
+}
+
+// rateChanges lists the rates a draft changes, adds or removes compared to
+// the live schedule of its kind, nil when there is none
+func rateChanges(live, draft *database.RateSchedule) []web.RateChange {
+	liveAmounts := scheduleAmounts(live)
+	draftAmounts := scheduleAmounts(draft)
+
+	layout := mergeRateLayout([]billing.RateGroup{}, draft.Groups)
+	if live != nil {
+		layout = mergeRateLayout(layout, live.Groups)
+	}
+
+	changes := []web.RateChange{}
+	for _, group := range layout {
+		for _, rate := range group.Rates {
+			key := rateKey{group.Particulars, rate.Particulars}
+			before, wasLive := liveAmounts[key]
+			after, drafted := draftAmounts[key]
+
+			change := web.RateChange{Group: group.Particulars, Particulars: rate.Particulars, Unit: string(rate.Unit)}
+			switch {
+			case wasLive && drafted:
+				if before.Equal(after) {
+					continue
+				}
+				change.Live, change.Draft = formatRate(before), formatRate(after)
+				change.Change = after.Sub(before).StringFixed(4)
+				if after.GreaterThan(before) {
+					change.Change = "+" + change.Change
+				}
+			case drafted:
+				change.Draft, change.Change = formatRate(after), "added"
+			default:
+				change.Live, change.Change = formatRate(before), "removed"
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// formatRate writes a rate the way the rate tables print them
+func formatRate(amount decimal.Decimal) string {
+	return amount.StringFixed(4)
+}
+
+// rateTableFromAccounting converts one column of an accounting rate table,
+// the rates or the ERC one. The sub-rows are the rates; a row without
+// sub-rows is a rate itself.
+func rateTableFromAccounting(table web.AccountingRatesTable, kind string) (billing.RateTable, error) {
+	column := func(rates, erc web.RateAmount) web.RateAmount {
+		if kind == database.RateKindERC {
+			return erc
+		}
+		return rates
+	}
+
+	rates := billing.RateTable{Class: table.Particulars}
+	for _, row := range table.AccountingRatesTableRowGroup {
+		group := billing.RateGroup{Particulars: row.Particulars}
+
+		subRows := row.SubRowGroup
+		if len(subRows) == 0 {
+			subRows = []web.SubRowGroup{{Particulars: row.Particulars, Unit: row.Unit, Rates: row.Rates, ERC: row.ERC}}
+		}
+		for _, subRow := range subRows {
+			unit, err := billing.ParseUnit(subRow.Unit)
+			if err != nil {
+				return billing.RateTable{}, fmt.Errorf("%s / %s: %w", row.Particulars, subRow.Particulars, err)
+			}
+			amount := column(subRow.Rates, subRow.ERC)
+			if !amount.Valid {
+				return billing.RateTable{}, fmt.Errorf("%s / %s: a rate is required", row.Particulars, subRow.Particulars)
+			}
+			group.Rates = append(group.Rates, billing.Rate{Particulars: subRow.Particulars, Unit: unit, Amount: amount.Amount})
+		}
+		rates.Groups = append(rates.Groups, group)
+	}
+	return rates, nil
+}
+
+// validateAccountingTable checks both columns of a table: no rate may be
+// negative, and every filled total must equal the sum of the rows below it
+// to the four places the tables print
+func validateAccountingTable(table web.AccountingRatesTable) []web.FormFieldError {
+	errs := []web.FormFieldError{}
+	for _, column := range []string{"Rates", "ERC"} {
+		pick := func(rates, erc web.RateAmount) web.RateAmount {
+			if column == "ERC" {
+				return erc
+			}
+			return rates
+		}
+		notNegative := func(label string, amount web.RateAmount) {
+			if amount.Valid && amount.Amount.IsNegative() {
+				errs = append(errs, web.FormFieldError{Field: label + " " + column, Message: "must not be negative"})
+			}
+		}
+		sumsUp := func(label string, total web.RateAmount, parts []web.RateAmount) {
+			if !total.Valid {
+				return
+			}
+			var sum decimal.Decimal
+			for _, part := range parts {
+				if part.Valid {
+					sum = sum.Add(part.Amount)
+				}
+			}
+			if formatRate(sum) != total.String() {
+				errs = append(errs, web.FormFieldError{
+					Field:   label + " " + column,
+					Message: fmt.Sprintf("total %s does not equal %s, the sum of its rates", total, formatRate(sum)),
+				})
+			}
+		}
+
+		groupTotals := []web.RateAmount{}
+		for _, row := range table.AccountingRatesTableRowGroup {
+			total := pick(row.Rates, row.ERC)
+			groupTotals = append(groupTotals, total)
+			if len(row.SubRowGroup) == 0 {
+				notNegative(row.Particulars, total)
+				continue
+			}
+			parts := []web.RateAmount{}
+			for _, subRow := range row.SubRowGroup {
+				amount := pick(subRow.Rates, subRow.ERC)
+				notNegative(row.Particulars+" / "+subRow.Particulars, amount)
+				parts = append(parts, amount)
+			}
+			sumsUp(row.Particulars, total, parts)
+		}
+		sumsUp("Total", pick(table.Rates, table.ERC), groupTotals)
+	}
+	return errs
+}
+
+// parseRateSchedule reads a submitted update form into a new version of
+// the class named by its header row
+func parseRateSchedule(payload web.AccountingRatesTable, kind string) (*database.RateSchedule, []web.FormFieldError) {
+	errs := []web.FormFieldError{}
+
+	class := strings.ToLower(strings.TrimSpace(payload.Particulars))
+	if !slices.Contains(rateClasses, class) {
+		errs = append(errs, web.FormFieldError{Field: "Particulars", Message: "must be a consumer class"})
+	}
+
+	effective, err := time.ParseInLocation(dateLayout, strings.TrimSpace(payload.Date), database.RollupLocation)
+	if err != nil {
+		errs = append(errs, web.FormFieldError{Field: "Effective Date", Message: "must be a date in YYYY-MM-DD format"})
+	}
+
+	errs = append(errs, validateAccountingTable(payload)...)
+
+	table, err := rateTableFromAccounting(payload, kind)
+	if err != nil {
+		errs = append(errs, web.FormFieldError{Field: "Rates", Message: err.Error()})
+	} else if len(table.Groups) == 0 {
+		errs = append(errs, web.FormFieldError{Field: "Rates", Message: "at least one rate is required"})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &database.RateSchedule{
+		Class:         class,
+		Kind:          kind,
+		EffectiveDate: effective,
+		Groups:        table.Groups,
+	}, nil
+}
+
+// rateHistory lists the versions of both kinds of the class, newest first
+func (c *V1EmployeeRoute) rateHistory(r *http.Request, class string, billed, erc *database.RateSchedule) ([]web.RateScheduleVersion, error) {
+	schedules := []database.RateSchedule{}
+	for _, kind := range []string{database.RateKindBilled, database.RateKindERC} {
+		history, err := c.Deps.GetDB().RateSchedules().History(r.Context(), class, kind)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, history...)
+	}
+	slices.SortStableFunc(schedules, func(a, b database.RateSchedule) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	versions := make([]web.RateScheduleVersion, 0, len(schedules))
+	for _, schedule := range schedules {
+		version := web.RateScheduleVersion{
+			ID:            schedule.ID.Hex(),
+			Kind:          kindLabel(schedule.Kind),
+			Version:       schedule.Version,
+			EffectiveDate: schedule.EffectiveDate.In(database.RollupLocation).Format(dateLayout),
+			CreatedBy:     schedule.CreatedByName,
+			CreatedAt:     schedule.CreatedAt.In(database.RollupLocation).Format(dateTimeLayout),
+			Status:        schedule.Status,
+			Current:       (billed != nil && billed.ID == schedule.ID) || (erc != nil && erc.ID == schedule.ID),
+		}
+		if schedule.Review != nil {
+			version.ReviewedBy = schedule.Review.ReviewedByName
+			version.ReviewComment = schedule.Review.Comment
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// accountingPage renders the schedules of the class in force now
+func (c *V1EmployeeRoute) accountingPage(w http.ResponseWriter, r *http.Request) {
+	class, ok := rateClassOf(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	billed, erc, err := c.effectiveSchedules(r, class)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Rate schedule lookup error: %v", err)
+		http.Error(w, "Error loading rates", http.StatusInternalServerError)
+		return
+	}
+	history, err := c.rateHistory(r, class, billed, erc)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Rate history error: %v", err)
+		http.Error(w, "Error loading rates", http.StatusInternalServerError)
+		return
+	}
+
+	drafts, err := c.pendingDrafts(r, class, billed, erc)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Pending rate drafts error: %v", err)
+		http.Error(w, "Error loading rates", http.StatusInternalServerError)
+		return
+	}
+
+	web.SystemAdminEmployeeAccountingWebPage(
+		consoleOf(r),
+		web.AccountingRatesTableFormType.Display,
+		accountingTable(class, billed, erc),
+		class,
+		drafts,
+		history,
+	).Render(r.Context(), w)
+}
+
+// pendingDrafts lists the drafts of the class awaiting review with their
+// changes to the live schedules
+func (c *V1EmployeeRoute) pendingDrafts(r *http.Request, class string, billed, erc *database.RateSchedule) ([]web.RateDraft, error) {
+	pending, err := c.Deps.GetDB().RateSchedules().Pending(r.Context(), class)
+	if err != nil {
+		return nil, err
+	}
+
+	session := auth.SessionFromContext(r.Context())
+	drafts := make([]web.RateDraft, 0, len(pending))
+	for _, draft := range pending {
+		live := billed
+		if draft.Kind == database.RateKindERC {
+			live = erc
+		}
+		drafts = append(drafts, web.RateDraft{
+			ID:            draft.ID.Hex(),
+			Kind:          kindLabel(draft.Kind),
+			Version:       draft.Version,
+			EffectiveDate: draft.EffectiveDate.In(database.RollupLocation).Format(dateLayout),
+			CreatedBy:     draft.CreatedByName,
+			CreatedAt:     draft.CreatedAt.In(database.RollupLocation).Format(dateTimeLayout),
+			OwnDraft:      session != nil && session.UserID == draft.CreatedBy,
+			Changes:       rateChanges(live, &draft),
+		})
+	}
+	return drafts, nil
+}
+
+// effectiveSchedules returns the billed and ERC schedules of the class in force now
+func (c *V1EmployeeRoute) effectiveSchedules(r *http.Request, class string) (billed, erc *database.RateSchedule, err error) {
+	if billed, err = c.effectiveSchedule(r, class, database.RateKindBilled); err != nil {
+		return nil, nil, err
+	}
+	if erc, err = c.effectiveSchedule(r, class, database.RateKindERC); err != nil {
+		return nil, nil, err
+	}
+	return billed, erc, nil
+}
+
+// rateForm renders the update form of one column, prefilled with the
+// schedules in force and effective from today
+func (c *V1EmployeeRoute) rateForm(w http.ResponseWriter, r *http.Request, formType string) {
+	class, ok := rateClassOf(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	billed, erc, err := c.effectiveSchedules(r, class)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Rate schedule lookup error: %v", err)
+		http.Error(w, "Error loading rates", http.StatusInternalServerError)
+		return
+	}
+
+	table := accountingTable(class, billed, erc)
+	table.Date = time.Now().In(database.RollupLocation).Format(dateLayout)
+	web.SystemAdminEmployeeAccountingTable(formType, table).Render(r.Context(), w)
+}
+
+// submitRateSchedule stores a submitted update form as a new version
+func (c *V1EmployeeRoute) submitRateSchedule(w http.ResponseWriter, r *http.Request, kind string) {
+	var payload web.AccountingRatesTable
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		var cells web.RateTableError
+		if errors.As(err, &cells) {
+			renderFormErrors(w, r, cells)
+			return
+		}
+		c.Deps.GetLogger().Sugar().Errorf("Decode error: %v", err)
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	schedule, errs := parseRateSchedule(payload, kind)
+	if len(errs) > 0 {
+		renderFormErrors(w, r, errs)
+		return
+	}
+	c.draftRateSchedule(w, r, schedule)
+}
+
+// draftRateSchedule stores a schedule read from a form or file as a draft
+// of the signed in employee awaiting review
+func (c *V1EmployeeRoute) draftRateSchedule(w http.ResponseWriter, r *http.Request, schedule *database.RateSchedule) {
+	// The author is recorded so that someone else reviews the draft
+	session := auth.SessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	schedule.CreatedBy = session.UserID
+	if user, err := c.Deps.GetDB().Users().FindByID(r.Context(), session.UserID); err == nil {
+		schedule.CreatedByName = user.Name
+	}
+
+	if err := c.Deps.GetDB().RateSchedules().Create(r.Context(), schedule); err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Rate schedule create error: %v", err)
+		http.Error(w, "Error saving rates", http.StatusInternalServerError)
+		return
+	}
+
+	effective := schedule.EffectiveDate.Format(dateLayout)
+	c.Deps.GetLogger().Sugar().Infof("Drafted %s %s schedule version %d effective %s",
+		schedule.Class, schedule.Kind, schedule.Version, effective)
+	renderFormSuccess(w, r, fmt.Sprintf("Version %d of the %s %s submitted for approval, effective %s",
+		schedule.Version, schedule.Class, kindLabel(schedule.Kind), effective))
+}
+
+// reviewRateSchedule approves or rejects the draft named by the path. The
+// reviewer must not be its author.
+func (c *V1EmployeeRoute) reviewRateSchedule(w http.ResponseWriter, r *http.Request, id string) {
+	draftID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	v := newFormValidator(r.PostForm)
+	decision := v.oneOf("decision", "Decision", []string{"approve", "reject"})
+	comment := v.required("comment", "Comment")
+	if len(v.errors) > 0 {
+		renderFormErrors(w, r, v.errors)
+		return
+	}
+
+	session := auth.SessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	review := database.RateReview{ReviewedBy: session.UserID, Comment: comment}
+	if user, err := c.Deps.GetDB().Users().FindByID(r.Context(), session.UserID); err == nil {
+		review.ReviewedByName = user.Name
+	}
+
+	status := database.RateStatusApproved
+	if decision == "reject" {
+		status = database.RateStatusRejected
+	}
+
+	err = c.Deps.GetDB().RateSchedules().Decide(r.Context(), draftID, status, review)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, database.ErrSelfReview):
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "Decision", Message: "a draft must be reviewed by someone other than its author"}})
+		return
+	case errors.Is(err, database.ErrInvalidStatusTransition):
+		renderFormErrors(w, r, []web.FormFieldError{{Field: "Decision", Message: "the draft has already been reviewed"}})
+		return
+	case err != nil:
+		c.Deps.GetLogger().Sugar().Errorf("Rate review error: %v", err)
+		http.Error(w, "Error saving review", http.StatusInternalServerError)
+		return
+	}
+
+	c.Deps.GetLogger().Sugar().Infof("Rate schedule %s %s by %s", id, status, review.ReviewedByName)
+	renderFormSuccess(w, r, "The draft was "+status)
+}
+
+// kindLabel names a schedule kind in messages
+func kindLabel(kind string) string {
+	if kind == database.RateKindERC {
+		return "ERC rates"
+	}
+	return "rates"
+}
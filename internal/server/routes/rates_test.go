@@ -0,0 +1,280 @@
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/database"
+	"SmartMeterSystem/internal/database/databasetest"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// amountOf returns a filled rate table cell
+func amountOf(value string) web.RateAmount {
+	return web.NewRateAmount(decimal.RequireFromString(value))
+}
+
+func TestRateTableFromAccounting(t *testing.T) {
+	table := web.AccountingRatesTable{
+		Particulars: "RESIDENTIAL",
+		AccountingRatesTableRowGroup: []web.AccountingRatesTableRowGroup{
+			{Particulars: "Supply Charges", Rates: amountOf("0.5376"), SubRowGroup: []web.SubRowGroup{
+				{Particulars: "Supply Retail Customer Charge", Unit: "PhP/Cust/Mo", Rates: amountOf("0.0000"), ERC: amountOf("1.0000")},
+				{Particulars: "Supply System Charge", Unit: "PhP/kWh", Rates: amountOf("0.5376"), ERC: amountOf("0.5000")},
+			}},
+			{Particulars: "Lifeline Rate Subsidy", Unit: "PhP/kWh", Rates: amountOf("0.0012"), ERC: amountOf("0.0010")},
+		},
+	}
+
+	rates, err := rateTableFromAccounting(table, database.RateKindBilled)
+	if err != nil {
+		t.Fatalf("rateTableFromAccounting() error = %v", err)
+	}
+	if rates.Class != "RESIDENTIAL" || len(rates.Groups) != 2 || len(rates.Groups[0].Rates) != 2 {
+		t.Fatalf("rateTableFromAccounting() = %+v", rates)
+	}
+	if rate := rates.Groups[1].Rates[0]; rate.Particulars != "Lifeline Rate Subsidy" || rate.Amount.String() != "0.0012" {
+		t.Errorf("row without sub-rows = %+v", rate)
+	}
+
+	erc, err := rateTableFromAccounting(table, database.RateKindERC)
+	if err != nil {
+		t.Fatalf("rateTableFromAccounting() ERC error = %v", err)
+	}
+	if got := erc.Groups[0].Rates[0].Amount.String(); got != "1" {
+		t.Errorf("ERC column amount = %s, want 1", got)
+	}
+
+	table.AccountingRatesTableRowGroup[0].SubRowGroup[1].Rates = web.RateAmount{}
+	if _, err := rateTableFromAccounting(table, database.RateKindBilled); err == nil {
+		t.Error("rateTableFromAccounting() accepted a blank rate")
+	}
+}
+
+func TestParseRateSchedule(t *testing.T) {
+	payload := web.AccountingRatesTable{
+		Date:        "2025-02-01",
+		Particulars: "COMMERCIAL",
+		AccountingRatesTableRowGroup: []web.AccountingRatesTableRowGroup{
+			{Particulars: "Generation Charges", SubRowGroup: []web.SubRowGroup{
+				{Particulars: "Generation Energy Charge", Unit: "PhP/kWh", Rates: amountOf("5.6092")},
+			}},
+		},
+	}
+
+	schedule, errs := parseRateSchedule(payload, database.RateKindBilled)
+	if len(errs) > 0 {
+		t.Fatalf("parseRateSchedule() errors = %+v", errs)
+	}
+	if schedule.Class != database.ConsumerTypeCommercial || schedule.EffectiveDate.Day() != 1 || len(schedule.Groups) != 1 {
+		t.Errorf("parseRateSchedule() = %+v", schedule)
+	}
+
+	payload.Particulars = "GOVERNMENT"
+	payload.Date = "02/01/2025"
+	_, errs = parseRateSchedule(payload, database.RateKindBilled)
+	for _, label := range []string{"Particulars", "Effective Date"} {
+		if !hasFieldError(errs, label) {
+			t.Errorf("parseRateSchedule() errors = %+v, want a %q error", errs, label)
+		}
+	}
+}
+
+func TestAccountingRatesTableUnmarshal(t *testing.T) {
+	// The json-enc extension flattens the update forms
+	form := `{
+		"date": "2025-02-01",
+		"particulars": "RESIDENTIAL",
+		"rates": "5.6100",
+		"row-group[1].particulars": "Lifeline Rate Subsidy",
+		"row-group[1].rates": 0.0008,
+		"row-group[0].particulars": "Generation Charges",
+		"row-group[0].rates": "5.6092",
+		"row-group[0].sub-row-group[0].particulars": "Generation Energy Charge",
+		"row-group[0].sub-row-group[0].unit": "PhP/kWh",
+		"row-group[0].sub-row-group[0].rates": "5.6092"
+	}`
+	var table web.AccountingRatesTable
+	if err := json.Unmarshal([]byte(form), &table); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	rows := table.AccountingRatesTableRowGroup
+	if len(rows) != 2 || rows[0].SubRowGroup[0].Rates.String() != "5.6092" || rows[1].Rates.String() != "0.0008" || rows[1].ERC.Valid {
+		t.Errorf("Unmarshal() = %+v", table)
+	}
+
+	// What is marshalled reads back the same
+	data, err := json.Marshal(table)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var again web.AccountingRatesTable
+	if err := json.Unmarshal(data, &again); err != nil || again.AccountingRatesTableRowGroup[0].SubRowGroup[0].Particulars != "Generation Energy Charge" {
+		t.Errorf("Unmarshal() of %s = %+v, %v", data, again, err)
+	}
+
+	// Cells of the wrong type are reported, not a panic
+	bad := `{"particulars": 7, "row-group[0].particulars": "VAT", "row-group[0].sub-row-group[0].rates": "0.53.76", "row-group[99999].rates": "1"}`
+	err = json.Unmarshal([]byte(bad), &table)
+	var cells web.RateTableError
+	if !errors.As(err, &cells) || len(cells) != 3 {
+		t.Fatalf("Unmarshal() error = %v, want 3 cell errors", err)
+	}
+	if !hasFieldError(cells, "Particulars") || !hasFieldError(cells, "VAT / Row 1 Rates") {
+		t.Errorf("Unmarshal() errors = %+v", cells)
+	}
+	for range 10 {
+		var again web.RateTableError
+		if err := json.Unmarshal([]byte(bad), &table); !errors.As(err, &again) || !slices.Equal(again, cells) {
+			t.Fatalf("Unmarshal() errors = %+v, want them in the order %+v", again, cells)
+		}
+	}
+
+	// Exponents and overlong amounts are refused before they are parsed
+	for _, rate := range []string{`"1e6"`, `2E-3`, `"` + strings.Repeat("9", 100) + `"`} {
+		var amount web.RateAmount
+		if err := json.Unmarshal([]byte(rate), &amount); err == nil {
+			t.Errorf("Unmarshal(%s) = %v, want an error", rate, amount)
+		}
+	}
+}
+
+func TestValidateAccountingTable(t *testing.T) {
+	table := web.AccountingRatesTable{
+		Rates: amountOf("0.6388"),
+		AccountingRatesTableRowGroup: []web.AccountingRatesTableRowGroup{
+			{Particulars: "Supply Charges", Rates: amountOf("0.5376"), SubRowGroup: []web.SubRowGroup{
+				{Particulars: "Supply Retail Customer Charge", Rates: amountOf("0.0000")},
+				{Particulars: "Supply System Charge", Rates: amountOf("0.5376")},
+			}},
+			{Particulars: "Lifeline Rate Subsidy", Rates: amountOf("0.1012")},
+		},
+	}
+	if errs := validateAccountingTable(table); len(errs) > 0 {
+		t.Fatalf("validateAccountingTable() errors = %+v", errs)
+	}
+
+	table.AccountingRatesTableRowGroup[0].SubRowGroup[0].Rates = amountOf("-0.0100")
+	table.AccountingRatesTableRowGroup[1].ERC = amountOf("-1")
+	errs := validateAccountingTable(table)
+	for _, label := range []string{
+		"Supply Charges / Supply Retail Customer Charge Rates",
+		"Supply Charges Rates",
+		"Lifeline Rate Subsidy ERC",
+	} {
+		if !hasFieldError(errs, label) {
+			t.Errorf("validateAccountingTable() errors = %+v, want a %q error", errs, label)
+		}
+	}
+}
+
+func TestAccountingTable(t *testing.T) {
+	rate := func(particulars, amount string) billing.Rate {
+		return billing.Rate{Particulars: particulars, Unit: billing.UnitPerKWh, Amount: decimal.RequireFromString(amount)}
+	}
+	billed := &database.RateSchedule{Groups: []billing.RateGroup{
+		{Particulars: "VAT", Rates: []billing.Rate{rate("Generation", "0.6376"), rate("Transmission", "0.1096")}},
+	}}
+	erc := &database.RateSchedule{Groups: []billing.RateGroup{
+		{Particulars: "VAT", Rates: []billing.Rate{rate("Generation", "0.6000"), rate("Distribution", "0.1000")}},
+	}}
+
+	table := accountingTable(database.ConsumerTypeResidential, billed, erc)
+	if table.Particulars != "RESIDENTIAL" || table.Rates.String() != "0.7472" || table.ERC.String() != "0.7000" {
+		t.Errorf("accountingTable() totals = %s, %s", table.Rates, table.ERC)
+	}
+	rows := table.AccountingRatesTableRowGroup[0].SubRowGroup
+	if len(rows) != 3 || rows[1].ERC.Valid || rows[2].Particulars != "Distribution" || rows[2].Rates.Valid {
+		t.Errorf("accountingTable() rows = %+v", rows)
+	}
+
+	empty := accountingTable(database.ConsumerTypeIndustrial, nil, nil)
+	if len(empty.AccountingRatesTableRowGroup) != len(billing.DefaultGroups()) || empty.Rates.Valid {
+		t.Errorf("accountingTable() without schedules = %+v", empty)
+	}
+}
+
+func TestRateChanges(t *testing.T) {
+	rate := func(particulars, amount string) billing.Rate {
+		return billing.Rate{Particulars: particulars, Unit: billing.UnitPerKWh, Amount: decimal.RequireFromString(amount)}
+	}
+	live := &database.RateSchedule{Groups: []billing.RateGroup{
+		{Particulars: "Generation Charges", Rates: []billing.Rate{rate("Generation Energy Charge", "5.6092"), rate("Other Generation Rate Adjustment", "0.0000")}},
+		{Particulars: "Universal Charge", Rates: []billing.Rate{rate("Missionary Electrification", "0.1822")}},
+	}}
+	draft := &database.RateSchedule{Groups: []billing.RateGroup{
+		{Particulars: "Generation Charges", Rates: []billing.Rate{rate("Generation Energy Charge", "5.5000"), rate("Other Generation Rate Adjustment", "0")}},
+		{Particulars: "Universal Charge", Rates: []billing.Rate{rate("Environmental Charge", "0.0025")}},
+	}}
+
+	changes := rateChanges(live, draft)
+	want := []web.RateChange{
+		{Group: "Generation Charges", Particulars: "Generation Energy Charge", Unit: "PhP/kWh", Live: "5.6092", Draft: "5.5000", Change: "-0.1092"},
+		{Group: "Universal Charge", Particulars: "Environmental Charge", Unit: "PhP/kWh", Draft: "0.0025", Change: "added"},
+		{Group: "Universal Charge", Particulars: "Missionary Electrification", Unit: "PhP/kWh", Live: "0.1822", Change: "removed"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("rateChanges() = %+v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("rateChanges()[%d] = %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+
+	if changes := rateChanges(nil, draft); len(changes) != 3 || changes[0].Change != "added" {
+		t.Errorf("rateChanges() without a live schedule = %+v", changes)
+	}
+}
+
+// dbDeps provides a test database to the handlers
+type dbDeps struct {
+	ServerDeps
+	db database.Service
+}
+
+func (d dbDeps) GetLogger() *zap.Logger  { return zap.NewNop() }
+func (d dbDeps) GetDB() database.Service { return d.db }
+
+func TestSubmitRateScheduleRequiresSession(t *testing.T) {
+	author := database.User{ID: primitive.NewObjectID(), Name: "Ana Reyes"}
+	schedules := &databasetest.RateScheduleStore{}
+	route := &V1EmployeeRoute{Deps: dbDeps{db: &databasetest.Service{
+		UserStore:         &databasetest.UserStore{Users: []database.User{author}},
+		RateScheduleStore: schedules,
+	}}}
+	// The update form posts its cells flattened
+	body := `{"date": "2025-02-01", "particulars": "RESIDENTIAL",
+		"row-group[0].particulars": "Generation Charges",
+		"row-group[0].sub-row-group[0].particulars": "Generation Energy Charge",
+		"row-group[0].sub-row-group[0].unit": "PhP/kWh",
+		"row-group[0].sub-row-group[0].rates": "5.6092"}`
+
+	rec := httptest.NewRecorder()
+	route.submitRateSchedule(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), database.RateKindBilled)
+	if rec.Code != http.StatusUnauthorized || len(schedules.Created) != 0 {
+		t.Errorf("draft without a session: status = %d, saved %d, want %d and none saved",
+			rec.Code, len(schedules.Created), http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req = req.WithContext(auth.WithSession(req.Context(), &database.Session{UserID: author.ID}))
+	rec = httptest.NewRecorder()
+	route.submitRateSchedule(rec, req, database.RateKindBilled)
+	if rec.Code != http.StatusOK || len(schedules.Created) != 1 {
+		t.Fatalf("draft with a session: status = %d, saved %d, want it saved", rec.Code, len(schedules.Created))
+	}
+	if draft := schedules.Created[0]; draft.CreatedBy != author.ID || draft.CreatedByName != author.Name || draft.Status != database.RateStatusPending {
+		t.Errorf("saved draft = %+v, want a pending draft by %s", draft, author.Name)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * @file internal/server/routes/receiptpdf.go
+ * @brief receiptpdf.go file prints the official receipt of a payment
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/database"
+	"io"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Layout of the receipt, in millimetres across an A5 page
+const (
+	receiptPageMargin = 12.0
+	receiptLabelWidth = 40.0
+	receiptRowHeight  = 6.0
+)
+
+// writeReceiptPDF prints the official receipt of the payment
+func writeReceiptPDF(w io.Writer, payment *database.Payment) error {
+	pdf := gofpdf.New("P", "mm", "A5", "")
+	pdf.SetMargins(receiptPageMargin, receiptPageMargin, receiptPageMargin)
+	pdf.SetAutoPageBreak(true, receiptPageMargin)
+	pdf.SetTitle("Official Receipt "+payment.ReceiptNumber, true)
+	pdf.SetCreator("BATELEC I", true)
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, _ := pdf.GetPageSize()
+	width := pageWidth - 2*receiptPageMargin
+
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(width, 6, "BATANGAS I ELECTRIC COOPERATIVE, INC.", "", 1, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.CellFormat(width, 4, "Calaca, Batangas", "", 1, "C", false, 0, "")
+	pdf.Ln(3)
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(width/2, 7, "OFFICIAL RECEIPT", "", 0, "L", false, 0, "")
+	pdf.SetTextColor(185, 28, 28)
+	pdf.CellFormat(width/2, 7, "No. "+payment.ReceiptNumber, "", 1, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(2)
+
+	row := func(label, value string) {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(receiptLabelWidth, receiptRowHeight, label, "B", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(width-receiptLabelWidth, receiptRowHeight, tr(value), "B", 1, "L", false, 0, "")
+	}
+	received := payment.ReceivedAt.In(database.RollupLocation)
+	row("Date", received.Format(billDateLayout)+" "+received.Format(receiptTimeLayout))
+	row("Received from", payment.PayorName)
+	row("Account No.", payment.AccountNumber)
+	method := web.PaymentMethodLabel(payment.Method)
+	if payment.Reference != "" {
+		method += " (" + payment.Reference + ")"
+	}
+	row("Payment", method)
+	pdf.Ln(3)
+
+	pdf.SetFillColor(229, 231, 235)
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.CellFormat(width-35, receiptRowHeight, "Applied to", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(35, receiptRowHeight, "Amount", "1", 1, "R", true, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	line := func(label, amount string) {
+		pdf.CellFormat(width-35, receiptRowHeight, label, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(35, receiptRowHeight, amount, "1", 1, "R", false, 0, "")
+	}
+	if payment.Charges.IsPositive() {
+		line("Surcharges and other charges", payment.Charges.StringFixed(2))
+	}
+	for _, allocation := range payment.Allocations {
+		line("Bill "+allocation.BillNumber, allocation.Amount.StringFixed(2))
+	}
+	if payment.CreditApplied.IsPositive() {
+		line("Less earlier credit used", "("+payment.CreditApplied.StringFixed(2)+")")
+	}
+	if payment.Credited.IsPositive() {
+		line("Advance payment kept as credit", payment.Credited.StringFixed(2))
+	}
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(width-35, 8, "AMOUNT RECEIVED", "1", 0, "L", false, 0, "")
+	pdf.CellFormat(35, 8, "PhP "+payment.Amount.StringFixed(2), "1", 1, "R", false, 0, "")
+	pdf.Ln(10)
+
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(width/2, 5, "", "", 0, "L", false, 0, "")
+	pdf.CellFormat(width/2, 5, tr(payment.CashierName), "B", 1, "C", false, 0, "")
+	pdf.CellFormat(width/2, 5, "", "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.CellFormat(width/2, 4, "Cashier", "", 1, "C", false, 0, "")
+
+	return pdf.Output(w)
+}
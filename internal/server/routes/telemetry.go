@@ -0,0 +1,85 @@
+/*
+ * @file internal/server/routes/telemetry.go
+ * @brief telemetry.go file streams meter status changes and latest readings to the dashboards over a WebSocket
+ */
+package routes
+
+import (
+	"SmartMeterSystem/internal/telemetry"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+const (
+	// telemetryBuffer is how many events a dashboard may fall behind before
+	// its stream is closed and it must reload the meter list
+	telemetryBuffer = 64
+	// telemetryPingInterval is how often the stream is pinged so dead
+	// dashboards are noticed and proxies keep the socket open
+	telemetryPingInterval = 30 * time.Second
+	// telemetryWriteTimeout bounds one write or ping to a dashboard
+	telemetryWriteTimeout = 10 * time.Second
+)
+
+// telemetryStream upgrades the request to a WebSocket and writes every
+// telemetry.Event published from then on as a JSON text message. The stream
+// is closed with StatusTryAgainLater when the dashboard falls behind or the
+// server shuts down; the dashboard reloads the meter list and reconnects.
+func (c *V1EmployeeRoute) telemetryStream(w http.ResponseWriter, r *http.Request) {
+	// The server timeouts bound requests, not a socket kept open for hours
+	controller := http.NewResponseController(w)
+	if err := controller.SetReadDeadline(time.Time{}); err != nil {
+		c.Deps.GetLogger().Sugar().Warnf("Telemetry read deadline not cleared: %v", err)
+	}
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		c.Deps.GetLogger().Sugar().Warnf("Telemetry write deadline not cleared: %v", err)
+	}
+
+	// Accept rejects cross-origin requests and writes the error response
+	socket, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Warnf("Telemetry upgrade error: %v", err)
+		return
+	}
+	defer socket.CloseNow()
+
+	// Dashboards only listen; CloseRead handles their pings and close frames
+	ctx := socket.CloseRead(r.Context())
+	subscription := c.Deps.GetTelemetry().Subscribe(telemetryBuffer)
+	defer subscription.Close()
+
+	ping := time.NewTicker(telemetryPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.Events():
+			if !ok {
+				socket.Close(websocket.StatusTryAgainLater, "telemetry stream ended, reload and reconnect")
+				return
+			}
+			if err := c.writeTelemetry(ctx, socket, event); err != nil {
+				return
+			}
+		case <-ping.C:
+			pingCtx, cancel := context.WithTimeout(ctx, telemetryWriteTimeout)
+			err := socket.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeTelemetry writes one event to the dashboard socket
+func (c *V1EmployeeRoute) writeTelemetry(ctx context.Context, socket *websocket.Conn, event telemetry.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, telemetryWriteTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, socket, event)
+}
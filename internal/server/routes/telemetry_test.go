@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"SmartMeterSystem/internal/telemetry"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"go.uber.org/zap"
+)
+
+// telemetryDeps provides the dependencies telemetryStream uses
+type telemetryDeps struct {
+	ServerDeps
+	hub *telemetry.Hub
+}
+
+func (d telemetryDeps) GetLogger() *zap.Logger       { return zap.NewNop() }
+func (d telemetryDeps) GetTelemetry() *telemetry.Hub { return d.hub }
+
+func TestTelemetryStream(t *testing.T) {
+	hub := telemetry.NewHub()
+	route := &V1EmployeeRoute{Deps: telemetryDeps{hub: hub}}
+	server := httptest.NewServer(http.HandlerFunc(route.telemetryStream))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	socket, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer socket.CloseNow()
+
+	for hub.Subscribers() == 0 {
+		if ctx.Err() != nil {
+			t.Fatal("stream never subscribed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	hub.Publish(telemetry.Event{Type: telemetry.EventStatus, Serial: "SM-0001", Status: "inactive"})
+
+	var event telemetry.Event
+	if err := wsjson.Read(ctx, socket, &event); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if event.Type != telemetry.EventStatus || event.Serial != "SM-0001" || event.Status != "inactive" {
+		t.Errorf("Read() = %+v", event)
+	}
+
+	hub.Close()
+	if _, _, err := socket.Read(ctx); websocket.CloseStatus(err) != websocket.StatusTryAgainLater {
+		t.Errorf("Read() after the hub closed error = %v, want StatusTryAgainLater", err)
+	}
+}
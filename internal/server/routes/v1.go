@@ -6,12 +6,13 @@ package routes
 
 import (
 	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/database"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
-	"time"
 )
 
 // V1 Route Groups
@@ -44,6 +45,8 @@ func (r *V1Routes) V1Handler() http.Handler {
 
 	// Register consumer routes
 	mux.Handle("/consumer/", http.StripPrefix("/consumer", r.Consumer.HandleV1()))
+	// Register meter routes
+	mux.Handle("/meter/", http.StripPrefix("/meter", r.Meter.HandleV1()))
 	// Register employee routes
 	mux.Handle("/employee/", http.StripPrefix("/employee", r.Employee.HandleV1()))
 	return mux
@@ -59,11 +62,21 @@ func (c *V1ConsumerRoute) HandleV1() http.Handler {
 	})
 
 	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			// Inside your handler function
+			userType := r.URL.Query().Get("user_type")
 
-		// Inside your handler function
-		userType := r.URL.Query().Get("user_type")
-
-		web.LoginWebPage(c.Deps.GetDefaultRouteVersion(), userType).Render(r.Context(), w)
+			web.LoginWebPage(c.Deps.GetDefaultRouteVersion(), userType).Render(r.Context(), w)
+		case "POST":
+			if _, ok := loginUser(c.Deps, "consumer", w, r); !ok {
+				return
+			}
+			w.Header().Set("HX-Redirect", "/"+c.Deps.GetDefaultRouteVersion()+"/consumer/dashboard")
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
 	})
 
 	mux.HandleFunc("/dashboard", func(w http.ResponseWriter, r *http.Request) {
@@ -71,6 +84,14 @@ func (c *V1ConsumerRoute) HandleV1() http.Handler {
 		web.ConsumerDashboardWebPage().Render(r.Context(), w)
 	})
 
+	mux.HandleFunc("/billing", func(w http.ResponseWriter, r *http.Request) {
+		c.billingPage(w, r)
+	})
+
+	mux.HandleFunc("/billing/", func(w http.ResponseWriter, r *http.Request) {
+		c.billPDF(w, r)
+	})
+
 	return mux
 }
 
@@ -88,7 +109,18 @@ func (c *V1EmployeeRoute) HandleV1() http.Handler {
 			userType := r.URL.Query().Get("user_type")
 			web.LoginWebPage(c.Deps.GetDefaultRouteVersion(), userType).Render(r.Context(), w)
 		case "POST":
-			w.Header().Set("HX-Redirect", "/v1/employee/sysadmin/dashboard") // REMINDER: Make the redirect Dynamic
+			user, ok := loginUser(c.Deps, "employee", w, r)
+			if !ok {
+				return
+			}
+			consoleURL, ok := c.Deps.GetConsoleURL(user.Role)
+			if !ok {
+				c.Deps.GetLogger().Sugar().Errorf("No console for role %q of %s", user.Role, user.Email)
+				c.Deps.GetSessions().Destroy(w, r)
+				renderLoginError(w, r, http.StatusOK, "Your account has no console assigned")
+				return
+			}
+			w.Header().Set("HX-Redirect", consoleURL)
 			w.WriteHeader(http.StatusOK)
 		default:
 			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
@@ -116,6 +148,16 @@ func (c *V1EmployeeRoute) HandleV1() http.Handler {
 		}
 		logout http.HandlerFunc
 	}{
+		logout: func(w http.ResponseWriter, r *http.Request) {
+			if err := c.Deps.GetSessions().Destroy(w, r); err != nil {
+				c.Deps.GetLogger().Sugar().Errorf("Logout error: %v", err)
+				http.Error(w, "Logout failed", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("HX-Redirect", "/home")
+			w.WriteHeader(http.StatusOK)
+		},
 		dashboard: struct {
 			dashboard   http.HandlerFunc
 			information http.HandlerFunc
@@ -123,54 +165,45 @@ func (c *V1EmployeeRoute) HandleV1() http.Handler {
 			dashboard: func(w http.ResponseWriter, r *http.Request) {
 				switch r.Method {
 				case "GET":
-					web.SystemAdminEmployeeDashboardWebPage().Render(r.Context(), w)
+					web.SystemAdminEmployeeDashboardWebPage(consoleOf(r)).Render(r.Context(), w)
 				default:
 					http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 				}
 			},
 			information: func(w http.ResponseWriter, r *http.Request) {
-				// Extract the part after "/sysadmin/consumer/"
-				pathPart := strings.TrimPrefix(r.URL.Path, "/sysadmin/dashboard/")
-				// Split to handle nested paths, take the first segment
-				formType := strings.SplitN(pathPart, "/", 2)[0]
+				// Take the first segment after "/<console>/dashboard/"
+				formType := pageSegment(r.URL.Path, "dashboard")
 
 				switch r.Method {
 				case "GET":
 					switch formType {
 					case "meter-list":
-						smartmeters := []web.SmartMeter{
-							{
-								ID:        "SM001",
-								Name:      "Smart Meter 1",
-								Location:  "Calatagan",
-								Latitude:  13.838432,
-								Longitude: 120.632360,
-								Status:    "active",
-							},
-							{
-								ID:        "SM002",
-								Name:      "Smart Meter 2",
-								Location:  "Calatagan",
-								Latitude:  13.839147,
-								Longitude: 120.632257,
-								Status:    "active",
-							},
-							{
-								ID:        "SM003",
-								Name:      "Meter 3",
-								Location:  "Calatagan",
-								Latitude:  13.838002,
-								Longitude: 120.632220,
-								Status:    "inactive",
-							},
-							{
-								ID:        "SM002",
-								Name:      "Meter 4",
-								Location:  "Calatagan",
-								Latitude:  13.837288,
-								Longitude: 120.632164,
-								Status:    "inactive",
-							},
+						meters, err := c.Deps.GetDB().Meters().List(r.Context(), database.MeterFilter{
+							Statuses: []string{database.MeterStatusActive, database.MeterStatusInactive},
+						})
+						if err != nil {
+							c.Deps.GetLogger().Sugar().Errorf("Meter list error: %v", err)
+							http.Error(w, "Error loading meters", http.StatusInternalServerError)
+							return
+						}
+
+						smartmeters := make([]web.SmartMeter, 0, len(meters))
+						for _, meter := range meters {
+							name := meter.Name
+							if name == "" {
+								name = meter.SerialNumber
+							}
+							smartmeters = append(smartmeters, web.SmartMeter{
+								ID:           meter.SerialNumber,
+								Name:         name,
+								Location:     meter.Location,
+								Latitude:     meter.Latitude,
+								Longitude:    meter.Longitude,
+								Status:       meter.Status,
+								Connectivity: meter.Connectivity,
+								LastSeen:     formatSeenAt(meter.LastSeenAt),
+								Disconnected: meter.Disconnected,
+							})
 						}
 						w.Header().Set("Content-Type", "application/json")
 						if err := json.NewEncoder(w).Encode(smartmeters); err != nil {
@@ -178,9 +211,32 @@ func (c *V1EmployeeRoute) HandleV1() http.Handler {
 							fmt.Println("Error:", err)
 						}
 
+					case "telemetry":
+						c.telemetryStream(w, r)
+					case "outages":
+						c.outageList(w, r)
+					case "alerts":
+						c.alertList(w, r)
+					case "commands":
+						c.commandList(w, r)
 					default:
 						http.Error(w, "Not Found", http.StatusNotFound)
 					}
+				case "POST":
+					switch formType {
+					case "acknowledge-alert":
+						c.acknowledgeAlert(w, r, pageArgument(r.URL.Path, "dashboard", formType))
+					case "resolve-alert":
+						c.resolveAlert(w, r, pageArgument(r.URL.Path, "dashboard", formType))
+					case "queue-command":
+						c.queueCommand(w, r)
+					case "cancel-command":
+						c.cancelCommand(w, r, pageArgument(r.URL.Path, "dashboard", formType))
+					default:
+						http.NotFound(w, r)
+					}
+				default:
+					http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 				}
 			},
 		},
@@ -191,61 +247,60 @@ func (c *V1EmployeeRoute) HandleV1() http.Handler {
 			consumer: func(w http.ResponseWriter, r *http.Request) {
 				switch r.Method {
 				case "GET":
-					web.SystemAdminEmployeeConsumerWebPage(
-						[]web.ConsumerList{
-							{
-								ConsumerID:   "C001",
-								ConsumerName: "John Doe",
-								ConsumerType: web.ConsumerAccountTypeData.Residential,
-								Status:       web.ConsumerAccountStatusData.Active,
-							},
-							{
-								ConsumerID:   "C002",
-								ConsumerName: "John Deer",
-								ConsumerType: web.ConsumerAccountTypeData.Residential,
-								Status:       web.ConsumerAccountStatusData.Inactive,
-							},
-						},
-					).Render(r.Context(), w)
+					consumers, err := c.consumerList(r)
+					if err != nil {
+						c.Deps.GetLogger().Sugar().Errorf("Consumer list error: %v", err)
+						http.Error(w, "Error loading consumers", http.StatusInternalServerError)
+						return
+					}
+					web.SystemAdminEmployeeConsumerWebPage(consoleOf(r), consumers).Render(r.Context(), w)
 				default:
 					http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 				}
 			},
 			information: func(w http.ResponseWriter, r *http.Request) {
-				// Extract the part after "/sysadmin/consumer/"
-				pathPart := strings.TrimPrefix(r.URL.Path, "/sysadmin/consumer/")
-				// Split to handle nested paths, take the first segment
-				formType := strings.SplitN(pathPart, "/", 2)[0]
+				// Take the first segment after "/<console>/consumer/"
+				formType := pageSegment(r.URL.Path, "consumer")
 
 				switch r.Method {
 				case "GET":
 					switch formType {
 					case "consumer-list":
-						web.ConsumerListContainer(
-							[]web.ConsumerList{
-								{
-									ConsumerID:   "C001",
-									ConsumerName: "John Doe",
-									ConsumerType: web.ConsumerAccountTypeData.Residential,
-									Status:       web.ConsumerAccountStatusData.Active,
-								},
-								{
-									ConsumerID:   "C002",
-									ConsumerName: "John Deer",
-									ConsumerType: web.ConsumerAccountTypeData.Residential,
-									Status:       web.ConsumerAccountStatusData.Inactive,
-								},
-							},
-						).Render(r.Context(), w)
+						consumers, err := c.consumerList(r)
+						if err != nil {
+							c.Deps.GetLogger().Sugar().Errorf("Consumer list error: %v", err)
+							http.Error(w, "Error loading consumers", http.StatusInternalServerError)
+							return
+						}
+						web.ConsumerListContainer(consumers).Render(r.Context(), w)
 					case "consumer-info":
-						web.ConsumerInformationContainer().Render(r.Context(), w)
-					// In your handler for "consumer-chart"
+						info, err := c.consumerInformation(r, pageArgument(r.URL.Path, "consumer", formType))
+						if errors.Is(err, database.ErrNotFound) {
+							http.NotFound(w, r)
+							return
+						}
+						if err != nil {
+							c.Deps.GetLogger().Sugar().Errorf("Consumer information error: %v", err)
+							http.Error(w, "Error loading consumer", http.StatusInternalServerError)
+							return
+						}
+						web.ConsumerInformationContainer(info).Render(r.Context(), w)
 					case "consumer-chart":
-						w.Header().Set("Content-Type", "text/html")
-
-						// Lopgic Here
-
+						c.consumerChart(w, r, pageArgument(r.URL.Path, "consumer", formType))
+					case "consumer-ledger":
+						c.consumerLedger(w, r, pageArgument(r.URL.Path, "consumer", formType))
+					default:
+						http.NotFound(w, r)
 					}
+				case "POST":
+					switch formType {
+					case "ledger-entry":
+						c.postLedgerEntry(w, r, pageArgument(r.URL.Path, "consumer", formType))
+					default:
+						http.NotFound(w, r)
+					}
+				default:
+					http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 				}
 			},
 		},
@@ -256,16 +311,20 @@ func (c *V1EmployeeRoute) HandleV1() http.Handler {
 			accounts: func(w http.ResponseWriter, r *http.Request) {
 				switch r.Method {
 				case "GET":
-					web.SystemAdminEmployeeAccountsWebPage().Render(r.Context(), w)
+					web.SystemAdminEmployeeAccountsWebPage(consoleOf(r)).Render(r.Context(), w)
 				default:
 					http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 				}
 			},
 			forms: func(w http.ResponseWriter, r *http.Request) {
-				// Extract the part after "/sysadmin/accounts/"
-				pathPart := strings.TrimPrefix(r.URL.Path, "/sysadmin/accounts/")
-				// Split to handle nested paths, take the first segment
-				formType := strings.SplitN(pathPart, "/", 2)[0]
+				// Take the first segment after "/<console>/accounts/"
+				formType := pageSegment(r.URL.Path, "accounts")
+
+				// Only open the forms the console is allowed to create
+				if !consoleOf(r).HasAccountForm(strings.TrimSuffix(formType, "-form")) {
+					http.NotFound(w, r)
+					return
+				}
 
 				switch r.Method {
 				case "GET":
@@ -273,12 +332,23 @@ func (c *V1EmployeeRoute) HandleV1() http.Handler {
 					case "meter-form":
 						web.NewMeterAccountForm().Render(r.Context(), w)
 					case "consumer-form":
-						web.NewConsumerAccountForm().Render(r.Context(), w)
+						web.NewConsumerAccountForm(billing.BookCodes()).Render(r.Context(), w)
 					case "employee-form":
 						web.NewEmployeeAccountForm().Render(r.Context(), w)
 					default:
 						http.NotFound(w, r)
 					}
+				case "POST":
+					switch formType {
+					case "meter":
+						c.createMeterAccount(w, r)
+					case "consumer":
+						c.createConsumerAccount(w, r)
+					case "employee":
+						c.createEmployeeAccount(w, r)
+					default:
+						http.NotFound(w, r)
+					}
 				default:
 					http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 				}
@@ -291,495 +361,43 @@ func (c *V1EmployeeRoute) HandleV1() http.Handler {
 			accounting: func(w http.ResponseWriter, r *http.Request) {
 				switch r.Method {
 				case "GET":
-					// web.SystemAdminEmployeeAccountingWebPage().Render(r.Context(), w)
-					web.SystemAdminEmployeeAccountingWebPage(
-						web.AccountingRatesTableFormType.Display,
-						web.AccountingRatesTable{
-							Date:        "01/01/01",
-							Particulars: "RESIDENTIAL",
-							Rates:       "",
-							ERC:         "9.9298",
-							AccountingRatesTableRowGroup: []web.AccountingRatesTableRowGroup{
-								// Generation Charges
-								{
-									Particulars: "Generation Charges",
-									Unit:        "",
-									Rates:       "5.6092",
-									ERC:         "5.6092",
-									SubRowGroup: []web.SubRowGroup{
-										{
-											Particulars: "Generation Energy Charge",
-											Unit:        "PhP/kWh",
-											Rates:       "5.6092",
-											ERC:         "5.6092",
-										},
-										{
-											Particulars: "Other Generation Rate Adjustment",
-											Unit:        "PhP/kWh",
-											Rates:       "0.0000",
-											ERC:         "0.0000",
-										},
-									},
-								},
-								// Transmission Charges
-								{
-									Particulars: "Transmission Charges (NCCP)",
-									Unit:        "",
-									Rates:       "0.6853",
-									ERC:         "0.6853",
-									SubRowGroup: []web.SubRowGroup{
-										{
-											Particulars: "Transmission Demand Charge",
-											Unit:        "PhP/kW",
-											Rates:       "0.0000",
-											ERC:         "0.0000",
-										},
-										{
-											Particulars: "Transmission System Charge",
-											Unit:        "PhP/kWh",
-											Rates:       "0.6853",
-											ERC:         "0.6853",
-										},
-									},
-								},
-								// System Loss Charge
-								{
-									Particulars: "System Loss Charge",
-									Unit:        "",
-									Rates:       "0.9344",
-									ERC:         "0.9344",
-									SubRowGroup: []web.SubRowGroup{
-										{
-											Particulars: "System Loss Charge",
-											Unit:        "PhP/kWh",
-											Rates:       "0.9344",
-											ERC:         "0.9344",
-										},
-									},
-								},
-								// Continue with other sections following the same pattern
-								// Distribution Charges
-								{
-									Particulars: "Distribution Charges",
-									Unit:        "",
-									Rates:       "0.4613",
-									ERC:         "0.4613",
-									SubRowGroup: []web.SubRowGroup{
-										{
-											Particulars: "Distribution Demand Charge",
-											Unit:        "PhP/kW",
-											Rates:       "0.0000",
-											ERC:         "0.0000",
-										},
-										{
-											Particulars: "Distribution System Charge",
-											Unit:        "PhP/kWh",
-											Rates:       "0.4613",
-											ERC:         "0.4613",
-										},
-									},
-								},
-								// Supply Charges
-								{
-									Particulars: "Supply Charges",
-									Unit:        "",
-									Rates:       "0.5376",
-									ERC:         "0.5376",
-									SubRowGroup: []web.SubRowGroup{
-										{
-											Particulars: "Supply Retail Customer Charge",
-											Unit:        "PhP/Cust/Mo",
-											Rates:       "0.0000",
-											ERC:         "0.0000",
-										},
-										{
-											Particulars: "Supply System Charge",
-											Unit:        "PhP/kWh",
-											Rates:       "0.5376",
-											ERC:         "0.5376",
-										},
-									},
-								},
-								// Add remaining sections following the same structure...
-								// Example for VAT section:
-								{
-									Particulars: "VAT",
-									Unit:        "",
-									Rates:       "1.0943",
-									ERC:         "0.8543",
-									SubRowGroup: []web.SubRowGroup{
-										{
-											Particulars: "Generation",
-											Unit:        "PhP/kWh",
-											Rates:       "0.6376",
-											ERC:         "0.6376",
-										},
-										{
-											Particulars: "Transmission",
-											Unit:        "PhP/kWh",
-											Rates:       "0.1096",
-											ERC:         "0.1096",
-										},
-										// Add other VAT components...
-									},
-								},
-								// Universal Charge
-								{
-									Particulars: "Universal Charge",
-									Unit:        "",
-									Rates:       "0.2250",
-									ERC:         "0.2250",
-									SubRowGroup: []web.SubRowGroup{
-										{
-											Particulars: "Missionary Electrification",
-											Unit:        "PhP/kWh",
-											Rates:       "0.1822",
-											ERC:         "0.1822",
-										},
-										// Add other universal charge components...
-									},
-								},
-							},
-						},
-					).Render(r.Context(), w)
+					c.accountingPage(w, r)
 				default:
 					http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 				}
 			},
 			rates: func(w http.ResponseWriter, r *http.Request) {
-				// Extract the part after "/sysadmin/accounting/"
-				pathPart := strings.TrimPrefix(r.URL.Path, "/sysadmin/accounting/")
-				// Split to handle nested paths, take the first segment
-				formType := strings.SplitN(pathPart, "/", 2)[0]
+				// Take the first segment after "/<console>/accounting/"
+				formType := pageSegment(r.URL.Path, "accounting")
 
 				switch r.Method {
 				case "GET":
 					switch formType {
 					case "update-rates-form":
-						web.SystemAdminEmployeeAccountingTable(
-							web.AccountingRatesTableFormType.FormRates,
-							web.AccountingRatesTable{
-								Date:        "01/01/01",
-								Particulars: "RESIDENTIAL",
-								Rates:       "",
-								AccountingRatesTableRowGroup: []web.AccountingRatesTableRowGroup{
-									// Generation Charges
-									{
-										Particulars: "Generation Charges",
-										Unit:        "",
-										Rates:       "5.6092",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Generation Energy Charge",
-												Unit:        "PhP/kWh",
-												Rates:       "5.6092",
-											},
-											{
-												Particulars: "Other Generation Rate Adjustment",
-												Unit:        "PhP/kWh",
-												Rates:       "0.0000",
-											},
-										},
-									},
-									// Transmission Charges
-									{
-										Particulars: "Transmission Charges (NCCP)",
-										Unit:        "",
-										Rates:       "0.6853",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Transmission Demand Charge",
-												Unit:        "PhP/kW",
-												Rates:       "0.0000",
-											},
-											{
-												Particulars: "Transmission System Charge",
-												Unit:        "PhP/kWh",
-												Rates:       "0.6853",
-											},
-										},
-									},
-									// System Loss Charge
-									{
-										Particulars: "System Loss Charge",
-										Unit:        "",
-										Rates:       "0.9344",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "System Loss Charge",
-												Unit:        "PhP/kWh",
-												Rates:       "0.9344",
-											},
-										},
-									},
-									// Continue with other sections following the same pattern
-									// Distribution Charges
-									{
-										Particulars: "Distribution Charges",
-										Unit:        "",
-										Rates:       "0.4613",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Distribution Demand Charge",
-												Unit:        "PhP/kW",
-												Rates:       "0.0000",
-											},
-											{
-												Particulars: "Distribution System Charge",
-												Unit:        "PhP/kWh",
-												Rates:       "0.4613",
-											},
-										},
-									},
-									// Supply Charges
-									{
-										Particulars: "Supply Charges",
-										Unit:        "",
-										Rates:       "0.5376",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Supply Retail Customer Charge",
-												Unit:        "PhP/Cust/Mo",
-												Rates:       "0.0000",
-											},
-											{
-												Particulars: "Supply System Charge",
-												Unit:        "PhP/kWh",
-												Rates:       "0.5376",
-											},
-										},
-									},
-									// Add remaining sections following the same structure...
-									// Example for VAT section:
-									{
-										Particulars: "VAT",
-										Unit:        "",
-										Rates:       "1.0943",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Generation",
-												Unit:        "PhP/kWh",
-												Rates:       "0.6376",
-											},
-											{
-												Particulars: "Transmission",
-												Unit:        "PhP/kWh",
-												Rates:       "0.1096",
-											},
-											// Add other VAT components...
-										},
-									},
-									// Universal Charge
-									{
-										Particulars: "Universal Charge",
-										Unit:        "",
-										Rates:       "0.2250",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Missionary Electrification",
-												Unit:        "PhP/kWh",
-												Rates:       "0.1822",
-											},
-											// Add other universal charge components...
-										},
-									},
-								},
-							},
-						).Render(r.Context(), w)
+						c.rateForm(w, r, web.AccountingRatesTableFormType.FormRates)
 					case "update-erc-form":
-						web.SystemAdminEmployeeAccountingTable(
-							web.AccountingRatesTableFormType.FormERC,
-							web.AccountingRatesTable{
-								Date:        "01/01/01",
-								Particulars: "RESIDENTIAL",
-								ERC:         "9.9298",
-								AccountingRatesTableRowGroup: []web.AccountingRatesTableRowGroup{
-									// Generation Charges
-									{
-										Particulars: "Generation Charges",
-										Unit:        "",
-										ERC:         "5.6092",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Generation Energy Charge",
-												Unit:        "PhP/kWh",
-												ERC:         "5.6092",
-											},
-											{
-												Particulars: "Other Generation Rate Adjustment",
-												Unit:        "PhP/kWh",
-												ERC:         "0.0000",
-											},
-										},
-									},
-									// Transmission Charges
-									{
-										Particulars: "Transmission Charges (NCCP)",
-										Unit:        "",
-										ERC:         "0.6853",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Transmission Demand Charge",
-												Unit:        "PhP/kW",
-												ERC:         "0.0000",
-											},
-											{
-												Particulars: "Transmission System Charge",
-												Unit:        "PhP/kWh",
-												ERC:         "0.6853",
-											},
-										},
-									},
-									// System Loss Charge
-									{
-										Particulars: "System Loss Charge",
-										Unit:        "",
-										ERC:         "0.9344",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "System Loss Charge",
-												Unit:        "PhP/kWh",
-												ERC:         "0.9344",
-											},
-										},
-									},
-									// Continue with other sections following the same pattern
-									// Distribution Charges
-									{
-										Particulars: "Distribution Charges",
-										Unit:        "",
-										ERC:         "0.4613",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Distribution Demand Charge",
-												Unit:        "PhP/kW",
-												ERC:         "0.0000",
-											},
-											{
-												Particulars: "Distribution System Charge",
-												Unit:        "PhP/kWh",
-												ERC:         "0.4613",
-											},
-										},
-									},
-									// Supply Charges
-									{
-										Particulars: "Supply Charges",
-										Unit:        "",
-										ERC:         "0.5376",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Supply Retail Customer Charge",
-												Unit:        "PhP/Cust/Mo",
-												ERC:         "0.0000",
-											},
-											{
-												Particulars: "Supply System Charge",
-												Unit:        "PhP/kWh",
-												ERC:         "0.5376",
-											},
-										},
-									},
-									// Add remaining sections following the same structure...
-									// Example for VAT section:
-									{
-										Particulars: "VAT",
-										Unit:        "",
-										ERC:         "0.8543",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Generation",
-												Unit:        "PhP/kWh",
-												ERC:         "0.6376",
-											},
-											{
-												Particulars: "Transmission",
-												Unit:        "PhP/kWh",
-												ERC:         "0.1096",
-											},
-											// Add other VAT components...
-										},
-									},
-									// Universal Charge
-									{
-										Particulars: "Universal Charge",
-										Unit:        "",
-										ERC:         "0.2250",
-										SubRowGroup: []web.SubRowGroup{
-											{
-												Particulars: "Missionary Electrification",
-												Unit:        "PhP/kWh",
-												ERC:         "0.1822",
-											},
-											// Add other universal charge components...
-										},
-									},
-								},
-							},
-						).Render(r.Context(), w)
+						c.rateForm(w, r, web.AccountingRatesTableFormType.FormERC)
+					case "variance-report":
+						c.rateVariance(w, r)
+					case "variance-report.csv":
+						c.rateVarianceCSV(w, r)
+					case "export-rates.csv":
+						c.exportRateTable(w, r, "csv")
+					case "export-rates.json":
+						c.exportRateTable(w, r, "json")
 					default:
 						http.NotFound(w, r)
 					}
 				case "POST":
 					switch formType {
 					case "submit-update-rates-form":
-						defer func() {
-							if r := recover(); r != nil {
-								http.Error(w, fmt.Sprintf("Internal server error: %v", r), http.StatusInternalServerError)
-								log.Printf("Panic recovered: %v", r)
-							}
-						}()
-
-						if r.Method != http.MethodPost {
-							http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-							return
-						}
-
-						var payload web.AccountingRatesTable
-						if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-							c.Deps.GetLogger().Sugar().Errorf("Decode error: %v", err)
-							http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
-							return
-						}
-
-						// Process your data here...
-						c.Deps.GetLogger().Sugar().Infof("Received valid payload: %+v", payload)
-
-						// REMINDER: process submit-update-rates-form request here
-						// w.Header().Set("Content-Type", "application/json")
-						// if err := json.NewEncoder(w).Encode(payload); err != nil {
-						// 	http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-						// }
-
-						// Process data here
-						time.Sleep(1 * time.Second)
-						w.WriteHeader(http.StatusOK)
-						w.Write([]byte("Success"))
+						c.submitRateSchedule(w, r, database.RateKindBilled)
 					case "submit-update-erc-form":
-						if r.Method != http.MethodPost {
-							http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-							return
-						}
-
-						var payload web.AccountingRatesTable
-						if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-							c.Deps.GetLogger().Sugar().Errorf("Decode error: %v", err)
-							http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
-							return
-						}
-
-						// Process your data here...
-						c.Deps.GetLogger().Sugar().Infof("Received valid payload: %+v", payload)
-
-						// REMINDER: process submit-update-erc-form request here
-						// w.Header().Set("Content-Type", "application/json")
-						// if err := json.NewEncoder(w).Encode(payload); err != nil {
-						// 	http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-						// }
-
-						time.Sleep(1 * time.Second)
-						w.WriteHeader(http.StatusOK)
-						w.Write([]byte("Success"))
+						c.submitRateSchedule(w, r, database.RateKindERC)
+					case "import-rates":
+						c.importRateSchedule(w, r)
+					case "review-rates":
+						c.reviewRateSchedule(w, r, pageArgument(r.URL.Path, "accounting", "review-rates"))
 					default:
 						http.NotFound(w, r)
 					}
@@ -789,12 +407,10 @@ func (c *V1EmployeeRoute) HandleV1() http.Handler {
 			},
 		},
 	}
-	// System Admin Logout Route
-	mux.HandleFunc("/sysadmin/logout", func(w http.ResponseWriter, r *http.Request) {
-
-		w.Header().Set("HX-Redirect", "/home")
-		w.WriteHeader(http.StatusOK)
-	})
+	// Logout Routes, one per console
+	for _, console := range web.EmployeeConsoles {
+		mux.HandleFunc("/"+console.Name+"/logout", sysadminRouteStruct.logout)
+	}
 
 	// System Admin Dashboard Routes
 	mux.HandleFunc("/sysadmin/dashboard", sysadminRouteStruct.dashboard.dashboard)
@@ -809,5 +425,169 @@ func (c *V1EmployeeRoute) HandleV1() http.Handler {
 	mux.HandleFunc("/sysadmin/accounting", sysadminRouteStruct.accounting.accounting)
 	mux.HandleFunc("/sysadmin/accounting/", sysadminRouteStruct.accounting.rates)
 
+	// Role consoles share the system admin handlers for the pages they expose;
+	// the handlers render with the console of the request path
+	// Cashier Routes
+	mux.HandleFunc("/cashier/dashboard", c.consoleHome)
+	mux.HandleFunc("/cashier/payments", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			c.paymentsPage(w, r)
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/cashier/payments/", func(w http.ResponseWriter, r *http.Request) {
+		// Take the first segment after "/cashier/payments/"
+		formType := pageSegment(r.URL.Path, "payments")
+
+		switch r.Method {
+		case "GET":
+			switch formType {
+			case "account":
+				c.paymentAccount(w, r)
+			case "receipt":
+				c.receiptPDF(w, r)
+			default:
+				http.NotFound(w, r)
+			}
+		case "POST":
+			switch formType {
+			case "post-payment":
+				c.postPayment(w, r)
+			default:
+				http.NotFound(w, r)
+			}
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/cashier/shift-report", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			c.shiftReport(w, r)
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+	})
+	// Field Admin Routes
+	mux.HandleFunc("/field/dashboard", sysadminRouteStruct.dashboard.dashboard)
+	mux.HandleFunc("/field/dashboard/", sysadminRouteStruct.dashboard.information)
+	mux.HandleFunc("/field/accounts", sysadminRouteStruct.accounts.accounts)
+	mux.HandleFunc("/field/accounts/", sysadminRouteStruct.accounts.forms)
+	// Finance Admin Routes
+	mux.HandleFunc("/finance/dashboard", c.consoleHome)
+	mux.HandleFunc("/finance/accounting", sysadminRouteStruct.accounting.accounting)
+	mux.HandleFunc("/finance/accounting/", sysadminRouteStruct.accounting.rates)
+	// HR Admin Routes
+	mux.HandleFunc("/hr/dashboard", c.consoleHome)
+	mux.HandleFunc("/hr/accounts", sysadminRouteStruct.accounts.accounts)
+	mux.HandleFunc("/hr/accounts/", sysadminRouteStruct.accounts.forms)
+	// Customer Admin Routes
+	mux.HandleFunc("/customer/dashboard", c.consoleHome)
+	mux.HandleFunc("/customer/consumer", sysadminRouteStruct.consumer.consumer)
+	mux.HandleFunc("/customer/consumer/", sysadminRouteStruct.consumer.information)
+	mux.HandleFunc("/customer/accounts", sysadminRouteStruct.accounts.accounts)
+	mux.HandleFunc("/customer/accounts/", sysadminRouteStruct.accounts.forms)
+
 	return mux
 }
+
+// consoleHome renders the landing page of the consoles without a map dashboard
+func (c *V1EmployeeRoute) consoleHome(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		web.EmployeeConsoleHomeWebPage(consoleOf(r)).Render(r.Context(), w)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// consumerList loads the consumers matching the "search" query parameter
+func (c *V1EmployeeRoute) consumerList(r *http.Request) ([]web.ConsumerList, error) {
+	consumers, err := c.Deps.GetDB().Consumers().List(r.Context(), database.ConsumerFilter{
+		Search: r.URL.Query().Get("search"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]web.ConsumerList, 0, len(consumers))
+	for _, consumer := range consumers {
+		list = append(list, web.ConsumerList{
+			ConsumerID:   consumer.AccountNumber,
+			ConsumerName: consumer.FullName(),
+			ConsumerType: consumer.AccountType,
+			Status:       consumer.Status,
+		})
+	}
+	return list, nil
+}
+
+// consumerInformation loads a consumer account together with its meters and
+// ledger
+func (c *V1EmployeeRoute) consumerInformation(r *http.Request, accountNumber string) (web.ConsumerInformation, error) {
+	consumer, err := c.Deps.GetDB().Consumers().Get(r.Context(), accountNumber)
+	if err != nil {
+		return web.ConsumerInformation{}, err
+	}
+
+	meters, err := c.Deps.GetDB().Meters().List(r.Context(), database.MeterFilter{ConsumerID: consumer.ID})
+	if err != nil {
+		return web.ConsumerInformation{}, err
+	}
+
+	entries, err := c.Deps.GetDB().Ledger().List(r.Context(), consumer.ID)
+	if err != nil {
+		return web.ConsumerInformation{}, err
+	}
+
+	info := web.ConsumerInformation{
+		AccountNumber: consumer.AccountNumber,
+		Name:          consumer.FullName(),
+		Address:       consumer.Address(),
+		Phone:         consumer.PhoneNumber,
+		Email:         consumer.Email,
+		AccountType:   consumer.AccountType,
+		Status:        consumer.Status,
+		Meters:        make([]web.SmartMeter, 0, len(meters)),
+	}
+	for _, meter := range meters {
+		info.Meters = append(info.Meters, web.SmartMeter{
+			ID:           meter.SerialNumber,
+			Name:         meter.Name,
+			Location:     meter.Location,
+			Latitude:     meter.Latitude,
+			Longitude:    meter.Longitude,
+			Status:       meter.Status,
+			Connectivity: meter.Connectivity,
+			LastSeen:     formatSeenAt(meter.LastSeenAt),
+		})
+	}
+	info.Ledger, info.Balance = ledgerView(entries)
+	return info, nil
+}
+
+// consoleOf returns the employee console named by the first path segment
+func consoleOf(r *http.Request) web.EmployeeConsole {
+	name := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+	for _, console := range web.EmployeeConsoles {
+		if console.Name == name {
+			return console
+		}
+	}
+	return web.SystemAdminConsole
+}
+
+// pageSegment returns the first path segment after "/<console>/<page>/"
+func pageSegment(path, page string) string {
+	_, rest, _ := strings.Cut(path, "/"+page+"/")
+	return strings.SplitN(rest, "/", 2)[0]
+}
+
+// pageArgument returns the path segment following "/<console>/<page>/<segment>/",
+// e.g. the account number of "/sysadmin/consumer/consumer-info/C000001"
+func pageArgument(path, page, segment string) string {
+	_, rest, _ := strings.Cut(path, "/"+page+"/"+segment+"/")
+	return strings.SplitN(rest, "/", 2)[0]
+}
@@ -0,0 +1,248 @@
+/*
+ * @file internal/server/routes/variance.go
+ * @brief variance.go file holds the report comparing the billed rates against the ERC rates
+ */
+package routes
+
+import (
+	"SmartMeterSystem/cmd/web"
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/config"
+	"SmartMeterSystem/internal/database"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultVarianceTolerance is how far a billed rate may be from the ERC rate
+// before the report flags it, in PhP per unit, read from RATE_VARIANCE_TOLERANCE
+var defaultVarianceTolerance = config.Decimal("RATE_VARIANCE_TOLERANCE", decimal.RequireFromString("0.0001"))
+
+// varianceReport is the variance of a class over its last billing cycle
+type varianceReport struct {
+	Class      string
+	CycleStart time.Time
+	CycleEnd   time.Time // exclusive
+	Tolerance  decimal.Decimal
+	Usage      billing.ClassUsage
+	Variances  []billing.Variance
+	Complete   bool // both a billed and an ERC schedule were in force
+}
+
+// lastBillingCycle returns the calendar month before the one containing now
+func lastBillingCycle(now time.Time) (start, end time.Time) {
+	end = database.PeriodStart(database.GranularityMonth, now)
+	return end.AddDate(0, -1, 0), end
+}
+
+// parseTolerance reads the "tolerance" query parameter
+func parseTolerance(r *http.Request) (decimal.Decimal, error) {
+	value := r.URL.Query().Get("tolerance")
+	if value == "" {
+		return defaultVarianceTolerance, nil
+	}
+	tolerance, err := decimal.NewFromString(value)
+	if err != nil || tolerance.IsNegative() {
+		return decimal.Decimal{}, errors.New("must be a non-negative amount")
+	}
+	return tolerance, nil
+}
+
+// buildVarianceReport compares the schedules in force at the end of the last
+// billing cycle, weighing each difference by what the class used in it
+func (c *V1EmployeeRoute) buildVarianceReport(r *http.Request, class string, tolerance decimal.Decimal, now time.Time) (varianceReport, error) {
+	report := varianceReport{Class: class, Tolerance: tolerance}
+	report.CycleStart, report.CycleEnd = lastBillingCycle(now)
+
+	at := report.CycleEnd.Add(-time.Nanosecond)
+	schedules := c.Deps.GetDB().RateSchedules()
+	billed, err := schedules.Effective(r.Context(), class, database.RateKindBilled, at)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return varianceReport{}, err
+	}
+	erc, err := schedules.Effective(r.Context(), class, database.RateKindERC, at)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return varianceReport{}, err
+	}
+	if billed == nil || erc == nil {
+		return report, nil
+	}
+
+	usage, err := c.classUsage(r, class, report.CycleStart, report.CycleEnd)
+	if err != nil {
+		return varianceReport{}, err
+	}
+	report.Usage = usage
+	report.Variances = billing.Variances(billed.Table(), erc.Table(), tolerance, usage)
+	report.Complete = true
+	return report, nil
+}
+
+// classUsage totals the monthly rollups of the meters of every active
+// consumer of the class over [from, to)
+func (c *V1EmployeeRoute) classUsage(r *http.Request, class string, from, to time.Time) (billing.ClassUsage, error) {
+	db := c.Deps.GetDB()
+	consumers, err := db.Consumers().List(r.Context(), database.ConsumerFilter{AccountType: class, Status: database.ConsumerStatusActive})
+	if err != nil {
+		return billing.ClassUsage{}, err
+	}
+	usage := billing.ClassUsage{Consumers: len(consumers)}
+	if len(consumers) == 0 {
+		return usage, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(consumers))
+	for _, consumer := range consumers {
+		ids = append(ids, consumer.ID)
+	}
+	meters, err := db.Meters().List(r.Context(), database.MeterFilter{ConsumerIDs: ids})
+	if err != nil {
+		return billing.ClassUsage{}, err
+	}
+	owners := make(map[string]primitive.ObjectID, len(meters))
+	serials := make([]string, 0, len(meters))
+	for _, meter := range meters {
+		owners[meter.SerialNumber] = meter.ConsumerID
+		serials = append(serials, meter.SerialNumber)
+	}
+	if len(serials) == 0 {
+		return usage, nil
+	}
+
+	rollups, err := db.Rollups().List(r.Context(), database.RollupFilter{
+		SerialNumbers: serials,
+		Granularity:   database.GranularityMonth,
+		From:          from,
+		To:            to,
+	})
+	if err != nil {
+		return billing.ClassUsage{}, err
+	}
+
+	// The demand of a consumer is the highest peak of any of its meters
+	peaks := map[primitive.ObjectID]float64{}
+	for _, rollup := range rollups {
+		usage.EnergyKWh = usage.EnergyKWh.Add(decimal.NewFromFloat(rollup.EnergyKWh))
+		owner := owners[rollup.SerialNumber]
+		peaks[owner] = max(peaks[owner], rollup.PeakPowerKW)
+	}
+	for _, peak := range peaks {
+		usage.DemandKW = usage.DemandKW.Add(decimal.NewFromFloat(peak))
+	}
+	return usage, nil
+}
+
+// varianceView formats a report for the accounting page
+func varianceView(report varianceReport) web.RateVarianceReport {
+	view := web.RateVarianceReport{
+		Class:     report.Class,
+		Cycle:     report.CycleStart.Format("January 2006"),
+		Tolerance: report.Tolerance.String(),
+		Complete:  report.Complete,
+		Consumers: report.Usage.Consumers,
+		EnergyKWh: report.Usage.EnergyKWh.StringFixed(2),
+		DemandKW:  report.Usage.DemandKW.StringFixed(2),
+	}
+	var impact decimal.Decimal
+	for _, v := range report.Variances {
+		row := varianceRow(v)
+		view.Rows = append(view.Rows, web.RateVarianceRow{
+			Group:       row[0],
+			Particulars: row[1],
+			Unit:        row[2],
+			Billed:      row[3],
+			ERC:         row[4],
+			Difference:  row[5],
+			Impact:      row[6],
+			Flagged:     v.Flagged,
+		})
+		if v.Flagged {
+			view.Flagged++
+			impact = impact.Add(v.Impact)
+		}
+	}
+	view.FlaggedImpact = impact.StringFixed(2)
+	return view
+}
+
+// varianceRow formats one variance as the report columns
+func varianceRow(v billing.Variance) []string {
+	optional := func(amount *decimal.Decimal) string {
+		if amount == nil {
+			return ""
+		}
+		return formatRate(*amount)
+	}
+	return []string{
+		v.Group,
+		v.Particulars,
+		string(v.Unit),
+		optional(v.Billed),
+		optional(v.ERC),
+		formatRate(v.Difference),
+		v.Impact.StringFixed(2),
+	}
+}
+
+// rateVariance renders the variance report of the class
+func (c *V1EmployeeRoute) rateVariance(w http.ResponseWriter, r *http.Request) {
+	class, ok := rateClassOf(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	// A bad tolerance falls back to the default, the report says so
+	tolerance, toleranceErr := parseTolerance(r)
+	if toleranceErr != nil {
+		tolerance = defaultVarianceTolerance
+	}
+
+	report, err := c.buildVarianceReport(r, class, tolerance, time.Now())
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Rate variance error: %v", err)
+		http.Error(w, "Error computing the variance report", http.StatusInternalServerError)
+		return
+	}
+	view := varianceView(report)
+	if toleranceErr != nil {
+		view.Error = "Tolerance " + toleranceErr.Error() + ", the default is used"
+	}
+	web.AccountingVarianceReport(view).Render(r.Context(), w)
+}
+
+// rateVarianceCSV writes the variance report of the class as a CSV download
+func (c *V1EmployeeRoute) rateVarianceCSV(w http.ResponseWriter, r *http.Request) {
+	class, ok := rateClassOf(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	tolerance, err := parseTolerance(r)
+	if err != nil {
+		http.Error(w, "Bad request: tolerance "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := c.buildVarianceReport(r, class, tolerance, time.Now())
+	if err != nil {
+		c.Deps.GetLogger().Sugar().Errorf("Rate variance error: %v", err)
+		http.Error(w, "Error computing the variance report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="rate-variance-%s-%s.csv"`,
+		class, report.CycleStart.Format("2006-01")))
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Group", "Particulars", "Unit", "Billed", "ERC", "Difference", "Impact", "Flagged"})
+	for _, v := range report.Variances {
+		writer.Write(append(varianceRow(v), strconv.FormatBool(v.Flagged)))
+	}
+	writer.Flush()
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/database"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestLastBillingCycle(t *testing.T) {
+	now := time.Date(2025, 3, 1, 0, 30, 0, 0, database.RollupLocation)
+	start, end := lastBillingCycle(now)
+	if start.Month() != time.February || end.Month() != time.March || end.Day() != 1 {
+		t.Errorf("lastBillingCycle() = %v, %v", start, end)
+	}
+}
+
+func TestParseTolerance(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		err   bool
+	}{
+		{"", defaultVarianceTolerance.String(), false},
+		{"tolerance=0.01", "0.01", false},
+		{"tolerance=-1", "", true},
+		{"tolerance=abc", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseTolerance(httptest.NewRequest("GET", "/variance-report?"+tt.query, nil))
+		if (err != nil) != tt.err || (err == nil && got.String() != tt.want) {
+			t.Errorf("parseTolerance(%q) = %s, %v", tt.query, got, err)
+		}
+	}
+}
+
+func TestVarianceView(t *testing.T) {
+	billed, erc := decimal.RequireFromString("5.6100"), decimal.RequireFromString("5.6092")
+	report := varianceReport{
+		Class:      database.ConsumerTypeResidential,
+		CycleStart: time.Date(2025, 2, 1, 0, 0, 0, 0, database.RollupLocation),
+		Tolerance:  decimal.RequireFromString("0.0001"),
+		Complete:   true,
+		Variances: []billing.Variance{
+			{Group: "Generation Charges", Particulars: "Generation Energy Charge", Unit: billing.UnitPerKWh,
+				Billed: &billed, ERC: &erc, Difference: billed.Sub(erc), Impact: decimal.RequireFromString("0.80"), Flagged: true},
+			{Group: "Supply Charges", Particulars: "Supply System Charge", Unit: billing.UnitPerKWh,
+				Billed: &billed, Impact: decimal.RequireFromString("12.50")},
+		},
+	}
+
+	view := varianceView(report)
+	if view.Cycle != "February 2025" || view.Flagged != 1 || view.FlaggedImpact != "0.80" {
+		t.Errorf("varianceView() = %+v", view)
+	}
+	if row := view.Rows[0]; row.Difference != "0.0008" || row.ERC != "5.6092" {
+		t.Errorf("varianceView() row = %+v", row)
+	}
+	if row := view.Rows[1]; row.ERC != "" || row.Billed != "5.6100" {
+		t.Errorf("varianceView() row without an ERC rate = %+v", row)
+	}
+}
@@ -8,7 +8,13 @@ package server
 import (
 	"SmartMeterSystem/cmd/web"
 	"SmartMeterSystem/internal"
+	"SmartMeterSystem/internal/alerting"
+	"SmartMeterSystem/internal/auth"
+	"SmartMeterSystem/internal/billing"
+	"SmartMeterSystem/internal/database"
 	"SmartMeterSystem/internal/server/routes"
+	"SmartMeterSystem/internal/telemetry"
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -43,10 +49,16 @@ type Server struct {
 	logger              *zap.Logger
 	defaultRouteVersion string
 	clienttype          string
+	db                  database.Service
+	authenticator       *auth.Authenticator
+	sessions            *auth.SessionManager
+	telemetry           *telemetry.Hub
+	alerting            *alerting.Engine
 }
 
-// NewServer creates a new HTTP server instance
-func NewServer() *http.Server {
+// NewServer creates a new HTTP server instance on the database, streaming
+// the events of the telemetry hub to the dashboards
+func NewServer(db database.Service, hub *telemetry.Hub) *http.Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
 	defaultRouteVersion := os.Getenv("DEFAULT_ROUTE_VERSION")
 	if defaultRouteVersion == "" {
@@ -64,8 +76,16 @@ func NewServer() *http.Server {
 		logger:              logger,
 		defaultRouteVersion: defaultRouteVersion,
 		clienttype:          "",
+		db:                  db,
+		authenticator:       auth.NewAuthenticator(db.Users()),
+		sessions:            auth.NewSessionManager(db.Sessions(), auth.SessionConfigFromEnv()),
+		telemetry:           hub,
+		alerting:            alerting.NewEngine(db, hub, logger, alerting.ConfigFromEnv()),
 	}
 
+	NewServer.bootstrapAdmin()
+	NewServer.bootstrapRates()
+
 	// Declare Server config
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", NewServer.port),
@@ -74,6 +94,8 @@ func NewServer() *http.Server {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+	// Shutdown does not close hijacked connections, end the telemetry streams
+	server.RegisterOnShutdown(NewServer.telemetry.Close)
 
 	return server
 }
@@ -87,12 +109,99 @@ func (s *Server) GetDefaultRouteVersion() string {
 	return s.defaultRouteVersion
 }
 
+func (s *Server) GetDB() database.Service {
+	return s.db
+}
+
+func (s *Server) GetAuthenticator() *auth.Authenticator {
+	return s.authenticator
+}
+
+func (s *Server) GetSessions() *auth.SessionManager {
+	return s.sessions
+}
+
+func (s *Server) GetTelemetry() *telemetry.Hub {
+	return s.telemetry
+}
+
+func (s *Server) GetAlerting() *alerting.Engine {
+	return s.alerting
+}
+
+// GetConsoleURL returns the dashboard of the console the role logs into
+func (s *Server) GetConsoleURL(role string) (string, bool) {
+	console, ok := roleConsoles[Role(role)]
+	if !ok {
+		return "", false
+	}
+	return "/" + s.defaultRouteVersion + "/employee/" + console + "/dashboard", true
+}
+
+// bootstrapAdmin creates the first system administrator from the
+// BOOTSTRAP_ADMIN_EMAIL and BOOTSTRAP_ADMIN_PASSWORD environment variables
+// so that a fresh database can be logged into
+func (s *Server) bootstrapAdmin() {
+	email := os.Getenv("BOOTSTRAP_ADMIN_EMAIL")
+	password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := s.authenticator.EnsureUser(ctx, &database.User{
+		Email:      email,
+		Name:       "System Administrator",
+		ClientType: string(EmployeeType),
+		Role:       string(RoleSystemAdmin),
+	}, password)
+	if err != nil {
+		s.logger.Sugar().Warnf("could not bootstrap system administrator: %v", err)
+	}
+}
+
+// bootstrapRates stores the default residential rate and ERC schedules
+// when none were ever saved, so the accounting forms have rows to edit
+func (s *Server) bootstrapRates() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, kind := range []string{database.RateKindBilled, database.RateKindERC} {
+		history, err := s.db.RateSchedules().History(ctx, database.ConsumerTypeResidential, kind)
+		if err != nil {
+			s.logger.Sugar().Warnf("could not bootstrap %s schedule: %v", kind, err)
+			return
+		}
+		if len(history) > 0 {
+			continue
+		}
+
+		err = s.db.RateSchedules().Create(ctx, &database.RateSchedule{
+			Class:         database.ConsumerTypeResidential,
+			Kind:          kind,
+			EffectiveDate: billing.DefaultEffectiveDate,
+			Groups:        billing.DefaultGroups(),
+			CreatedByName: "System",
+			Status:        database.RateStatusApproved,
+		})
+		if err != nil {
+			s.logger.Sugar().Warnf("could not bootstrap %s schedule: %v", kind, err)
+			return
+		}
+	}
+}
+
 // RegisterRoutes sets up all HTTP routes with dependencies injected
 func (s *Server) RegisterRoutes() http.Handler {
 	mux := http.NewServeMux()
 
+	// The last middleware in the group is the outermost one
 	middlewareGroup := []func(http.Handler) http.Handler{
+		s.authorizationMiddleware,
 		s.loggingMiddleware,
+		s.sessionMiddleware,
 	}
 
 	// Create versioned routes with server dependencies injected
@@ -0,0 +1,136 @@
+/*
+ * @file internal/telemetry/hub.go
+ * @brief hub.go file holds the in-process pub/sub hub pushing meter updates to the dashboards
+ */
+package telemetry
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	// EventReading carries the latest reading of a meter
+	EventReading = "reading"
+	// EventStatus carries the new status of a meter, or a meter just registered
+	EventStatus = "status"
+	// EventConnectivity carries a meter going online, stale or offline
+	EventConnectivity = "connectivity"
+	// EventAlert carries an alert just raised on a meter
+	EventAlert = "alert"
+	// EventCommand carries the outcome a meter reported for a command
+	EventCommand = "command"
+)
+
+// Event is one update about a meter pushed to the dashboards
+type Event struct {
+	Type         string    `json:"type"`
+	Serial       string    `json:"serial"`
+	Status       string    `json:"status,omitempty"`
+	Connectivity string    `json:"connectivity,omitempty"`
+	Reading      *Reading  `json:"reading,omitempty"`
+	Command      string    `json:"command,omitempty"`
+	Severity     string    `json:"severity,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	At           time.Time `json:"at"`
+}
+
+// Reading is the latest reading of a meter as shown on the dashboards
+type Reading struct {
+	Timestamp time.Time `json:"timestamp"`
+	EnergyKWh float64   `json:"energy_kwh"`
+	PowerKW   float64   `json:"power_kw"`
+	Voltage   float64   `json:"voltage"`
+	Current   float64   `json:"current"`
+}
+
+// Hub fans the published events out to every subscriber. Publishing never
+// blocks: a subscriber too slow to keep its buffer drained is closed, and is
+// expected to reload its state and subscribe again.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// Subscription receives the events published after it was made
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: map[*Subscription]struct{}{}}
+}
+
+// Subscribe starts receiving events, up to buffer of them queued. The
+// subscription of a closed hub is closed already.
+func (h *Hub) Subscribe(buffer int) *Subscription {
+	s := &Subscription{hub: h, events: make(chan Event, buffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(s.events)
+		return s
+	}
+	h.subscribers[s] = struct{}{}
+	return s
+}
+
+// Publish sends the event to every subscriber, stamping it with the time
+// when unset
+func (h *Hub) Publish(event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now().UTC()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subscribers {
+		select {
+		case s.events <- event:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Subscribers returns how many subscriptions are open
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// Close closes every subscription and refuses new ones, so the streams end
+// when the server shuts down
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subscribers {
+		h.remove(s)
+	}
+}
+
+// remove closes the subscription; the caller holds the lock
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Events returns the channel of events, closed when the subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close ends the subscription; closing it again does nothing
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
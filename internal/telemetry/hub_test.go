@@ -0,0 +1,54 @@
+package telemetry
+
+import "testing"
+
+func TestHubPublish(t *testing.T) {
+	hub := NewHub()
+	first, second := hub.Subscribe(4), hub.Subscribe(4)
+	hub.Publish(Event{Type: EventStatus, Serial: "SN-1", Status: "offline"})
+
+	for _, s := range []*Subscription{first, second} {
+		event := <-s.Events()
+		if event.Serial != "SN-1" || event.Status != "offline" || event.At.IsZero() {
+			t.Errorf("Events() = %+v", event)
+		}
+	}
+
+	first.Close()
+	first.Close()
+	if _, ok := <-first.Events(); ok {
+		t.Error("Events() of a closed subscription is still open")
+	}
+	if hub.Subscribers() != 1 {
+		t.Errorf("Subscribers() = %d, want 1", hub.Subscribers())
+	}
+}
+
+func TestHubDropsSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	slow := hub.Subscribe(1)
+	hub.Publish(Event{Type: EventReading, Serial: "SN-1"})
+	hub.Publish(Event{Type: EventReading, Serial: "SN-1"})
+
+	if _, ok := <-slow.Events(); !ok {
+		t.Fatal("Events() lost the buffered event")
+	}
+	if _, ok := <-slow.Events(); ok {
+		t.Error("Events() of a subscriber that fell behind is still open")
+	}
+	if hub.Subscribers() != 0 {
+		t.Errorf("Subscribers() = %d, want 0", hub.Subscribers())
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub()
+	open := hub.Subscribe(1)
+	hub.Close()
+	if _, ok := <-open.Events(); ok {
+		t.Error("Close() left a subscription open")
+	}
+	if _, ok := <-hub.Subscribe(1).Events(); ok {
+		t.Error("Subscribe() on a closed hub returned an open subscription")
+	}
+}